@@ -0,0 +1,238 @@
+package handlers
+
+import (
+	"ai-content-creation/models"
+	"ai-content-creation/services"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AdminUserUpdateRequest struct {
+	SubscriptionTier *models.SubscriptionTier `json:"subscription_tier"`
+	Role             *models.UserRole         `json:"role"` // user or admin
+	Disabled         *bool                    `json:"disabled"`
+}
+
+type AdminCreditRequest struct {
+	Amount int    `json:"amount" binding:"required"` // negative to revoke
+	Reason string `json:"reason" binding:"required,max=200"`
+}
+
+type PlanRequest struct {
+	Name            *string  `json:"name" binding:"omitempty,min=1,max=100"`
+	Price           *float64 `json:"price"`
+	TokensPerMonth  *int     `json:"tokens_per_month"` // -1 for unlimited
+	MonthlyCredits  *int     `json:"monthly_credits"`
+	ModelsAvailable []string `json:"models_available"`
+}
+
+type CreatePlanRequest struct {
+	PlanRequest
+	Tier models.SubscriptionTier `json:"tier" binding:"required"`
+}
+
+type AdminUserResponse struct {
+	ProfileResponse
+	Role             models.UserRole `json:"role"`
+	StripeCustomerID string          `json:"stripe_customer_id,omitempty"`
+	DisabledAt       *time.Time      `json:"disabled_at,omitempty"`
+}
+
+type AdminUsersResponse struct {
+	Users []AdminUserResponse `json:"users"`
+	Total int64               `json:"total"` // users matching the search
+}
+
+// GetAdminUsers lists users, newest first. Supports ?q= to search names and
+// emails, and ?limit= and ?offset= for paging.
+func (h *Handler) GetAdminUsers(c *gin.Context) {
+	limit, offset, ok := pageParams(c)
+	if !ok {
+		return
+	}
+
+	users, total, err := h.adminService.GetUsers(c.Query("q"), limit, offset)
+	if err != nil {
+		sendError(c, http.StatusInternalServerError, "Failed to fetch users")
+		return
+	}
+
+	response := AdminUsersResponse{Users: []AdminUserResponse{}, Total: total}
+	for i := range users {
+		response.Users = append(response.Users, newAdminUserResponse(&users[i]))
+	}
+
+	sendSuccess(c, http.StatusOK, response)
+}
+
+func (h *Handler) GetAdminUser(c *gin.Context) {
+	user, err := h.adminService.GetUser(c.Param("id"))
+	if err != nil {
+		sendAdminError(c, err, "Failed to fetch user")
+		return
+	}
+
+	sendSuccess(c, http.StatusOK, newAdminUserResponse(user))
+}
+
+// UpdateAdminUser changes a user's tier or role, or disables or re-enables
+// their account.
+func (h *Handler) UpdateAdminUser(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		sendError(c, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var req AdminUserUpdateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		sendError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	user, err := h.adminService.UpdateUser(userID.(string), c.Param("id"), services.UserUpdate{
+		Tier:     req.SubscriptionTier,
+		Role:     req.Role,
+		Disabled: req.Disabled,
+	})
+	if err != nil {
+		sendAdminError(c, err, "Failed to update user")
+		return
+	}
+
+	sendSuccess(c, http.StatusOK, newAdminUserResponse(user))
+}
+
+// GetAdminUserCredits returns a user's balance and credit history, newest
+// first, with ?limit= and ?offset= for paging.
+func (h *Handler) GetAdminUserCredits(c *gin.Context) {
+	limit, offset, ok := pageParams(c)
+	if !ok {
+		return
+	}
+
+	user, err := h.adminService.GetUser(c.Param("id"))
+	if err != nil {
+		sendAdminError(c, err, "Failed to fetch user")
+		return
+	}
+
+	transactions, err := h.creditService.GetHistory(user.UserID, limit, offset)
+	if err != nil {
+		sendError(c, http.StatusInternalServerError, "Failed to fetch credit history")
+		return
+	}
+
+	sendSuccess(c, http.StatusOK, CreditHistoryResponse{
+		Balance:      user.RemainingCredits,
+		ResetsAt:     user.CreditsResetAt,
+		Transactions: newCreditTransactionResponses(transactions),
+	})
+}
+
+// GrantAdminUserCredits grants a user credits, or revokes them with a
+// negative amount.
+func (h *Handler) GrantAdminUserCredits(c *gin.Context) {
+	var req AdminCreditRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		sendError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	user, err := h.adminService.GrantCredits(c.Param("id"), req.Amount, req.Reason)
+	if err != nil {
+		sendAdminError(c, err, "Failed to grant credits")
+		return
+	}
+
+	sendSuccess(c, http.StatusOK, newAdminUserResponse(user))
+}
+
+func (h *Handler) CreatePlan(c *gin.Context) {
+	var req CreatePlanRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		sendError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	plan, err := h.adminService.CreatePlan(req.Tier, req.input())
+	if err != nil {
+		sendAdminError(c, err, "Failed to create plan")
+		return
+	}
+
+	sendPlan(c, http.StatusCreated, plan)
+}
+
+// UpdatePlan changes the fields given in the request.
+func (h *Handler) UpdatePlan(c *gin.Context) {
+	var req PlanRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		sendError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	plan, err := h.adminService.UpdatePlan(c.Param("id"), req.input())
+	if err != nil {
+		sendAdminError(c, err, "Failed to update plan")
+		return
+	}
+
+	sendPlan(c, http.StatusOK, plan)
+}
+
+func (r PlanRequest) input() services.PlanInput {
+	return services.PlanInput{
+		Name:            r.Name,
+		Price:           r.Price,
+		TokensPerMonth:  r.TokensPerMonth,
+		MonthlyCredits:  r.MonthlyCredits,
+		ModelsAvailable: r.ModelsAvailable,
+	}
+}
+
+func sendPlan(c *gin.Context, code int, plan *models.SubscriptionPlan) {
+	response, err := newSubscriptionPlanResponse(plan)
+	if err != nil {
+		sendError(c, http.StatusInternalServerError, "Failed to parse models available")
+		return
+	}
+	sendSuccess(c, code, response)
+}
+
+func sendAdminError(c *gin.Context, err error, message string) {
+	var unknownModel *services.UnknownModelError
+	switch {
+	case errors.Is(err, services.ErrUserNotFound):
+		sendError(c, http.StatusNotFound, "User not found")
+	case errors.Is(err, services.ErrPlanNotFound):
+		sendError(c, http.StatusNotFound, "Plan not found")
+	case errors.Is(err, services.ErrPlanExists):
+		sendError(c, http.StatusConflict, err.Error())
+	case errors.Is(err, services.ErrInsufficientCredits):
+		sendError(c, http.StatusConflict, "The user doesn't have that many credits")
+	case errors.Is(err, services.ErrAdminSelf):
+		sendError(c, http.StatusForbidden, err.Error())
+	case errors.Is(err, services.ErrInvalidTier),
+		errors.Is(err, services.ErrInvalidPlan),
+		errors.Is(err, services.ErrNoPlanModels),
+		errors.Is(err, services.ErrInvalidUserRole),
+		errors.Is(err, services.ErrInvalidAmount),
+		errors.As(err, &unknownModel):
+		sendError(c, http.StatusBadRequest, err.Error())
+	default:
+		sendError(c, http.StatusInternalServerError, message)
+	}
+}
+
+func newAdminUserResponse(user *models.User) AdminUserResponse {
+	return AdminUserResponse{
+		ProfileResponse:  newProfileResponse(user),
+		Role:             user.Role,
+		StripeCustomerID: user.StripeCustomerID,
+		DisabledAt:       user.DisabledAt,
+	}
+}
@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"ai-content-creation/models"
+	"ai-content-creation/services"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type APIKeyRequest struct {
+	Name        string     `json:"name" binding:"required,max=100"`
+	Scopes      []string   `json:"scopes" binding:"required,min=1"` // content:read, generate:write
+	WorkspaceID string     `json:"workspace_id"`                    // optional workspace the key acts in
+	ExpiresAt   *time.Time `json:"expires_at"`                      // optional
+}
+
+type APIKeyResponse struct {
+	KeyID       string     `json:"key_id"`
+	Name        string     `json:"name"`
+	Prefix      string     `json:"prefix"` // the start of the key, to tell keys apart
+	WorkspaceID string     `json:"workspace_id,omitempty"`
+	Scopes      []string   `json:"scopes"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt  *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// CreatedAPIKeyResponse is only returned when a key is created; the key
+// itself can't be retrieved afterwards.
+type CreatedAPIKeyResponse struct {
+	APIKeyResponse
+	Key string `json:"key"`
+}
+
+func (h *Handler) GetAPIKeys(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		sendError(c, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	keys, err := h.apiKeyService.GetAPIKeys(userID.(string))
+	if err != nil {
+		sendError(c, http.StatusInternalServerError, "Failed to fetch API keys")
+		return
+	}
+
+	response := []APIKeyResponse{}
+	for i := range keys {
+		response = append(response, newAPIKeyResponse(&keys[i]))
+	}
+
+	sendSuccess(c, http.StatusOK, response)
+}
+
+// CreateAPIKey creates an API key. The response is the only time the full
+// key is shown.
+func (h *Handler) CreateAPIKey(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		sendError(c, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var req APIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		sendError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	apiKey, key, err := h.apiKeyService.CreateAPIKey(userID.(string), services.APIKeyInput{
+		Name:        req.Name,
+		WorkspaceID: req.WorkspaceID,
+		Scopes:      req.Scopes,
+		ExpiresAt:   req.ExpiresAt,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidScope), errors.Is(err, services.ErrAPIKeyExpiry):
+			sendError(c, http.StatusBadRequest, err.Error())
+		case errors.Is(err, services.ErrWorkspaceNotFound):
+			sendError(c, http.StatusNotFound, "Workspace not found")
+		case errors.Is(err, services.ErrAPIKeyWorkspace):
+			sendError(c, http.StatusForbidden, err.Error())
+		default:
+			sendError(c, http.StatusInternalServerError, "Failed to create API key")
+		}
+		return
+	}
+
+	sendSuccess(c, http.StatusCreated, CreatedAPIKeyResponse{
+		APIKeyResponse: newAPIKeyResponse(apiKey),
+		Key:            key,
+	})
+}
+
+// DeleteAPIKey revokes an API key immediately.
+func (h *Handler) DeleteAPIKey(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		sendError(c, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	if err := h.apiKeyService.DeleteAPIKey(userID.(string), c.Param("id")); err != nil {
+		if errors.Is(err, services.ErrAPIKeyNotFound) {
+			sendError(c, http.StatusNotFound, "API key not found")
+			return
+		}
+		sendError(c, http.StatusInternalServerError, "Failed to delete API key")
+		return
+	}
+
+	sendSuccess(c, http.StatusOK, nil)
+}
+
+func newAPIKeyResponse(apiKey *models.APIKey) APIKeyResponse {
+	response := APIKeyResponse{
+		KeyID:       apiKey.KeyID,
+		Name:        apiKey.Name,
+		Prefix:      apiKey.Prefix,
+		WorkspaceID: apiKey.WorkspaceID,
+		ExpiresAt:   apiKey.ExpiresAt,
+		LastUsedAt:  apiKey.LastUsedAt,
+		CreatedAt:   apiKey.CreatedAt,
+	}
+	// Scopes were validated before they were stored
+	response.Scopes, _ = apiKey.GetScopes()
+	return response
+}
@@ -1,7 +1,12 @@
 package handlers
 
 import (
+	"ai-content-creation/services"
+	"errors"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -17,15 +22,41 @@ type RegisterRequest struct {
 	Password string `json:"password" binding:"required,min=6"`
 }
 
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required,min=6"`
+}
+
 type UserResponse struct {
-	ID    string `json:"id"`
-	Name  string `json:"name"`
-	Email string `json:"email"`
+	ID            string `json:"id"`
+	Name          string `json:"name"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
 }
 
 type AuthResponse struct {
-	Token string       `json:"token"`
-	User  UserResponse `json:"user"`
+	Token        string       `json:"token"`
+	RefreshToken string       `json:"refresh_token"`
+	ExpiresAt    time.Time    `json:"expires_at"` // when token expires
+	User         UserResponse `json:"user"`
+}
+
+type TokenResponse struct {
+	Token        string    `json:"token"`
+	RefreshToken string    `json:"refresh_token"`
+	ExpiresAt    time.Time `json:"expires_at"`
 }
 
 func (h *Handler) Register(c *gin.Context) {
@@ -35,18 +66,21 @@ func (h *Handler) Register(c *gin.Context) {
 		return
 	}
 
-	user, token, err := h.authService.RegisterUser(req.Name, req.Email, req.Password)
+	user, tokens, err := h.authService.RegisterUser(req.Name, req.Email, req.Password, loginClient(c))
 	if err != nil {
 		sendError(c, http.StatusInternalServerError, err.Error())
 		return
 	}
 
 	sendSuccess(c, http.StatusCreated, AuthResponse{
-		Token: token,
+		Token:        tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		ExpiresAt:    tokens.ExpiresAt,
 		User: UserResponse{
-			ID:    user.UserID,
-			Name:  user.Name,
-			Email: user.Email,
+			ID:            user.UserID,
+			Name:          user.Name,
+			Email:         user.Email,
+			EmailVerified: user.EmailVerifiedAt != nil,
 		},
 	})
 }
@@ -58,19 +92,168 @@ func (h *Handler) Login(c *gin.Context) {
 		return
 	}
 
-	user, token, err := h.authService.LoginUser(req.Email, req.Password)
+	user, tokens, err := h.authService.LoginUser(req.Email, req.Password, loginClient(c))
 	if err != nil {
-		sendError(c, http.StatusUnauthorized, "Invalid credentials")
+		var throttled *services.LoginThrottledError
+		switch {
+		case errors.Is(err, services.ErrInvalidCredentials):
+			sendError(c, http.StatusUnauthorized, "Invalid credentials")
+		case errors.Is(err, services.ErrAccountDisabled):
+			sendError(c, http.StatusForbidden, "Account has been disabled")
+		case errors.As(err, &throttled):
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(throttled.RetryAfter.Seconds()))))
+			sendError(c, http.StatusTooManyRequests, "Too many failed sign-in attempts, try again later")
+		default:
+			sendError(c, http.StatusInternalServerError, "Failed to sign in")
+		}
 		return
 	}
 
 	sendSuccess(c, http.StatusOK, AuthResponse{
-		Token: token,
+		Token:        tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		ExpiresAt:    tokens.ExpiresAt,
 		User: UserResponse{
-			ID:    user.UserID,
-			Name:  user.Name,
-			Email: user.Email,
+			ID:            user.UserID,
+			Name:          user.Name,
+			Email:         user.Email,
+			EmailVerified: user.EmailVerifiedAt != nil,
 		},
 	})
 }
 
+// Refresh exchanges a refresh token for a new token pair. Each refresh token
+// works once; reusing one signs its session out everywhere.
+func (h *Handler) Refresh(c *gin.Context) {
+	var req RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		sendError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	tokens, err := h.authService.RefreshTokens(req.RefreshToken)
+	if err != nil {
+		if isSessionError(err) {
+			sendError(c, http.StatusUnauthorized, err.Error())
+			return
+		}
+		sendError(c, http.StatusInternalServerError, "Failed to refresh token")
+		return
+	}
+
+	sendSuccess(c, http.StatusOK, TokenResponse{
+		Token:        tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		ExpiresAt:    tokens.ExpiresAt,
+	})
+}
+
+// Logout revokes the session of the given refresh token. Its access tokens
+// stop working immediately.
+func (h *Handler) Logout(c *gin.Context) {
+	var req RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		sendError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := h.authService.Logout(req.RefreshToken); err != nil {
+		if isSessionError(err) {
+			sendError(c, http.StatusUnauthorized, err.Error())
+			return
+		}
+		sendError(c, http.StatusInternalServerError, "Failed to log out")
+		return
+	}
+
+	sendSuccess(c, http.StatusOK, nil)
+}
+
+// VerifyEmail confirms the user's address with the token from the
+// verification email.
+func (h *Handler) VerifyEmail(c *gin.Context) {
+	var req VerifyEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		sendError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := h.authService.VerifyEmail(req.Token); err != nil {
+		if errors.Is(err, services.ErrInvalidAccountToken) {
+			sendError(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		sendError(c, http.StatusInternalServerError, "Failed to verify email")
+		return
+	}
+
+	sendSuccess(c, http.StatusOK, nil)
+}
+
+// ResendVerification sends the signed-in user a new verification email.
+func (h *Handler) ResendVerification(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		sendError(c, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	if err := h.authService.SendVerificationEmail(userID.(string)); err != nil {
+		if errors.Is(err, services.ErrEmailAlreadyVerified) {
+			sendError(c, http.StatusConflict, err.Error())
+			return
+		}
+		sendError(c, http.StatusInternalServerError, "Failed to send verification email")
+		return
+	}
+
+	sendSuccess(c, http.StatusOK, nil)
+}
+
+// ForgotPassword emails a reset link. It responds the same way whether or
+// not an account exists for the address.
+func (h *Handler) ForgotPassword(c *gin.Context) {
+	var req ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		sendError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := h.authService.ForgotPassword(req.Email); err != nil {
+		sendError(c, http.StatusInternalServerError, "Failed to send password reset email")
+		return
+	}
+
+	sendSuccess(c, http.StatusOK, nil)
+}
+
+// ResetPassword sets a new password with the token from the reset email and
+// signs the user out everywhere.
+func (h *Handler) ResetPassword(c *gin.Context) {
+	var req ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		sendError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := h.authService.ResetPassword(req.Token, req.Password); err != nil {
+		if errors.Is(err, services.ErrInvalidAccountToken) {
+			sendError(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		sendError(c, http.StatusInternalServerError, "Failed to reset password")
+		return
+	}
+
+	sendSuccess(c, http.StatusOK, nil)
+}
+
+func isSessionError(err error) bool {
+	return errors.Is(err, services.ErrInvalidRefreshToken) ||
+		errors.Is(err, services.ErrRefreshTokenReused) ||
+		errors.Is(err, services.ErrSessionRevoked)
+}
+
+func loginClient(c *gin.Context) services.LoginClient {
+	return services.LoginClient{IP: c.ClientIP(), UserAgent: c.Request.UserAgent()}
+}
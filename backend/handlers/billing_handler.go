@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"ai-content-creation/models"
+	"ai-content-creation/services"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CheckoutRequest struct {
+	Tier string `json:"tier" binding:"required"`
+}
+
+type CheckoutResponse struct {
+	SessionID string `json:"session_id"`
+	URL       string `json:"url"`
+}
+
+type PortalResponse struct {
+	URL string `json:"url"`
+}
+
+func (h *Handler) CreateCheckoutSession(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		sendError(c, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var req CheckoutRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		sendError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	session, err := h.billingService.CreateCheckoutSession(c.Request.Context(), userID.(string), models.SubscriptionTier(req.Tier))
+	if err != nil {
+		sendError(c, billingErrorStatus(err), err.Error())
+		return
+	}
+
+	sendSuccess(c, http.StatusOK, CheckoutResponse{
+		SessionID: session.ID,
+		URL:       session.URL,
+	})
+}
+
+func (h *Handler) CreatePortalSession(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		sendError(c, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	url, err := h.billingService.CreatePortalSession(c.Request.Context(), userID.(string))
+	if err != nil {
+		sendError(c, billingErrorStatus(err), err.Error())
+		return
+	}
+
+	sendSuccess(c, http.StatusOK, PortalResponse{URL: url})
+}
+
+// BillingWebhook receives Stripe events. It must see the raw body to verify
+// the signature, so it is registered outside the auth middleware.
+func (h *Handler) BillingWebhook(c *gin.Context) {
+	payload, err := c.GetRawData()
+	if err != nil {
+		sendError(c, http.StatusBadRequest, "Failed to read request body")
+		return
+	}
+
+	if err := h.billingService.HandleWebhook(payload, c.GetHeader("Stripe-Signature")); err != nil {
+		// Any non-2xx makes Stripe retry, which is what we want for
+		// processing errors but not for bad signatures.
+		sendError(c, billingErrorStatus(err), err.Error())
+		return
+	}
+
+	sendSuccess(c, http.StatusOK, gin.H{"received": true})
+}
+
+func billingErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrBillingNotConfigured):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, services.ErrInvalidSignature),
+		errors.Is(err, services.ErrPlanNotPurchasable),
+		errors.Is(err, services.ErrNoBillingAccount):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"ai-content-creation/models"
+	"ai-content-creation/services"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type BrandRequest struct {
+	Name        string   `json:"name" binding:"required,max=100"`
+	Industry    string   `json:"industry" binding:"max=100"`
+	Location    string   `json:"location" binding:"max=100"`
+	Audience    string   `json:"audience" binding:"max=500"`
+	ToneOfVoice string   `json:"tone_of_voice" binding:"max=500"`
+	BannedWords []string `json:"banned_words" binding:"max=50,dive,max=50"`
+	Hashtags    []string `json:"hashtags" binding:"max=30,dive,max=50"`
+	SamplePosts []string `json:"sample_posts" binding:"max=5,dive,max=2000"`
+}
+
+func (r *BrandRequest) input() services.BrandInput {
+	return services.BrandInput{
+		Name:        r.Name,
+		Industry:    r.Industry,
+		Location:    r.Location,
+		Audience:    r.Audience,
+		ToneOfVoice: r.ToneOfVoice,
+		BannedWords: r.BannedWords,
+		Hashtags:    r.Hashtags,
+		SamplePosts: r.SamplePosts,
+	}
+}
+
+type BrandResponse struct {
+	BrandID     string    `json:"brand_id"`
+	Name        string    `json:"name"`
+	Industry    string    `json:"industry"`
+	Location    string    `json:"location"`
+	Audience    string    `json:"audience"`
+	ToneOfVoice string    `json:"tone_of_voice"`
+	BannedWords []string  `json:"banned_words"`
+	Hashtags    []string  `json:"hashtags"`
+	SamplePosts []string  `json:"sample_posts"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+func (h *Handler) GetBrands(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		sendError(c, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	brands, err := h.brandService.GetBrands(userID.(string))
+	if err != nil {
+		sendError(c, http.StatusInternalServerError, "Failed to fetch brands")
+		return
+	}
+
+	response := []BrandResponse{}
+	for i := range brands {
+		response = append(response, newBrandResponse(&brands[i]))
+	}
+
+	sendSuccess(c, http.StatusOK, response)
+}
+
+func (h *Handler) CreateBrand(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		sendError(c, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var req BrandRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		sendError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	brand, err := h.brandService.CreateBrand(userID.(string), req.input())
+	if err != nil {
+		sendError(c, http.StatusInternalServerError, "Failed to create brand")
+		return
+	}
+
+	sendSuccess(c, http.StatusCreated, newBrandResponse(brand))
+}
+
+func (h *Handler) GetBrand(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		sendError(c, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	brand, err := h.brandService.GetBrand(userID.(string), c.Param("id"))
+	if err != nil {
+		sendBrandError(c, err, "Failed to fetch brand")
+		return
+	}
+
+	sendSuccess(c, http.StatusOK, newBrandResponse(brand))
+}
+
+// UpdateBrand replaces the brand's profile with the request body.
+func (h *Handler) UpdateBrand(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		sendError(c, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var req BrandRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		sendError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	brand, err := h.brandService.UpdateBrand(userID.(string), c.Param("id"), req.input())
+	if err != nil {
+		sendBrandError(c, err, "Failed to update brand")
+		return
+	}
+
+	sendSuccess(c, http.StatusOK, newBrandResponse(brand))
+}
+
+func (h *Handler) DeleteBrand(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		sendError(c, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	if err := h.brandService.DeleteBrand(userID.(string), c.Param("id")); err != nil {
+		sendBrandError(c, err, "Failed to delete brand")
+		return
+	}
+
+	sendSuccess(c, http.StatusOK, nil)
+}
+
+func sendBrandError(c *gin.Context, err error, message string) {
+	if errors.Is(err, services.ErrBrandNotFound) {
+		sendError(c, http.StatusNotFound, "Brand not found")
+		return
+	}
+	sendError(c, http.StatusInternalServerError, message)
+}
+
+func newBrandResponse(brand *models.Brand) BrandResponse {
+	bannedWords, _ := brand.GetBannedWords()
+	hashtags, _ := brand.GetHashtags()
+	samplePosts, _ := brand.GetSamplePosts()
+
+	return BrandResponse{
+		BrandID:     brand.BrandID,
+		Name:        brand.Name,
+		Industry:    brand.Industry,
+		Location:    brand.Location,
+		Audience:    brand.Audience,
+		ToneOfVoice: brand.ToneOfVoice,
+		BannedWords: bannedWords,
+		Hashtags:    hashtags,
+		SamplePosts: samplePosts,
+		CreatedAt:   brand.CreatedAt,
+		UpdatedAt:   brand.UpdatedAt,
+	}
+}
@@ -1,24 +1,112 @@
 package handlers
 
 import (
+	"ai-content-creation/models"
+	"ai-content-creation/services"
+	"errors"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
+// GenerateContentRequest takes either a prompt or a template_id with the
+// variables for its placeholders. Model may be left out when the template
+// has a default model. Platforms asks for one caption per platform, each
+// following that platform's conventions. Image tunes the image the captions
+// share, and TextOnly leaves it out.
 type GenerateContentRequest struct {
-	Model  string `json:"model" binding:"required"`
-	Prompt string `json:"prompt" binding:"required"`
+	Model      string              `json:"model"`
+	Prompt     string              `json:"prompt"`
+	TemplateID string              `json:"template_id"`
+	Variables  map[string]string   `json:"variables" binding:"max=20,dive,keys,max=50,endkeys,max=500"`
+	BrandID    string              `json:"brand_id"`  // optional brand profile to write for
+	Platforms  []string            `json:"platforms"` // instagram, x, facebook, linkedin or tiktok
+	Image      models.ImageOptions `json:"image"`
+	TextOnly   bool                `json:"text_only"`
+	NoCache    bool                `json:"no_cache"` // skip the response cache
+}
+
+// options builds the generation options, in the workspace of the route if
+// there is one.
+func (r *GenerateContentRequest) options(c *gin.Context) services.GenerateOptions {
+	return services.GenerateOptions{
+		WorkspaceID: c.GetString("workspaceID"),
+		Model:       r.Model,
+		Prompt:      r.Prompt,
+		TemplateID:  r.TemplateID,
+		Variables:   r.Variables,
+		BrandID:     r.BrandID,
+		Platforms:   r.Platforms,
+		Image:       r.Image,
+		TextOnly:    r.TextOnly,
+		NoCache:     r.NoCache,
+	}
 }
 
 type ContentResponse struct {
 	ContentID string `json:"content_id"`
 	RequestID string `json:"request_id"`
+	Platform  string `json:"platform,omitempty"`
 	Output    string `json:"output"`
 	ImageURL  string `json:"image_url"`
-	Version   int    `json:"version"`
+	// Derivatives are resized copies of the image, by name: thumbnail,
+	// square (1080x1080), story (1080x1920) and link_card (1200x628)
+	Derivatives map[string]ImageResponse `json:"derivatives,omitempty"`
+	Version     int                      `json:"version"`
+	Cached      bool                     `json:"cached"` // served from the response cache
+}
+
+type ImageResponse struct {
+	URL    string `json:"url"`
+	Format string `json:"format"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+}
+
+type RegenerateRequest struct {
+	Prompt string `json:"prompt"`
+	Model  string `json:"model"`
 }
 
+type ContentVersionResponse struct {
+	ContentResponse
+	Prompt    string            `json:"prompt"`
+	Model     string            `json:"model"`
+	CreatedAt time.Time         `json:"created_at"`
+	Changes   []services.DiffOp `json:"changes,omitempty"` // word diff from the previous version
+}
+
+type ContentRequestResponse struct {
+	RequestID   string               `json:"request_id"`
+	WorkspaceID string               `json:"workspace_id,omitempty"`
+	Model       string               `json:"model"`
+	Prompt      string               `json:"prompt"`
+	BrandID     string               `json:"brand_id,omitempty"`
+	TemplateID  string               `json:"template_id,omitempty"`
+	Variables   map[string]string    `json:"variables,omitempty"`
+	Platforms   []string             `json:"platforms,omitempty"`
+	Image       *models.ImageOptions `json:"image,omitempty"` // image options, with an aspect ratio resolved to a size
+	TextOnly    bool                 `json:"text_only,omitempty"`
+	Status      string               `json:"status"`
+	Error       string               `json:"error,omitempty"`
+	CreatedAt   time.Time            `json:"created_at"`
+	StartedAt   *time.Time           `json:"started_at,omitempty"`
+	CompletedAt *time.Time           `json:"completed_at,omitempty"`
+	Usage       UsageTokens          `json:"usage"`
+	Content     *ContentResponse     `json:"content,omitempty"`  // requests without platforms
+	Variants    []ContentResponse    `json:"variants,omitempty"` // one per platform, in request order
+}
+
+type UsageTokens struct {
+	PromptTokens     int  `json:"prompt_tokens"`
+	CompletionTokens int  `json:"completion_tokens"`
+	Estimated        bool `json:"estimated,omitempty"`
+}
+
+// GenerateContent queues a generation request and returns immediately with
+// 202 Accepted. Poll GET /requests/:id for the result. Cache hits are
+// answered with 200 and the content straight away.
 func (h *Handler) GenerateContent(c *gin.Context) {
 	userID, exists := c.Get("userID")
 	if !exists {
@@ -32,19 +120,107 @@ func (h *Handler) GenerateContent(c *gin.Context) {
 		return
 	}
 
-	content, err := h.contentService.Generate(c, userID.(string), req.Model, req.Prompt)
+	contentReq, contents, err := h.contentService.Enqueue(userID.(string), req.options(c))
 	if err != nil {
-		sendError(c, http.StatusInternalServerError, err.Error())
+		sendError(c, generationErrorStatus(err), err.Error())
 		return
 	}
 
-	sendSuccess(c, http.StatusOK, ContentResponse{
-		ContentID: content.ContentID,
-		RequestID: content.RequestID,
-		Output:    content.Output,
-		ImageURL:  content.ImageURL,
-		Version:   content.Version,
+	// Cache hits are already complete
+	if contents != nil {
+		sendSuccess(c, http.StatusOK, newContentRequestResponse(contentReq, contents))
+		return
+	}
+
+	sendSuccess(c, http.StatusAccepted, newContentRequestResponse(contentReq, nil))
+}
+
+// GetRequest reports the status of a generation request and, once it has
+// completed, its content.
+func (h *Handler) GetRequest(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		sendError(c, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	contentReq, contents, err := h.contentService.GetRequest(contentScope(c, userID.(string)), c.Param("id"))
+	if err != nil {
+		if errors.Is(err, services.ErrRequestNotFound) {
+			sendError(c, http.StatusNotFound, "Request not found")
+			return
+		}
+		sendError(c, http.StatusInternalServerError, "Failed to fetch request")
+		return
+	}
+
+	sendSuccess(c, http.StatusOK, newContentRequestResponse(contentReq, contents))
+}
+
+func (h *Handler) CancelRequest(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		sendError(c, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	contentReq, err := h.contentService.CancelRequest(contentScope(c, userID.(string)), c.Param("id"))
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrRequestNotFound):
+			sendError(c, http.StatusNotFound, "Request not found")
+		case errors.Is(err, services.ErrRequestNotCancellable):
+			sendError(c, http.StatusConflict, err.Error())
+		default:
+			sendError(c, http.StatusInternalServerError, "Failed to cancel request")
+		}
+		return
+	}
+
+	sendSuccess(c, http.StatusOK, newContentRequestResponse(contentReq, nil))
+}
+
+// GenerateContentStream relays generated text as Server-Sent Events.
+// Clients receive "token" events while the model is writing, then a single
+// "done" event carrying the stored content, or an "error" event.
+func (h *Handler) GenerateContentStream(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		sendError(c, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var req GenerateContentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		sendError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+
+	started := false
+	content, err := h.contentService.GenerateStream(c.Request.Context(), userID.(string), req.options(c), func(token string) error {
+		started = true
+		c.SSEvent("token", gin.H{"token": token})
+		c.Writer.Flush()
+		return nil
 	})
+	if err != nil {
+		// Nothing has been written yet, so we can still reply with a
+		// normal JSON error and status code.
+		if !started {
+			sendError(c, generationErrorStatus(err), err.Error())
+			return
+		}
+		c.SSEvent("error", gin.H{"error": err.Error()})
+		c.Writer.Flush()
+		return
+	}
+
+	c.SSEvent("done", newContentResponse(content))
+	c.Writer.Flush()
 }
 
 func (h *Handler) GetContent(c *gin.Context) {
@@ -54,20 +230,15 @@ func (h *Handler) GetContent(c *gin.Context) {
 		return
 	}
 
-	content, err := h.contentService.GetUserContent(userID.(string))
+	content, err := h.contentService.GetContent(contentScope(c, userID.(string)))
 	if err != nil {
 		sendError(c, http.StatusInternalServerError, "Failed to fetch content")
 		return
 	}
 
 	var response []ContentResponse
-	for _, c := range content {
-		response = append(response, ContentResponse{
-			ContentID: c.ContentID,
-			RequestID: c.RequestID,
-			Output:    c.Output,
-			Version:   c.Version,
-		})
+	for i := range content {
+		response = append(response, newContentResponse(&content[i]))
 	}
 
 	sendSuccess(c, http.StatusOK, response)
@@ -81,16 +252,179 @@ func (h *Handler) GetContentByID(c *gin.Context) {
 	}
 
 	contentID := c.Param("id")
-	content, err := h.contentService.GetContentByID(userID.(string), contentID)
+	content, err := h.contentService.GetContentByID(contentScope(c, userID.(string)), contentID)
 	if err != nil {
 		sendError(c, http.StatusNotFound, "Content not found")
 		return
 	}
 
-	sendSuccess(c, http.StatusOK, ContentResponse{
+	sendSuccess(c, http.StatusOK, newContentResponse(content))
+}
+
+// RegenerateContent queues a new version of the content's request, optionally
+// with a different prompt or model. Like GenerateContent it returns 202 and
+// the request to poll.
+func (h *Handler) RegenerateContent(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		sendError(c, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var req RegenerateRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			sendError(c, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	contentReq, err := h.contentService.Regenerate(contentScope(c, userID.(string)), c.Param("id"), req.Prompt, req.Model)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrContentNotFound):
+			sendError(c, http.StatusNotFound, "Content not found")
+		case errors.Is(err, services.ErrRequestInProgress):
+			sendError(c, http.StatusConflict, err.Error())
+		default:
+			sendError(c, generationErrorStatus(err), err.Error())
+		}
+		return
+	}
+
+	sendSuccess(c, http.StatusAccepted, newContentRequestResponse(contentReq, nil))
+}
+
+// GetContentVersions lists every version of the content's request, oldest
+// first, each with a word diff against the version before it.
+func (h *Handler) GetContentVersions(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		sendError(c, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	versions, err := h.contentService.GetVersions(contentScope(c, userID.(string)), c.Param("id"))
+	if err != nil {
+		if errors.Is(err, services.ErrContentNotFound) {
+			sendError(c, http.StatusNotFound, "Content not found")
+			return
+		}
+		sendError(c, http.StatusInternalServerError, "Failed to fetch versions")
+		return
+	}
+
+	response := []ContentVersionResponse{}
+	for i := range versions {
+		version := ContentVersionResponse{
+			ContentResponse: newContentResponse(&versions[i]),
+			Prompt:          versions[i].Prompt,
+			Model:           versions[i].AIModel,
+			CreatedAt:       versions[i].CreatedAt,
+		}
+		if i > 0 {
+			version.Changes = services.DiffWords(versions[i-1].Output, versions[i].Output)
+		}
+		response = append(response, version)
+	}
+
+	sendSuccess(c, http.StatusOK, response)
+}
+
+// contentScope is the content a route works on: the workspace's under
+// /workspaces/:workspace, otherwise the user's personal content.
+func contentScope(c *gin.Context, userID string) services.ContentScope {
+	return services.ContentScope{UserID: userID, WorkspaceID: c.GetString("workspaceID")}
+}
+
+// generationErrorStatus maps errors from starting a generation to a status code.
+func generationErrorStatus(err error) int {
+	var unknownModel *services.UnknownModelError
+	var modelNotAllowed *services.ModelNotAllowedError
+	var templateVariables *services.TemplateVariablesError
+	var unknownPlatform *services.UnknownPlatformError
+	var imageOption *services.ImageOptionError
+
+	switch {
+	case errors.As(err, &unknownModel), errors.As(err, &templateVariables), errors.As(err, &unknownPlatform),
+		errors.As(err, &imageOption):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrModelRequired), errors.Is(err, services.ErrPromptRequired),
+		errors.Is(err, services.ErrPromptWithTemplate), errors.Is(err, services.ErrTooManyPlatforms),
+		errors.Is(err, services.ErrStreamPlatforms), errors.Is(err, services.ErrImageOptionsTextOnly):
+		return http.StatusBadRequest
+	case errors.As(err, &modelNotAllowed):
+		return http.StatusForbidden
+	case errors.Is(err, services.ErrBrandNotFound), errors.Is(err, services.ErrTemplateNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrInsufficientCredits), errors.Is(err, services.ErrTokenQuotaExceeded):
+		return http.StatusPaymentRequired
+	case errors.Is(err, services.ErrQueueFull):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func newContentResponse(content *models.GeneratedContent) ContentResponse {
+	response := ContentResponse{
 		ContentID: content.ContentID,
 		RequestID: content.RequestID,
+		Platform:  content.Platform,
 		Output:    content.Output,
+		ImageURL:  content.ImageURL,
 		Version:   content.Version,
-	})
+		Cached:    content.CachedFrom != "",
+	}
+	for _, derivative := range content.Derivatives {
+		if response.Derivatives == nil {
+			response.Derivatives = make(map[string]ImageResponse)
+		}
+		response.Derivatives[derivative.Derivative] = ImageResponse{
+			URL:    derivative.URL,
+			Format: derivative.Format,
+			Width:  derivative.Width,
+			Height: derivative.Height,
+		}
+	}
+	return response
+}
+
+func newContentRequestResponse(contentReq *models.ContentRequest, contents []models.GeneratedContent) ContentRequestResponse {
+	response := ContentRequestResponse{
+		RequestID:   contentReq.RequestID,
+		WorkspaceID: contentReq.WorkspaceID,
+		Model:       contentReq.AIModel,
+		Prompt:      contentReq.Prompt,
+		BrandID:     contentReq.BrandID,
+		TemplateID:  contentReq.TemplateID,
+		Status:      string(contentReq.Status),
+		Error:       contentReq.Error,
+		CreatedAt:   contentReq.CreatedAt,
+		StartedAt:   contentReq.StartedAt,
+		CompletedAt: contentReq.CompletedAt,
+		Usage: UsageTokens{
+			PromptTokens:     contentReq.PromptTokens,
+			CompletionTokens: contentReq.CompletionTokens,
+			Estimated:        contentReq.TokensEstimated,
+		},
+	}
+	// Variables and platforms were validated before they were stored
+	response.Variables, _ = contentReq.GetVariables()
+	response.Platforms, _ = contentReq.GetPlatforms()
+	if contentReq.ImageOptions != "" {
+		imageOptions, _ := contentReq.GetImageOptions()
+		response.Image = &imageOptions
+	}
+	response.TextOnly = contentReq.TextOnly
+
+	for i := range contents {
+		contentResponse := newContentResponse(&contents[i])
+		if len(response.Platforms) == 0 {
+			response.Content = &contentResponse
+		} else {
+			response.Variants = append(response.Variants, contentResponse)
+		}
+	}
+	return response
 }
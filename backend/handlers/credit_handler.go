@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"ai-content-creation/models"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CreditTransactionResponse struct {
+	TransactionID string    `json:"transaction_id"`
+	UserID        string    `json:"user_id"` // the member who caused it, for workspace pools
+	RequestID     string    `json:"request_id,omitempty"`
+	Type          string    `json:"type"`
+	Amount        int       `json:"amount"`
+	BalanceAfter  int       `json:"balance_after"`
+	Reason        string    `json:"reason,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+type CreditHistoryResponse struct {
+	Balance      int                         `json:"balance"`
+	ResetsAt     *time.Time                  `json:"resets_at,omitempty"`
+	Transactions []CreditTransactionResponse `json:"transactions"`
+}
+
+// GetCreditHistory returns the user's balance and ledger, newest first.
+// Supports ?limit= (default 50, max 200) and ?offset= for paging.
+func (h *Handler) GetCreditHistory(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		sendError(c, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	limit, offset, ok := pageParams(c)
+	if !ok {
+		return
+	}
+
+	user, err := h.creditService.GetBalance(userID.(string))
+	if err != nil {
+		sendError(c, http.StatusInternalServerError, "Failed to fetch credit balance")
+		return
+	}
+
+	transactions, err := h.creditService.GetHistory(userID.(string), limit, offset)
+	if err != nil {
+		sendError(c, http.StatusInternalServerError, "Failed to fetch credit history")
+		return
+	}
+
+	sendSuccess(c, http.StatusOK, CreditHistoryResponse{
+		Balance:      user.RemainingCredits,
+		ResetsAt:     user.CreditsResetAt,
+		Transactions: newCreditTransactionResponses(transactions),
+	})
+}
+
+// pageParams reads ?limit= (default 50, max 200) and ?offset=, replying with
+// 400 and returning false if either is invalid.
+func pageParams(c *gin.Context) (int, int, bool) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit < 1 || limit > 200 {
+		sendError(c, http.StatusBadRequest, "limit must be between 1 and 200")
+		return 0, 0, false
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		sendError(c, http.StatusBadRequest, "offset must be a non-negative integer")
+		return 0, 0, false
+	}
+	return limit, offset, true
+}
+
+func newCreditTransactionResponses(transactions []models.CreditTransaction) []CreditTransactionResponse {
+	response := []CreditTransactionResponse{}
+	for _, t := range transactions {
+		response = append(response, CreditTransactionResponse{
+			TransactionID: t.TransactionID,
+			UserID:        t.UserID,
+			RequestID:     t.RequestID,
+			Type:          string(t.Type),
+			Amount:        t.Amount,
+			BalanceAfter:  t.BalanceAfter,
+			Reason:        t.Reason,
+			CreatedAt:     t.CreatedAt,
+		})
+	}
+	return response
+}
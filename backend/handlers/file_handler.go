@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"ai-content-creation/services"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetFile serves a file kept by the local storage backend to the holder of a
+// signed URL. S3 files are fetched from the bucket directly.
+func (h *Handler) GetFile(c *gin.Context) {
+	local, ok := h.storage.(*services.LocalStorage)
+	if !ok {
+		sendError(c, http.StatusNotFound, "File not found")
+		return
+	}
+
+	key := strings.TrimPrefix(c.Param("key"), "/")
+	if err := local.Verify(key, c.Query("expires"), c.Query("signature")); err != nil {
+		sendError(c, http.StatusForbidden, "Invalid or expired link")
+		return
+	}
+
+	object, err := local.Get(c.Request.Context(), key)
+	if err != nil {
+		if errors.Is(err, services.ErrObjectNotFound) {
+			sendError(c, http.StatusNotFound, "File not found")
+			return
+		}
+		sendError(c, http.StatusInternalServerError, "Failed to fetch file")
+		return
+	}
+	defer object.Body.Close()
+
+	// Browsers may keep the file until the link expires; shared caches
+	// mustn't keep it at all
+	expires, _ := strconv.ParseInt(c.Query("expires"), 10, 64)
+	c.Header("Cache-Control", fmt.Sprintf("private, max-age=%d", expires-time.Now().Unix()))
+	c.DataFromReader(http.StatusOK, object.Size, object.ContentType, object.Body, nil)
+}
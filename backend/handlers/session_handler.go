@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"ai-content-creation/services"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SessionResponse struct {
+	SessionID  string     `json:"session_id"`
+	IP         string     `json:"ip"`
+	UserAgent  string     `json:"user_agent"`
+	SignedInAt time.Time  `json:"signed_in_at"`
+	LastUsedAt time.Time  `json:"last_used_at"` // when its refresh token was last used
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	Active     bool       `json:"active"`
+	Current    bool       `json:"current"` // the session making this request
+}
+
+// GetSessions lists the user's recent sign-ins.
+func (h *Handler) GetSessions(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		sendError(c, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	sessions, err := h.authService.GetSessions(userID.(string))
+	if err != nil {
+		sendError(c, http.StatusInternalServerError, "Failed to fetch sessions")
+		return
+	}
+
+	response := []SessionResponse{}
+	for _, session := range sessions {
+		response = append(response, SessionResponse{
+			SessionID:  session.SessionID,
+			IP:         session.IP,
+			UserAgent:  session.UserAgent,
+			SignedInAt: session.CreatedAt,
+			LastUsedAt: session.LastUsedAt,
+			RevokedAt:  session.RevokedAt,
+			Active:     session.Active,
+			Current:    session.SessionID == c.GetString("sessionID"),
+		})
+	}
+
+	sendSuccess(c, http.StatusOK, response)
+}
+
+// RevokeSession signs one of the user's sessions out. Its access tokens stop
+// working immediately.
+func (h *Handler) RevokeSession(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		sendError(c, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	if err := h.authService.RevokeSession(userID.(string), c.Param("id")); err != nil {
+		if errors.Is(err, services.ErrSessionNotFound) {
+			sendError(c, http.StatusNotFound, "Session not found")
+			return
+		}
+		sendError(c, http.StatusInternalServerError, "Failed to revoke session")
+		return
+	}
+
+	sendSuccess(c, http.StatusOK, nil)
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"ai-content-creation/models"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -12,6 +13,7 @@ type SubscriptionPlanResponse struct {
 	Name            string   `json:"name"`
 	Price           float64  `json:"price"`
 	TokensPerMonth  int      `json:"tokens_per_month"`
+	MonthlyCredits  int      `json:"monthly_credits"`
 	ModelsAvailable []string `json:"models_available"`
 }
 
@@ -23,22 +25,31 @@ func (h *Handler) GetSubscriptionPlans(c *gin.Context) {
 	}
 
 	var response []SubscriptionPlanResponse
-	for _, plan := range plans {
-		models, err := plan.GetModelsAvailable()
+	for i := range plans {
+		planResponse, err := newSubscriptionPlanResponse(&plans[i])
 		if err != nil {
 			sendError(c, http.StatusInternalServerError, "Failed to parse models available")
 			return
 		}
-
-		response = append(response, SubscriptionPlanResponse{
-			PlanID:          plan.PlanID,
-			Tier:            string(plan.Tier),
-			Name:            plan.Name,
-			Price:           plan.Price,
-			TokensPerMonth:  plan.TokensPerMonth,
-			ModelsAvailable: models,
-		})
+		response = append(response, planResponse)
 	}
 
 	sendSuccess(c, http.StatusOK, response)
-} 
+}
+
+func newSubscriptionPlanResponse(plan *models.SubscriptionPlan) (SubscriptionPlanResponse, error) {
+	modelIDs, err := plan.GetModelsAvailable()
+	if err != nil {
+		return SubscriptionPlanResponse{}, err
+	}
+
+	return SubscriptionPlanResponse{
+		PlanID:          plan.PlanID,
+		Tier:            string(plan.Tier),
+		Name:            plan.Name,
+		Price:           plan.Price,
+		TokensPerMonth:  plan.TokensPerMonth,
+		MonthlyCredits:  plan.MonthlyCredits,
+		ModelsAvailable: modelIDs,
+	}, nil
+}
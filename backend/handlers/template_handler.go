@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"ai-content-creation/models"
+	"ai-content-creation/services"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type TemplateRequest struct {
+	Name         string `json:"name" binding:"required,max=100"`
+	SystemPrompt string `json:"system_prompt" binding:"max=4000"`
+	UserPrompt   string `json:"user_prompt" binding:"required,max=4000"`
+	DefaultModel string `json:"default_model"`
+}
+
+func (r *TemplateRequest) input() services.TemplateInput {
+	return services.TemplateInput{
+		Name:         r.Name,
+		SystemPrompt: r.SystemPrompt,
+		UserPrompt:   r.UserPrompt,
+		DefaultModel: r.DefaultModel,
+	}
+}
+
+type TemplateResponse struct {
+	TemplateID   string    `json:"template_id"`
+	Name         string    `json:"name"`
+	SystemPrompt string    `json:"system_prompt"`
+	UserPrompt   string    `json:"user_prompt"`
+	DefaultModel string    `json:"default_model"`
+	Variables    []string  `json:"variables"` // placeholder names a generation must fill in
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+func (h *Handler) GetTemplates(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		sendError(c, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	templates, err := h.templateService.GetTemplates(userID.(string))
+	if err != nil {
+		sendError(c, http.StatusInternalServerError, "Failed to fetch templates")
+		return
+	}
+
+	response := []TemplateResponse{}
+	for i := range templates {
+		response = append(response, newTemplateResponse(&templates[i]))
+	}
+
+	sendSuccess(c, http.StatusOK, response)
+}
+
+func (h *Handler) CreateTemplate(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		sendError(c, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var req TemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		sendError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	template, err := h.templateService.CreateTemplate(userID.(string), req.input())
+	if err != nil {
+		sendTemplateError(c, err, "Failed to create template")
+		return
+	}
+
+	sendSuccess(c, http.StatusCreated, newTemplateResponse(template))
+}
+
+func (h *Handler) GetTemplate(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		sendError(c, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	template, err := h.templateService.GetTemplate(userID.(string), c.Param("id"))
+	if err != nil {
+		sendTemplateError(c, err, "Failed to fetch template")
+		return
+	}
+
+	sendSuccess(c, http.StatusOK, newTemplateResponse(template))
+}
+
+// UpdateTemplate replaces the template with the request body.
+func (h *Handler) UpdateTemplate(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		sendError(c, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var req TemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		sendError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	template, err := h.templateService.UpdateTemplate(userID.(string), c.Param("id"), req.input())
+	if err != nil {
+		sendTemplateError(c, err, "Failed to update template")
+		return
+	}
+
+	sendSuccess(c, http.StatusOK, newTemplateResponse(template))
+}
+
+func (h *Handler) DeleteTemplate(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		sendError(c, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	if err := h.templateService.DeleteTemplate(userID.(string), c.Param("id")); err != nil {
+		sendTemplateError(c, err, "Failed to delete template")
+		return
+	}
+
+	sendSuccess(c, http.StatusOK, nil)
+}
+
+func sendTemplateError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, services.ErrTemplateNotFound):
+		sendError(c, http.StatusNotFound, "Template not found")
+	case errors.Is(err, services.ErrInvalidPlaceholder):
+		sendError(c, http.StatusBadRequest, err.Error())
+	default:
+		sendError(c, http.StatusInternalServerError, message)
+	}
+}
+
+func newTemplateResponse(template *models.PromptTemplate) TemplateResponse {
+	return TemplateResponse{
+		TemplateID:   template.TemplateID,
+		Name:         template.Name,
+		SystemPrompt: template.SystemPrompt,
+		UserPrompt:   template.UserPrompt,
+		DefaultModel: template.DefaultModel,
+		Variables:    services.TemplateVariables(template),
+		CreatedAt:    template.CreatedAt,
+		UpdatedAt:    template.UpdatedAt,
+	}
+}
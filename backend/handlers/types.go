@@ -19,6 +19,15 @@ type Handler struct {
 	userService         *services.UserService
 	contentService      *services.ContentService
 	subscriptionService *services.SubscriptionService
+	creditService       *services.CreditService
+	usageService        *services.UsageService
+	billingService      *services.BillingService
+	brandService        *services.BrandService
+	templateService     *services.TemplateService
+	workspaceService    *services.WorkspaceService
+	apiKeyService       *services.APIKeyService
+	adminService        *services.AdminService
+	storage             services.Storage
 }
 
 // NewHandler creates a new handler instance
@@ -27,12 +36,30 @@ func NewHandler(
 	userService *services.UserService,
 	contentService *services.ContentService,
 	subscriptionService *services.SubscriptionService,
+	creditService *services.CreditService,
+	usageService *services.UsageService,
+	billingService *services.BillingService,
+	brandService *services.BrandService,
+	templateService *services.TemplateService,
+	workspaceService *services.WorkspaceService,
+	apiKeyService *services.APIKeyService,
+	adminService *services.AdminService,
+	storage services.Storage,
 ) *Handler {
 	return &Handler{
 		authService:         authService,
 		userService:         userService,
 		contentService:      contentService,
 		subscriptionService: subscriptionService,
+		creditService:       creditService,
+		usageService:        usageService,
+		billingService:      billingService,
+		brandService:        brandService,
+		templateService:     templateService,
+		workspaceService:    workspaceService,
+		apiKeyService:       apiKeyService,
+		adminService:        adminService,
+		storage:             storage,
 	}
 }
 
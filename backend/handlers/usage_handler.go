@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// UsageResponse reports token usage for the current period. TokensLimit and
+// TokensRemaining are -1 on unlimited plans.
+type UsageResponse struct {
+	PeriodStart      time.Time `json:"period_start"`
+	ResetsAt         time.Time `json:"resets_at"`
+	Requests         int       `json:"requests"`
+	PromptTokens     int       `json:"prompt_tokens"`
+	CompletionTokens int       `json:"completion_tokens"`
+	TokensUsed       int       `json:"tokens_used"`
+	TokensLimit      int       `json:"tokens_limit"`
+	TokensRemaining  int       `json:"tokens_remaining"`
+}
+
+func (h *Handler) GetUsage(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		sendError(c, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	usage, err := h.usageService.GetUsage(userID.(string))
+	if err != nil {
+		sendError(c, http.StatusInternalServerError, "Failed to fetch usage")
+		return
+	}
+
+	sendSuccess(c, http.StatusOK, UsageResponse{
+		PeriodStart:      usage.PeriodStart,
+		ResetsAt:         usage.ResetsAt,
+		Requests:         usage.Requests,
+		PromptTokens:     usage.PromptTokens,
+		CompletionTokens: usage.CompletionTokens,
+		TokensUsed:       usage.TokensUsed,
+		TokensLimit:      usage.TokensLimit,
+		TokensRemaining:  usage.TokensRemaining,
+	})
+}
@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"ai-content-creation/models"
+	"ai-content-creation/services"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type UpdateProfileRequest struct {
+	Name     *string `json:"name" binding:"omitempty,max=100"`
+	Email    *string `json:"email" binding:"omitempty,email"`
+	Password string  `json:"password"` // current password, required to change the email
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required,min=6"`
+}
+
+type DeleteAccountRequest struct {
+	Password string `json:"password" binding:"required"`
+}
+
+type ProfileResponse struct {
+	ID               string                  `json:"id"`
+	Name             string                  `json:"name"`
+	Email            string                  `json:"email"`
+	EmailVerified    bool                    `json:"email_verified"`
+	SubscriptionTier models.SubscriptionTier `json:"subscription_tier"`
+	RemainingCredits int                     `json:"remaining_credits"`
+	CreditsResetAt   *time.Time              `json:"credits_reset_at,omitempty"`
+	CreatedAt        time.Time               `json:"created_at"`
+}
+
+func (h *Handler) GetProfile(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		sendError(c, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	user, err := h.userService.GetUser(userID.(string))
+	if err != nil {
+		sendUserError(c, err, "Failed to fetch profile")
+		return
+	}
+
+	sendSuccess(c, http.StatusOK, newProfileResponse(user))
+}
+
+// UpdateProfile changes the user's name or email. A new email must be
+// verified again.
+func (h *Handler) UpdateProfile(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		sendError(c, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var req UpdateProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		sendError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	user, err := h.userService.UpdateProfile(userID.(string), services.ProfileUpdate{
+		Name:     req.Name,
+		Email:    req.Email,
+		Password: req.Password,
+	})
+	if err != nil {
+		sendUserError(c, err, "Failed to update profile")
+		return
+	}
+
+	sendSuccess(c, http.StatusOK, newProfileResponse(user))
+}
+
+// ChangePassword sets a new password and signs out every other session.
+func (h *Handler) ChangePassword(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		sendError(c, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var req ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		sendError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := h.userService.ChangePassword(userID.(string), c.GetString("sessionID"), req.CurrentPassword, req.NewPassword); err != nil {
+		sendUserError(c, err, "Failed to change password")
+		return
+	}
+
+	sendSuccess(c, http.StatusOK, nil)
+}
+
+// DeleteAccount permanently deletes the user, their content and images.
+func (h *Handler) DeleteAccount(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		sendError(c, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var req DeleteAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		sendError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := h.userService.DeleteUser(userID.(string), req.Password); err != nil {
+		sendUserError(c, err, "Failed to delete account")
+		return
+	}
+
+	sendSuccess(c, http.StatusOK, nil)
+}
+
+func sendUserError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, services.ErrUserNotFound):
+		sendError(c, http.StatusNotFound, "User not found")
+	case errors.Is(err, services.ErrInvalidName):
+		sendError(c, http.StatusBadRequest, err.Error())
+	case errors.Is(err, services.ErrIncorrectPassword):
+		sendError(c, http.StatusForbidden, err.Error())
+	case errors.Is(err, services.ErrEmailTaken),
+		errors.Is(err, services.ErrActiveSubscription),
+		errors.Is(err, services.ErrSharedWorkspace):
+		sendError(c, http.StatusConflict, err.Error())
+	default:
+		sendError(c, http.StatusInternalServerError, message)
+	}
+}
+
+func newProfileResponse(user *models.User) ProfileResponse {
+	return ProfileResponse{
+		ID:               user.UserID,
+		Name:             user.Name,
+		Email:            user.Email,
+		EmailVerified:    user.EmailVerifiedAt != nil,
+		SubscriptionTier: user.SubscriptionTier,
+		RemainingCredits: user.RemainingCredits,
+		CreditsResetAt:   user.CreditsResetAt,
+		CreatedAt:        user.CreatedAt,
+	}
+}
@@ -0,0 +1,381 @@
+package handlers
+
+import (
+	"ai-content-creation/models"
+	"ai-content-creation/services"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type WorkspaceRequest struct {
+	Name string `json:"name" binding:"required,max=100"`
+}
+
+type MemberRoleRequest struct {
+	Role models.WorkspaceRole `json:"role" binding:"required"`
+}
+
+type InvitationRequest struct {
+	Email string               `json:"email" binding:"required,email"`
+	Role  models.WorkspaceRole `json:"role" binding:"required"`
+}
+
+type AcceptInvitationRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+type WorkspaceCreditsRequest struct {
+	Amount int `json:"amount" binding:"required,min=1"`
+}
+
+type WorkspaceResponse struct {
+	WorkspaceID string    `json:"workspace_id"`
+	Name        string    `json:"name"`
+	OwnerID     string    `json:"owner_id"`
+	Role        string    `json:"role"`    // the current user's role
+	Credits     int       `json:"credits"` // remaining in the shared pool
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type MemberResponse struct {
+	UserID   string    `json:"user_id"`
+	Name     string    `json:"name"`
+	Email    string    `json:"email"`
+	Role     string    `json:"role"`
+	JoinedAt time.Time `json:"joined_at"`
+}
+
+type InvitationResponse struct {
+	InvitationID string    `json:"invitation_id"`
+	Email        string    `json:"email"`
+	Role         string    `json:"role"`
+	InvitedBy    string    `json:"invited_by"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+type WorkspaceCreditsResponse struct {
+	Balance      int                         `json:"balance"`
+	Transactions []CreditTransactionResponse `json:"transactions"`
+}
+
+func (h *Handler) GetWorkspaces(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		sendError(c, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	workspaces, err := h.workspaceService.GetWorkspaces(userID.(string))
+	if err != nil {
+		sendError(c, http.StatusInternalServerError, "Failed to fetch workspaces")
+		return
+	}
+
+	response := []WorkspaceResponse{}
+	for i := range workspaces {
+		response = append(response, newWorkspaceResponse(&workspaces[i].Workspace, workspaces[i].Role))
+	}
+
+	sendSuccess(c, http.StatusOK, response)
+}
+
+// CreateWorkspace creates a workspace with the current user as its owner.
+func (h *Handler) CreateWorkspace(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		sendError(c, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var req WorkspaceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		sendError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	workspace, err := h.workspaceService.CreateWorkspace(userID.(string), req.Name)
+	if err != nil {
+		sendWorkspaceError(c, err, "Failed to create workspace")
+		return
+	}
+
+	sendSuccess(c, http.StatusCreated, newWorkspaceResponse(workspace, models.WorkspaceOwner))
+}
+
+func (h *Handler) GetWorkspace(c *gin.Context) {
+	workspace, err := h.workspaceService.GetWorkspace(c.GetString("workspaceID"))
+	if err != nil {
+		sendWorkspaceError(c, err, "Failed to fetch workspace")
+		return
+	}
+
+	sendSuccess(c, http.StatusOK, newWorkspaceResponse(workspace, workspaceRole(c)))
+}
+
+func (h *Handler) UpdateWorkspace(c *gin.Context) {
+	var req WorkspaceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		sendError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	workspace, err := h.workspaceService.RenameWorkspace(c.GetString("workspaceID"), req.Name)
+	if err != nil {
+		sendWorkspaceError(c, err, "Failed to update workspace")
+		return
+	}
+
+	sendSuccess(c, http.StatusOK, newWorkspaceResponse(workspace, workspaceRole(c)))
+}
+
+func (h *Handler) GetWorkspaceMembers(c *gin.Context) {
+	members, err := h.workspaceService.GetMembers(c.GetString("workspaceID"))
+	if err != nil {
+		sendError(c, http.StatusInternalServerError, "Failed to fetch members")
+		return
+	}
+
+	response := []MemberResponse{}
+	for _, m := range members {
+		response = append(response, MemberResponse{
+			UserID:   m.UserID,
+			Name:     m.Name,
+			Email:    m.Email,
+			Role:     string(m.Role),
+			JoinedAt: m.JoinedAt,
+		})
+	}
+
+	sendSuccess(c, http.StatusOK, response)
+}
+
+func (h *Handler) UpdateWorkspaceMember(c *gin.Context) {
+	var req MemberRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		sendError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if _, err := h.workspaceService.UpdateMemberRole(c.GetString("workspaceID"), c.Param("member"), req.Role); err != nil {
+		sendWorkspaceError(c, err, "Failed to update member")
+		return
+	}
+
+	sendSuccess(c, http.StatusOK, nil)
+}
+
+func (h *Handler) RemoveWorkspaceMember(c *gin.Context) {
+	if err := h.workspaceService.RemoveMember(c.GetString("workspaceID"), c.Param("member")); err != nil {
+		sendWorkspaceError(c, err, "Failed to remove member")
+		return
+	}
+
+	sendSuccess(c, http.StatusOK, nil)
+}
+
+// LeaveWorkspace removes the current user from the workspace. The owner
+// can't leave.
+func (h *Handler) LeaveWorkspace(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		sendError(c, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	if err := h.workspaceService.RemoveMember(c.GetString("workspaceID"), userID.(string)); err != nil {
+		sendWorkspaceError(c, err, "Failed to leave workspace")
+		return
+	}
+
+	sendSuccess(c, http.StatusOK, nil)
+}
+
+func (h *Handler) GetWorkspaceInvitations(c *gin.Context) {
+	invitations, err := h.workspaceService.GetInvitations(c.GetString("workspaceID"))
+	if err != nil {
+		sendError(c, http.StatusInternalServerError, "Failed to fetch invitations")
+		return
+	}
+
+	response := []InvitationResponse{}
+	for i := range invitations {
+		response = append(response, newInvitationResponse(&invitations[i]))
+	}
+
+	sendSuccess(c, http.StatusOK, response)
+}
+
+// CreateWorkspaceInvitation emails an invitation to join the workspace.
+// Inviting an address again replaces its pending invitation.
+func (h *Handler) CreateWorkspaceInvitation(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		sendError(c, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var req InvitationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		sendError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	invitation, err := h.workspaceService.Invite(c.GetString("workspaceID"), userID.(string), req.Email, req.Role)
+	if err != nil {
+		sendWorkspaceError(c, err, "Failed to send invitation")
+		return
+	}
+
+	sendSuccess(c, http.StatusCreated, newInvitationResponse(invitation))
+}
+
+func (h *Handler) RevokeWorkspaceInvitation(c *gin.Context) {
+	if err := h.workspaceService.RevokeInvitation(c.GetString("workspaceID"), c.Param("id")); err != nil {
+		sendWorkspaceError(c, err, "Failed to revoke invitation")
+		return
+	}
+
+	sendSuccess(c, http.StatusOK, nil)
+}
+
+// AcceptWorkspaceInvitation joins the workspace an emailed invitation token
+// is for. It must be accepted from the account with the invited address.
+func (h *Handler) AcceptWorkspaceInvitation(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		sendError(c, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var req AcceptInvitationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		sendError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	membership, err := h.workspaceService.AcceptInvitation(userID.(string), req.Token)
+	if err != nil {
+		sendWorkspaceError(c, err, "Failed to accept invitation")
+		return
+	}
+
+	workspace, err := h.workspaceService.GetWorkspace(membership.WorkspaceID)
+	if err != nil {
+		sendWorkspaceError(c, err, "Failed to fetch workspace")
+		return
+	}
+
+	sendSuccess(c, http.StatusOK, newWorkspaceResponse(workspace, membership.Role))
+}
+
+// GetWorkspaceCredits returns the workspace's credit pool and its ledger,
+// newest first. Supports ?limit= (default 50, max 200) and ?offset=.
+func (h *Handler) GetWorkspaceCredits(c *gin.Context) {
+	limit, offset, ok := pageParams(c)
+	if !ok {
+		return
+	}
+
+	workspace, err := h.workspaceService.GetWorkspace(c.GetString("workspaceID"))
+	if err != nil {
+		sendWorkspaceError(c, err, "Failed to fetch workspace")
+		return
+	}
+
+	transactions, err := h.creditService.GetWorkspaceHistory(workspace.WorkspaceID, limit, offset)
+	if err != nil {
+		sendError(c, http.StatusInternalServerError, "Failed to fetch credit history")
+		return
+	}
+
+	sendSuccess(c, http.StatusOK, WorkspaceCreditsResponse{
+		Balance:      workspace.RemainingCredits,
+		Transactions: newCreditTransactionResponses(transactions),
+	})
+}
+
+// AddWorkspaceCredits moves credits from the current user's own balance into
+// the workspace's pool.
+func (h *Handler) AddWorkspaceCredits(c *gin.Context) {
+	userID, exists := c.Get("userID")
+	if !exists {
+		sendError(c, http.StatusUnauthorized, "User not authenticated")
+		return
+	}
+
+	var req WorkspaceCreditsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		sendError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := h.creditService.Transfer(userID.(string), c.GetString("workspaceID"), req.Amount); err != nil {
+		if errors.Is(err, services.ErrInsufficientCredits) {
+			sendError(c, http.StatusPaymentRequired, "Not enough credits")
+			return
+		}
+		sendWorkspaceError(c, err, "Failed to transfer credits")
+		return
+	}
+
+	workspace, err := h.workspaceService.GetWorkspace(c.GetString("workspaceID"))
+	if err != nil {
+		sendWorkspaceError(c, err, "Failed to fetch workspace")
+		return
+	}
+
+	sendSuccess(c, http.StatusOK, newWorkspaceResponse(workspace, workspaceRole(c)))
+}
+
+// workspaceRole is the current user's role, set by RequireWorkspaceRole.
+func workspaceRole(c *gin.Context) models.WorkspaceRole {
+	role, _ := c.Get("workspaceRole")
+	r, _ := role.(models.WorkspaceRole)
+	return r
+}
+
+func sendWorkspaceError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, services.ErrWorkspaceNotFound):
+		sendError(c, http.StatusNotFound, "Workspace not found")
+	case errors.Is(err, services.ErrMemberNotFound):
+		sendError(c, http.StatusNotFound, "Member not found")
+	case errors.Is(err, services.ErrInvitationNotFound):
+		sendError(c, http.StatusNotFound, "Invitation not found")
+	case errors.Is(err, services.ErrInvalidRole), errors.Is(err, services.ErrInvalidInvitation),
+		errors.Is(err, services.ErrInvalidWorkspace):
+		sendError(c, http.StatusBadRequest, err.Error())
+	case errors.Is(err, services.ErrInvitationEmail), errors.Is(err, services.ErrWorkspaceOwner):
+		sendError(c, http.StatusForbidden, err.Error())
+	case errors.Is(err, services.ErrAlreadyMember):
+		sendError(c, http.StatusConflict, err.Error())
+	default:
+		sendError(c, http.StatusInternalServerError, message)
+	}
+}
+
+func newWorkspaceResponse(workspace *models.Workspace, role models.WorkspaceRole) WorkspaceResponse {
+	return WorkspaceResponse{
+		WorkspaceID: workspace.WorkspaceID,
+		Name:        workspace.Name,
+		OwnerID:     workspace.OwnerID,
+		Role:        string(role),
+		Credits:     workspace.RemainingCredits,
+		CreatedAt:   workspace.CreatedAt,
+	}
+}
+
+func newInvitationResponse(invitation *models.WorkspaceInvitation) InvitationResponse {
+	return InvitationResponse{
+		InvitationID: invitation.InvitationID,
+		Email:        invitation.Email,
+		Role:         string(invitation.Role),
+		InvitedBy:    invitation.InvitedBy,
+		ExpiresAt:    invitation.ExpiresAt,
+		CreatedAt:    invitation.CreatedAt,
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"strings"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -33,27 +34,78 @@ func main() {
 	}
 
 	// Initialize services
-	authService := services.NewAuthService(db)
-	userService := services.NewUserService(db)
-	contentService := services.NewContentService(db)
+	aiService, err := services.NewAIService()
+	if err != nil {
+		log.Fatal("Failed to configure AI providers:", err)
+	}
+
+	creditService := services.NewCreditService(db)
 	subscriptionService := services.NewSubscriptionService(db)
+	mailer := services.NewMailer()
+	authService := services.NewAuthService(db, creditService, mailer)
+	usageService := services.NewUsageService(db, creditService, subscriptionService)
+	brandService := services.NewBrandService(db)
+	templateService := services.NewTemplateService(db)
+	workspaceService := services.NewWorkspaceService(db, mailer)
+	apiKeyService := services.NewAPIKeyService(db, workspaceService)
+	rateLimiter := services.NewRateLimiter(db, services.NewMemoryRateLimitStore())
+	storage, err := services.NewStorage()
+	if err != nil {
+		log.Fatal("Failed to configure storage:", err)
+	}
+
+	contentService := services.NewContentService(db, aiService, creditService, subscriptionService, usageService, brandService, templateService, storage)
+	userService := services.NewUserService(db, authService, contentService)
+	adminService := services.NewAdminService(db, aiService, creditService)
+
+	var billingClient services.BillingClient
+	if key := os.Getenv("STRIPE_SECRET_KEY"); key != "" {
+		billingClient = services.NewStripeClient(key, os.Getenv("STRIPE_API_BASE"))
+	}
+	billingService := services.NewBillingService(db, billingClient, creditService)
+
+	if err := adminService.PromoteAdmins(); err != nil {
+		log.Fatal("Failed to set up admins:", err)
+	}
+
+	// Start generation workers
+	if err := contentService.Start(); err != nil {
+		log.Fatal("Failed to start generation workers:", err)
+	}
 
 	// Initialize handlers
-	h := handlers.NewHandler(authService, userService, contentService, subscriptionService)
+	h := handlers.NewHandler(authService, userService, contentService, subscriptionService, creditService, usageService, billingService, brandService, templateService, workspaceService, apiKeyService, adminService, storage)
 
 	// Initialize Gin router
 	r := gin.Default()
 
+	// Only trust X-Forwarded-For from our own proxies, so that clients can't
+	// choose the IP they are rate limited by
+	var trustedProxies []string
+	if proxies := os.Getenv("TRUSTED_PROXIES"); proxies != "" {
+		for _, proxy := range strings.Split(proxies, ",") {
+			trustedProxies = append(trustedProxies, strings.TrimSpace(proxy))
+		}
+	}
+	if err := r.SetTrustedProxies(trustedProxies); err != nil {
+		log.Fatal("Invalid TRUSTED_PROXIES:", err)
+	}
+
 	// CORS middleware
 	config := cors.DefaultConfig()
 	config.AllowOrigins = []string{os.Getenv("FRONTEND_URL")} // Add your frontend URL
-	config.AllowMethods = []string{"GET", "POST", "PUT", "DELETE"}
+	config.AllowMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE"}
 	config.AllowHeaders = []string{"Origin", "Content-Type", "Authorization"}
 	r.Use(cors.New(config))
 
-	// Make auth service available to middleware
+	// Make auth, API key, workspace, admin and rate limit services available
+	// to middleware
 	r.Use(func(c *gin.Context) {
 		c.Set("authService", authService)
+		c.Set("apiKeyService", apiKeyService)
+		c.Set("workspaceService", workspaceService)
+		c.Set("adminService", adminService)
+		c.Set("rateLimiter", rateLimiter)
 		c.Next()
 	})
 
@@ -68,21 +120,144 @@ func main() {
 		// Auth routes (no auth required)
 		auth := api.Group("/auth")
 		{
-			auth.POST("/register", h.Register)
-			auth.POST("/login", h.Login)
+			// Limited per IP to slow down password and token guessing and
+			// email abuse
+			limited := auth.Group("")
+			limited.Use(services.RateLimitMiddleware(services.RouteAuth))
+			limited.POST("/register", h.Register)
+			limited.POST("/login", h.Login)
+			limited.POST("/refresh", h.Refresh)
+			limited.POST("/logout", h.Logout)
+			limited.POST("/verify", h.VerifyEmail)
+			limited.POST("/forgot-password", h.ForgotPassword)
+			limited.POST("/reset-password", h.ResetPassword)
+		}
+
+		// Files kept by the local storage backend
+		api.GET("/files/*key", h.GetFile)
+
+		// Stripe webhook (authenticated by signature)
+		api.POST("/billing/webhook", h.BillingWebhook)
+
+		// Content generation endpoints, also available to API keys with the
+		// generate:write scope
+		generate := api.Group("")
+		generate.Use(services.AuthMiddleware(services.ScopeGenerateWrite), services.RateLimitMiddleware(services.RouteDefault))
+		{
+			generate.POST("/requests/:id/cancel", h.CancelRequest)
+
+			// Generating requires a verified email and has its own limit
+			generation := generate.Group("")
+			generation.Use(services.RateLimitMiddleware(services.RouteGenerate), services.VerifiedEmailMiddleware())
+			generation.POST("/generate", h.GenerateContent)
+			generation.POST("/generate/stream", h.GenerateContentStream)
+			generation.POST("/content/:id/regenerate", h.RegenerateContent)
+		}
+
+		// Content endpoints, also available to API keys with the
+		// content:read scope
+		content := api.Group("")
+		content.Use(services.AuthMiddleware(services.ScopeContentRead), services.RateLimitMiddleware(services.RouteDefault))
+		{
+			content.GET("/content", h.GetContent)
+			content.GET("/content/:id", h.GetContentByID)
+			content.GET("/content/:id/versions", h.GetContentVersions)
+			content.GET("/requests/:id", h.GetRequest)
 		}
 
 		// Protected routes (auth required)
 		protected := api.Group("")
-		protected.Use(services.AuthMiddleware())
+		protected.Use(services.AuthMiddleware(), services.RateLimitMiddleware(services.RouteDefault))
 		{
-			// Content generation endpoints
-			protected.POST("/generate", h.GenerateContent)
-			protected.GET("/content", h.GetContent)
-			protected.GET("/content/:id", h.GetContentByID)
+			protected.POST("/auth/verify/resend", h.ResendVerification)
+
+			// Profile endpoints
+			protected.GET("/me", h.GetProfile)
+			protected.PATCH("/me", h.UpdateProfile)
+			protected.DELETE("/me", h.DeleteAccount)
+			protected.POST("/me/password", h.ChangePassword)
+
+			// Session endpoints
+			protected.GET("/me/sessions", h.GetSessions)
+			protected.DELETE("/me/sessions/:id", h.RevokeSession)
+
+			// API key endpoints
+			protected.GET("/api-keys", h.GetAPIKeys)
+			protected.POST("/api-keys", h.CreateAPIKey)
+			protected.DELETE("/api-keys/:id", h.DeleteAPIKey)
+
+			// Credit endpoints
+			protected.GET("/credits/history", h.GetCreditHistory)
+			protected.GET("/usage", h.GetUsage)
+
+			// Billing endpoints
+			protected.POST("/billing/checkout", h.CreateCheckoutSession)
+			protected.POST("/billing/portal", h.CreatePortalSession)
 
 			// Subscription plan endpoints
 			protected.GET("/subscription-plans", h.GetSubscriptionPlans)
+
+			// Brand endpoints
+			protected.GET("/brands", h.GetBrands)
+			protected.POST("/brands", h.CreateBrand)
+			protected.GET("/brands/:id", h.GetBrand)
+			protected.PUT("/brands/:id", h.UpdateBrand)
+			protected.DELETE("/brands/:id", h.DeleteBrand)
+
+			// Prompt template endpoints
+			protected.GET("/templates", h.GetTemplates)
+			protected.POST("/templates", h.CreateTemplate)
+			protected.GET("/templates/:id", h.GetTemplate)
+			protected.PUT("/templates/:id", h.UpdateTemplate)
+			protected.DELETE("/templates/:id", h.DeleteTemplate)
+
+			// Workspace endpoints
+			protected.GET("/workspaces", h.GetWorkspaces)
+			protected.POST("/workspaces", h.CreateWorkspace)
+			protected.POST("/invitations/accept", h.AcceptWorkspaceInvitation)
+
+			// Routes under a workspace require a minimum role in it
+			viewer := protected.Group("/workspaces/:workspace")
+			viewer.Use(services.RequireWorkspaceRole(models.WorkspaceViewer))
+			viewer.GET("", h.GetWorkspace)
+			viewer.GET("/members", h.GetWorkspaceMembers)
+			viewer.POST("/leave", h.LeaveWorkspace)
+			viewer.GET("/credits", h.GetWorkspaceCredits)
+			viewer.GET("/content", h.GetContent)
+			viewer.GET("/content/:id", h.GetContentByID)
+			viewer.GET("/content/:id/versions", h.GetContentVersions)
+			viewer.GET("/requests/:id", h.GetRequest)
+
+			editor := protected.Group("/workspaces/:workspace")
+			editor.Use(services.RequireWorkspaceRole(models.WorkspaceEditor))
+			editor.POST("/requests/:id/cancel", h.CancelRequest)
+
+			workspaceGeneration := editor.Group("")
+			workspaceGeneration.Use(services.RateLimitMiddleware(services.RouteGenerate), services.VerifiedEmailMiddleware())
+			workspaceGeneration.POST("/generate", h.GenerateContent)
+			workspaceGeneration.POST("/generate/stream", h.GenerateContentStream)
+			workspaceGeneration.POST("/content/:id/regenerate", h.RegenerateContent)
+
+			admin := protected.Group("/workspaces/:workspace")
+			admin.Use(services.RequireWorkspaceRole(models.WorkspaceAdmin))
+			admin.PUT("", h.UpdateWorkspace)
+			admin.PUT("/members/:member", h.UpdateWorkspaceMember)
+			admin.DELETE("/members/:member", h.RemoveWorkspaceMember)
+			admin.GET("/invitations", h.GetWorkspaceInvitations)
+			admin.POST("/invitations", h.CreateWorkspaceInvitation)
+			admin.DELETE("/invitations/:id", h.RevokeWorkspaceInvitation)
+			admin.POST("/credits", h.AddWorkspaceCredits)
+
+			// Admin endpoints, for site admins rather than workspace admins
+			adminAPI := protected.Group("/admin")
+			adminAPI.Use(services.AdminMiddleware())
+			adminAPI.GET("/users", h.GetAdminUsers)
+			adminAPI.GET("/users/:id", h.GetAdminUser)
+			adminAPI.PATCH("/users/:id", h.UpdateAdminUser)
+			adminAPI.GET("/users/:id/credits", h.GetAdminUserCredits)
+			adminAPI.POST("/users/:id/credits", h.GrantAdminUserCredits)
+			adminAPI.POST("/plans", h.CreatePlan)
+			adminAPI.PATCH("/plans/:id", h.UpdatePlan)
 		}
 	}
 
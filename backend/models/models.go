@@ -2,6 +2,7 @@ package models
 
 import (
 	"encoding/json"
+	"time"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
@@ -24,6 +25,7 @@ type SubscriptionPlan struct {
 	Name            string           `json:"name"`
 	Price           float64          `json:"price"`
 	TokensPerMonth  int              `json:"tokens_per_month"`
+	MonthlyCredits  int              `json:"monthly_credits"`  // balance restored at each monthly reset
 	ModelsAvailable string           `json:"models_available"` // JSON string array
 }
 
@@ -46,43 +48,506 @@ func (sp *SubscriptionPlan) GetModelsAvailable() ([]string, error) {
 	return models, nil
 }
 
+// Brand is a local brand profile whose details are compiled into the system
+// prompt when generating content for it
+type Brand struct {
+	gorm.Model
+	BrandID     string `gorm:"type:string;uniqueIndex" json:"brand_id"`
+	UserID      string `gorm:"type:string;index" json:"user_id"`
+	Name        string `json:"name"`
+	Industry    string `json:"industry"`
+	Location    string `json:"location"`
+	Audience    string `json:"audience"`
+	ToneOfVoice string `json:"tone_of_voice"`
+	BannedWords string `json:"banned_words"` // JSON string array
+	Hashtags    string `json:"hashtags"`     // JSON string array
+	SamplePosts string `json:"sample_posts"` // JSON string array
+}
+
+// SetBannedWords converts string slice to JSON string for storage
+func (b *Brand) SetBannedWords(words []string) error {
+	return setStringList(&b.BannedWords, words)
+}
+
+// GetBannedWords converts stored JSON string to string slice
+func (b *Brand) GetBannedWords() ([]string, error) {
+	return getStringList(b.BannedWords)
+}
+
+// SetHashtags converts string slice to JSON string for storage
+func (b *Brand) SetHashtags(hashtags []string) error {
+	return setStringList(&b.Hashtags, hashtags)
+}
+
+// GetHashtags converts stored JSON string to string slice
+func (b *Brand) GetHashtags() ([]string, error) {
+	return getStringList(b.Hashtags)
+}
+
+// SetSamplePosts converts string slice to JSON string for storage
+func (b *Brand) SetSamplePosts(posts []string) error {
+	return setStringList(&b.SamplePosts, posts)
+}
+
+// GetSamplePosts converts stored JSON string to string slice
+func (b *Brand) GetSamplePosts() ([]string, error) {
+	return getStringList(b.SamplePosts)
+}
+
+func setStringList(field *string, values []string) error {
+	if values == nil {
+		values = []string{}
+	}
+	data, err := json.Marshal(values)
+	if err != nil {
+		return err
+	}
+	*field = string(data)
+	return nil
+}
+
+func getStringList(field string) ([]string, error) {
+	values := []string{}
+	if field == "" {
+		return values, nil
+	}
+	if err := json.Unmarshal([]byte(field), &values); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// Session is one signed-in device. Access tokens name their session, so
+// revoking it signs the device out even before its access token expires.
+type Session struct {
+	gorm.Model
+	SessionID  string     `gorm:"type:string;uniqueIndex" json:"session_id"`
+	UserID     string     `gorm:"type:string;index" json:"user_id"`
+	IP         string     `json:"ip"`         // where the session signed in from
+	UserAgent  string     `json:"user_agent"` // of the client that signed in
+	LastUsedAt time.Time  `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+// LoginResult is the outcome of a sign-in attempt
+type LoginResult string
+
+const (
+	LoginSucceeded LoginResult = "success"
+	LoginFailed    LoginResult = "invalid_credentials"
+	LoginThrottled LoginResult = "throttled" // refused without checking the password
+	LoginDisabled  LoginResult = "disabled"  // right password for a disabled account
+)
+
+// LoginEvent is an audit record of a sign-in attempt. Failed attempts are
+// counted per email and per IP to throttle password guessing. UserID is empty
+// when the email doesn't belong to an account.
+type LoginEvent struct {
+	gorm.Model
+	UserID    string      `gorm:"type:string;index" json:"user_id,omitempty"`
+	Email     string      `gorm:"index" json:"email"`
+	IP        string      `gorm:"index" json:"ip"`
+	UserAgent string      `json:"user_agent"`
+	Result    LoginResult `gorm:"type:string" json:"result"`
+}
+
+// RefreshToken is one link in a session's chain of rotating refresh tokens.
+// Only a SHA-256 hash of the token is stored. A token is used exactly once;
+// presenting a used token again revokes its whole session.
+type RefreshToken struct {
+	gorm.Model
+	TokenHash string     `gorm:"type:string;uniqueIndex" json:"-"`
+	SessionID string     `gorm:"type:string;index" json:"session_id"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+}
+
+// PromptTemplate is a reusable prompt with {{name}} placeholders that are
+// filled in from the variables of a generation request
+type PromptTemplate struct {
+	gorm.Model
+	TemplateID   string `gorm:"type:string;uniqueIndex" json:"template_id"`
+	UserID       string `gorm:"type:string;index" json:"user_id"`
+	Name         string `json:"name"`
+	SystemPrompt string `json:"system_prompt"` // replaces the default system prompt if set
+	UserPrompt   string `json:"user_prompt"`
+	DefaultModel string `json:"default_model"`
+}
+
+// UserRole says what a user may do beyond managing their own account
+type UserRole string
+
+const (
+	UserRoleUser  UserRole = "user"
+	UserRoleAdmin UserRole = "admin" // manages users, credits and plans
+)
+
 type User struct {
 	gorm.Model
-	UserID           string           `gorm:"type:string;uniqueIndex" json:"user_id"`
-	Name             string           `json:"name"`
-	Email            string           `gorm:"uniqueIndex" json:"email"`
-	Password         string           `json:"-"` // "-" means this field won't be included in JSON
-	SubscriptionTier SubscriptionTier `gorm:"type:string;default:'free'" json:"subscription_tier"`
-	StripeCustomerID string           `json:"stripe_customer_id,omitempty"`
-	RemainingCredits int              `gorm:"default:1000" json:"remaining_credits"`
+	UserID               string           `gorm:"type:string;uniqueIndex" json:"user_id"`
+	Name                 string           `json:"name"`
+	Email                string           `gorm:"uniqueIndex" json:"email"`
+	Password             string           `json:"-"` // "-" means this field won't be included in JSON
+	SubscriptionTier     SubscriptionTier `gorm:"type:string;default:'free'" json:"subscription_tier"`
+	StripeCustomerID     string           `json:"stripe_customer_id,omitempty"`
+	StripeSubscriptionID string           `json:"stripe_subscription_id,omitempty"`
+	RemainingCredits     int              `gorm:"default:0" json:"remaining_credits"`
+	CreditsResetAt       *time.Time       `json:"credits_reset_at,omitempty"` // next monthly reset
+	EmailVerifiedAt      *time.Time       `json:"email_verified_at,omitempty"`
+	Role                 UserRole         `gorm:"type:string;default:'user'" json:"role"`
+	DisabledAt           *time.Time       `json:"disabled_at,omitempty"` // disabled accounts can't sign in
+}
+
+// AccountTokenPurpose says what an emailed account token may be used for
+type AccountTokenPurpose string
+
+const (
+	VerifyEmailToken   AccountTokenPurpose = "verify_email"
+	ResetPasswordToken AccountTokenPurpose = "reset_password"
+)
+
+// AccountToken is a single-use token sent by email to verify an address or
+// reset a password. Only a SHA-256 hash of the token is stored.
+type AccountToken struct {
+	gorm.Model
+	TokenHash string              `gorm:"type:string;uniqueIndex" json:"-"`
+	UserID    string              `gorm:"type:string;index" json:"user_id"`
+	Purpose   AccountTokenPurpose `gorm:"type:string" json:"purpose"`
+	ExpiresAt time.Time           `json:"expires_at"`
+	UsedAt    *time.Time          `json:"used_at,omitempty"`
+}
+
+// WorkspaceRole is a member's role in a workspace. Each role may do
+// everything the roles below it may.
+type WorkspaceRole string
+
+const (
+	WorkspaceOwner  WorkspaceRole = "owner"  // created the workspace; there is exactly one
+	WorkspaceAdmin  WorkspaceRole = "admin"  // manages members, invitations and credits
+	WorkspaceEditor WorkspaceRole = "editor" // generates content
+	WorkspaceViewer WorkspaceRole = "viewer" // reads content
+)
+
+// Workspace is shared by a team. Content generated in a workspace is visible
+// to all of its members and paid for from the workspace's credit pool.
+type Workspace struct {
+	gorm.Model
+	WorkspaceID      string `gorm:"type:string;uniqueIndex" json:"workspace_id"`
+	Name             string `json:"name"`
+	OwnerID          string `gorm:"type:string;index" json:"owner_id"`
+	RemainingCredits int    `gorm:"default:0" json:"remaining_credits"` // shared credit pool
+}
+
+// Membership gives a user a role in a workspace. Removed members are deleted
+// outright so that they can be invited again.
+type Membership struct {
+	gorm.Model
+	WorkspaceID string        `gorm:"type:string;uniqueIndex:idx_membership" json:"workspace_id"`
+	UserID      string        `gorm:"type:string;uniqueIndex:idx_membership;index" json:"user_id"`
+	Role        WorkspaceRole `gorm:"type:string" json:"role"`
+}
+
+// WorkspaceInvitation invites an email address to join a workspace. Only a
+// SHA-256 hash of the emailed token is stored.
+type WorkspaceInvitation struct {
+	gorm.Model
+	InvitationID string        `gorm:"type:string;uniqueIndex" json:"invitation_id"`
+	WorkspaceID  string        `gorm:"type:string;index" json:"workspace_id"`
+	Email        string        `gorm:"index" json:"email"`
+	Role         WorkspaceRole `gorm:"type:string" json:"role"`
+	TokenHash    string        `gorm:"type:string;uniqueIndex" json:"-"`
+	InvitedBy    string        `gorm:"type:string" json:"invited_by"`
+	ExpiresAt    time.Time     `json:"expires_at"`
+	AcceptedAt   *time.Time    `json:"accepted_at,omitempty"`
+}
+
+// APIKey lets scripts call the API without a password. Only a SHA-256 hash of
+// the key is stored; Prefix is kept so that users can tell their keys apart.
+// A key with a WorkspaceID acts in that workspace with its creator's role.
+type APIKey struct {
+	gorm.Model
+	KeyID       string     `gorm:"type:string;uniqueIndex" json:"key_id"`
+	UserID      string     `gorm:"type:string;index" json:"user_id"`
+	WorkspaceID string     `gorm:"type:string;default:''" json:"workspace_id,omitempty"`
+	Name        string     `json:"name"`
+	Prefix      string     `json:"prefix"`
+	KeyHash     string     `gorm:"type:string;uniqueIndex" json:"-"`
+	Scopes      string     `json:"scopes"` // JSON string array
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt  *time.Time `json:"last_used_at,omitempty"`
+}
+
+// SetScopes converts string slice to JSON string for storage
+func (k *APIKey) SetScopes(scopes []string) error {
+	return setStringList(&k.Scopes, scopes)
+}
+
+// GetScopes converts stored JSON string to string slice
+func (k *APIKey) GetScopes() ([]string, error) {
+	return getStringList(k.Scopes)
 }
 
+// RequestStatus tracks a ContentRequest through the generation queue
+type RequestStatus string
+
+const (
+	RequestQueued    RequestStatus = "queued"
+	RequestRunning   RequestStatus = "running"
+	RequestCompleted RequestStatus = "completed"
+	RequestFailed    RequestStatus = "failed"
+	RequestCancelled RequestStatus = "cancelled"
+)
+
 type ContentRequest struct {
 	gorm.Model
-	RequestID string `gorm:"type:string;uniqueIndex" json:"request_id"`
-	UserID    string `gorm:"type:string" json:"user_id"`
-	AIModel   string `json:"model"` // mistral-7b or llama2-7b
-	Prompt    string `json:"prompt"`
-	Status    string `gorm:"default:'pending'" json:"status"`
+	RequestID    string        `gorm:"type:string;uniqueIndex" json:"request_id"`
+	UserID       string        `gorm:"type:string" json:"user_id"`
+	RunBy        string        `gorm:"type:string;default:''" json:"run_by"` // user the latest run was admitted, charged and metered for; another workspace member may regenerate it
+	WorkspaceID  string        `gorm:"type:string;index;default:''" json:"workspace_id,omitempty"`
+	AIModel      string        `json:"model"` // id of a configured model, see AI_MODELS
+	Prompt       string        `json:"prompt"`
+	BrandID      string        `gorm:"type:string;index" json:"brand_id,omitempty"`
+	TemplateID   string        `gorm:"type:string;index" json:"template_id,omitempty"`
+	Variables    string        `json:"variables,omitempty"`            // JSON object of template variables
+	Platforms    string        `json:"platforms,omitempty"`            // JSON string array, one variant per platform
+	ImageOptions string        `json:"image_options,omitempty"`        // JSON ImageOptions the image was requested with
+	TextOnly     bool          `gorm:"default:false" json:"text_only"` // generate captions without an image
+	Streamed     bool          `gorm:"default:false" json:"streamed"`  // the current run streams to a client instead of running on the queue
+	Status       RequestStatus `gorm:"type:string;default:'queued';index" json:"status"`
+	Error        string        `json:"error,omitempty"`
+	StartedAt    *time.Time    `json:"started_at,omitempty"`
+	CompletedAt  *time.Time    `json:"completed_at,omitempty"`
+
+	// Token usage reported by the provider, or estimated if it didn't,
+	// summed over every run of the request. Quotas count UsageRecords.
+	PromptTokens     int  `json:"prompt_tokens"`
+	CompletionTokens int  `json:"completion_tokens"`
+	TokensEstimated  bool `json:"tokens_estimated"`
+}
+
+// UsageRecord is the tokens one generation used. Regenerating a request adds
+// a record for every run, so usage counts towards the period it happened in.
+type UsageRecord struct {
+	gorm.Model
+	RequestID        string `gorm:"type:string;index" json:"request_id"`
+	UserID           string `gorm:"type:string;index" json:"user_id"`
+	PromptTokens     int    `json:"prompt_tokens"`
+	CompletionTokens int    `json:"completion_tokens"`
+	Estimated        bool   `json:"estimated"`
+}
+
+// ImageOptions tunes the image generated for a request. Options left out are
+// up to the image model.
+type ImageOptions struct {
+	Steps          int    `json:"steps,omitempty"`
+	Seed           *int64 `json:"seed,omitempty"`
+	Width          int    `json:"width,omitempty"`
+	Height         int    `json:"height,omitempty"`
+	AspectRatio    string `json:"aspect_ratio,omitempty"` // e.g. "16:9", instead of width and height
+	StylePreset    string `json:"style_preset,omitempty"`
+	NegativePrompt string `json:"negative_prompt,omitempty"`
+}
+
+// SetImageOptions converts the image options to a JSON string for storage
+func (cr *ContentRequest) SetImageOptions(options ImageOptions) error {
+	if options == (ImageOptions{}) {
+		cr.ImageOptions = ""
+		return nil
+	}
+	data, err := json.Marshal(options)
+	if err != nil {
+		return err
+	}
+	cr.ImageOptions = string(data)
+	return nil
+}
+
+// GetImageOptions converts the stored JSON string to image options
+func (cr *ContentRequest) GetImageOptions() (ImageOptions, error) {
+	var options ImageOptions
+	if cr.ImageOptions == "" {
+		return options, nil
+	}
+	if err := json.Unmarshal([]byte(cr.ImageOptions), &options); err != nil {
+		return ImageOptions{}, err
+	}
+	return options, nil
+}
+
+// SetVariables converts the template variables to a JSON string for storage
+func (cr *ContentRequest) SetVariables(variables map[string]string) error {
+	if len(variables) == 0 {
+		cr.Variables = ""
+		return nil
+	}
+	data, err := json.Marshal(variables)
+	if err != nil {
+		return err
+	}
+	cr.Variables = string(data)
+	return nil
+}
+
+// GetVariables converts the stored JSON string to a map of template variables
+func (cr *ContentRequest) GetVariables() (map[string]string, error) {
+	variables := map[string]string{}
+	if cr.Variables == "" {
+		return variables, nil
+	}
+	if err := json.Unmarshal([]byte(cr.Variables), &variables); err != nil {
+		return nil, err
+	}
+	return variables, nil
+}
+
+// SetPlatforms converts the target platforms to a JSON string for storage
+func (cr *ContentRequest) SetPlatforms(platforms []string) error {
+	if len(platforms) == 0 {
+		cr.Platforms = ""
+		return nil
+	}
+	return setStringList(&cr.Platforms, platforms)
 }
 
+// GetPlatforms converts the stored JSON string to the target platforms
+func (cr *ContentRequest) GetPlatforms() ([]string, error) {
+	return getStringList(cr.Platforms)
+}
+
+// GeneratedContent is one version of a request's output for one platform.
+// Regenerating a request adds a new version for each of its platforms;
+// Prompt and AIModel record what produced it.
 type GeneratedContent struct {
 	gorm.Model
 	ContentID string `gorm:"type:string;uniqueIndex" json:"content_id"`
-	RequestID string `gorm:"type:string" json:"request_id"`
+	RequestID string `gorm:"type:string;index" json:"request_id"`
+	Platform  string `gorm:"type:string" json:"platform,omitempty"` // empty for a generic caption
 	Output    string `json:"output"`
 	ImageURL  string `json:"image_url"`
-	Version   int    `gorm:"default:1" json:"version"`
-	CacheKey  string `json:"cache_key"`
+	ImageKey  string `gorm:"default:''" json:"image_key"`                  // where the image is kept in storage
+	ImageID   string `gorm:"type:string;index;default:''" json:"image_id"` // GeneratedImage describing the image, if recorded
+	// Derivatives are the resized copies of the image, filled in when content
+	// is read
+	Derivatives []GeneratedImage `gorm:"-" json:"derivatives,omitempty"`
+	Version     int              `gorm:"default:1" json:"version"`
+	CacheKey    string           `gorm:"index" json:"cache_key"`
+	CachedFrom  string           `json:"cached_from,omitempty"` // ContentID this was served from, if a cache hit
+	Prompt      string           `json:"prompt"`
+	AIModel     string           `json:"model"`
+}
+
+// GeneratedImage records an image generated for a request. The content of
+// every platform the image was generated for refers to it by ImageID.
+// Resized copies of the image are recorded too, with the original's ImageID
+// as OriginalID and the name of the size as Derivative.
+type GeneratedImage struct {
+	gorm.Model
+	ImageID     string `gorm:"type:string;uniqueIndex" json:"image_id"`
+	RequestID   string `gorm:"type:string;index" json:"request_id"`
+	OriginalID  string `gorm:"type:string;index;default:''" json:"original_id,omitempty"`
+	Derivative  string `gorm:"default:''" json:"derivative,omitempty"` // thumbnail, square, story or link_card
+	Key         string `json:"key"`                                    // where the image is kept in storage
+	Format      string `json:"format"`                                 // jpeg, png, gif or webp
+	ContentType string `json:"content_type"`
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+	Size        int64  `json:"size"`                   // in bytes
+	Hash        string `gorm:"index" json:"hash"`      // hex SHA-256 of the image
+	URL         string `gorm:"-" json:"url,omitempty"` // signed URL, filled in when read
+}
+
+// CreditTransactionType describes why a user's credit balance changed
+type CreditTransactionType string
+
+const (
+	CreditReserve      CreditTransactionType = "reserve"       // held when a request is accepted
+	CreditCommit       CreditTransactionType = "commit"        // reservation consumed by a completed request
+	CreditRefund       CreditTransactionType = "refund"        // reservation returned after failure or cancellation
+	CreditGrant        CreditTransactionType = "grant"         // credits added (signup, purchase, manual)
+	CreditMonthlyReset CreditTransactionType = "monthly_reset" // balance restored to the plan allowance
+	CreditTransfer     CreditTransactionType = "transfer"      // credits moved from a user to a workspace pool
+)
+
+// CreditTransaction is an append-only ledger entry. Amount is the signed
+// change to RemainingCredits and BalanceAfter the balance once applied. Entries
+// with a WorkspaceID apply to that workspace's pool, and UserID is the member
+// who caused them.
+type CreditTransaction struct {
+	gorm.Model
+	TransactionID string                `gorm:"type:string;uniqueIndex" json:"transaction_id"`
+	UserID        string                `gorm:"type:string;index" json:"user_id"`
+	WorkspaceID   string                `gorm:"type:string;index;default:''" json:"workspace_id,omitempty"`
+	RequestID     string                `gorm:"type:string;index" json:"request_id,omitempty"`
+	Type          CreditTransactionType `gorm:"type:string" json:"type"`
+	Amount        int                   `json:"amount"`
+	BalanceAfter  int                   `json:"balance_after"`
+	Reason        string                `json:"reason,omitempty"`
+}
+
+// BillingEvent records processed Stripe webhook events so that retried
+// deliveries are only applied once
+type BillingEvent struct {
+	gorm.Model
+	EventID string `gorm:"type:string;uniqueIndex" json:"event_id"`
+	Type    string `json:"type"`
 }
 
 func InitDB(db *gorm.DB) error {
+	// Accounts created before email verification existed count as verified
+	backfillVerified := db.Migrator().HasTable(&User{}) && !db.Migrator().HasColumn(&User{}, "EmailVerifiedAt")
+	backfillCredits := db.Migrator().HasTable(&SubscriptionPlan{}) && !db.Migrator().HasColumn(&SubscriptionPlan{}, "MonthlyCredits")
+	backfillImageKeys := db.Migrator().HasTable(&GeneratedContent{}) && !db.Migrator().HasColumn(&GeneratedContent{}, "ImageKey")
+	backfillUsage := db.Migrator().HasTable(&ContentRequest{}) && !db.Migrator().HasTable(&UsageRecord{})
+	backfillRunBy := db.Migrator().HasTable(&ContentRequest{}) && !db.Migrator().HasColumn(&ContentRequest{}, "RunBy")
+
 	// Auto-migrate the schemas
-	if err := db.AutoMigrate(&User{}, &ContentRequest{}, &GeneratedContent{}, &SubscriptionPlan{}); err != nil {
+	if err := db.AutoMigrate(&User{}, &ContentRequest{}, &UsageRecord{}, &GeneratedContent{}, &GeneratedImage{}, &SubscriptionPlan{}, &CreditTransaction{}, &BillingEvent{}, &Brand{}, &PromptTemplate{}, &Session{}, &RefreshToken{}, &AccountToken{}, &Workspace{}, &Membership{}, &WorkspaceInvitation{}, &APIKey{}, &LoginEvent{}); err != nil {
+		return err
+	}
+
+	if backfillVerified {
+		if err := db.Exec("UPDATE users SET email_verified_at = created_at WHERE email_verified_at IS NULL").Error; err != nil {
+			return err
+		}
+	}
+
+	// Images uploaded before storage keys were recorded live at
+	// https://<bucket>.s3.<region>.amazonaws.com/<key>
+	if backfillImageKeys {
+		if err := db.Exec(`UPDATE generated_contents
+			SET image_key = substr(image_url, 9 + instr(substr(image_url, 9), '/'))
+			WHERE image_url LIKE 'https://%/%'`).Error; err != nil {
+			return err
+		}
+	}
+
+	// Requests used to always run as their user
+	if backfillRunBy {
+		if err := db.Exec("UPDATE content_requests SET run_by = user_id").Error; err != nil {
+			return err
+		}
+	}
+
+	// Usage used to be kept only as totals on each request, which are
+	// counted from when the request was made
+	if backfillUsage {
+		if err := db.Exec(`INSERT INTO usage_records (created_at, updated_at, request_id, user_id, prompt_tokens, completion_tokens, estimated)
+			SELECT created_at, created_at, request_id, user_id, prompt_tokens, completion_tokens, tokens_estimated FROM content_requests
+			WHERE prompt_tokens > 0 OR completion_tokens > 0`).Error; err != nil {
+			return err
+		}
+	}
+
+	// Backfill the prompt and model of content created before versioning
+	if err := db.Exec(`UPDATE generated_contents SET
+		prompt = (SELECT prompt FROM content_requests WHERE content_requests.request_id = generated_contents.request_id),
+		ai_model = (SELECT ai_model FROM content_requests WHERE content_requests.request_id = generated_contents.request_id)
+		WHERE prompt IS NULL OR prompt = ''`).Error; err != nil {
 		return err
 	}
 
-	// Initialize default subscription plans if they don't exist
+	// Plans are managed through the admin API; these are only the defaults
+	// for a new database
 	plans := []SubscriptionPlan{
 		{
 			PlanID:         uuid.New().String(),
@@ -90,6 +555,7 @@ func InitDB(db *gorm.DB) error {
 			Name:           "Free",
 			Price:          0,
 			TokensPerMonth: 10000,
+			MonthlyCredits: 200,
 		},
 		{
 			PlanID:         uuid.New().String(),
@@ -97,6 +563,7 @@ func InitDB(db *gorm.DB) error {
 			Name:           "Pro",
 			Price:          29.99,
 			TokensPerMonth: 500000,
+			MonthlyCredits: 5000,
 		},
 		{
 			PlanID:         uuid.New().String(),
@@ -104,6 +571,7 @@ func InitDB(db *gorm.DB) error {
 			Name:           "Enterprise",
 			Price:          999.99,
 			TokensPerMonth: -1, // Unlimited
+			MonthlyCredits: 50000,
 		},
 	}
 
@@ -118,20 +586,25 @@ func InitDB(db *gorm.DB) error {
 		return err
 	}
 
-	for _, plan := range plans {
-		// Check if plan exists
-		var existingPlan SubscriptionPlan
-		if err := db.Where("tier = ?", plan.Tier).First(&existingPlan).Error; err != nil {
-			if err == gorm.ErrRecordNotFound {
-				// Create new plan if it doesn't exist
-				if err := db.Create(&plan).Error; err != nil {
-					return err
-				}
-			} else {
+	if backfillCredits {
+		// Plans created before monthly credits existed get the defaults
+		for _, plan := range plans {
+			if err := db.Model(&SubscriptionPlan{}).Where("tier = ?", plan.Tier).
+				Update("monthly_credits", plan.MonthlyCredits).Error; err != nil {
 				return err
 			}
 		}
 	}
 
+	var count int64
+	if err := db.Model(&SubscriptionPlan{}).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		if err := db.Create(&plans).Error; err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
@@ -0,0 +1,316 @@
+package services
+
+import (
+	"ai-content-creation/models"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrPlanNotFound    = errors.New("plan not found")
+	ErrPlanExists      = errors.New("a plan for this tier already exists")
+	ErrInvalidTier     = errors.New("tier must be up to 32 lowercase letters, digits, - or _")
+	ErrInvalidPlan     = errors.New("price and monthly_credits can't be negative, tokens_per_month must be -1 (unlimited) or more")
+	ErrNoPlanModels    = errors.New("a plan needs at least one model")
+	ErrInvalidUserRole = errors.New("role must be user or admin")
+	ErrAdminSelf       = errors.New("admins can't disable or demote themselves")
+	ErrInvalidAmount   = errors.New("amount must not be zero")
+)
+
+var tierPattern = regexp.MustCompile(`^[a-z0-9_-]{1,32}$`)
+
+// UserUpdate is an admin's change to a user. Nil fields are left alone.
+type UserUpdate struct {
+	Tier     *models.SubscriptionTier
+	Role     *models.UserRole
+	Disabled *bool
+}
+
+// PlanInput sets the fields of a subscription plan. Nil fields are left
+// alone when updating.
+type PlanInput struct {
+	Name            *string
+	Price           *float64
+	TokensPerMonth  *int // -1 means unlimited
+	MonthlyCredits  *int
+	ModelsAvailable []string
+}
+
+type AdminService struct {
+	db            *gorm.DB
+	aiService     *AIService
+	creditService *CreditService
+	adminEmails   []string
+}
+
+// NewAdminService creates the admin service. Accounts whose address is
+// listed in ADMIN_EMAILS (comma separated) are made admins by PromoteAdmins.
+func NewAdminService(db *gorm.DB, aiService *AIService, creditService *CreditService) *AdminService {
+	var emails []string
+	for _, email := range strings.Split(os.Getenv("ADMIN_EMAILS"), ",") {
+		if email = strings.ToLower(strings.TrimSpace(email)); email != "" {
+			emails = append(emails, email)
+		}
+	}
+	return &AdminService{db: db, aiService: aiService, creditService: creditService, adminEmails: emails}
+}
+
+// PromoteAdmins makes the accounts in ADMIN_EMAILS admins. Only verified
+// addresses count, so that nobody can claim an admin address by registering
+// it first.
+func (s *AdminService) PromoteAdmins() error {
+	if len(s.adminEmails) == 0 {
+		return nil
+	}
+	if err := s.db.Model(&models.User{}).
+		Where("LOWER(email) IN ? AND email_verified_at IS NOT NULL", s.adminEmails).
+		Update("role", models.UserRoleAdmin).Error; err != nil {
+		return fmt.Errorf("failed to promote admins: %v", err)
+	}
+	return nil
+}
+
+func (s *AdminService) IsAdmin(userID string) (bool, error) {
+	var user models.User
+	if err := s.db.Select("role").First(&user, "user_id = ?", userID).Error; err != nil {
+		return false, fmt.Errorf("user not found")
+	}
+	return user.Role == models.UserRoleAdmin, nil
+}
+
+// GetUsers returns users whose name or email contains query, newest first,
+// along with how many match in total.
+func (s *AdminService) GetUsers(query string, limit, offset int) ([]models.User, int64, error) {
+	scope := s.db.Model(&models.User{})
+	if query = strings.TrimSpace(query); query != "" {
+		like := "%" + likeEscaper.Replace(query) + "%"
+		scope = scope.Where(`name LIKE ? ESCAPE '\' OR email LIKE ? ESCAPE '\'`, like, like)
+	}
+	// Used for both the count and the page
+	scope = scope.Session(&gorm.Session{})
+
+	var total int64
+	if err := scope.Count(&total).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to count users: %v", err)
+	}
+
+	var users []models.User
+	if err := scope.Order("id DESC").Limit(limit).Offset(offset).Find(&users).Error; err != nil {
+		return nil, 0, fmt.Errorf("failed to fetch users: %v", err)
+	}
+	return users, total, nil
+}
+
+// likeEscaper makes a search term match literally in a LIKE pattern with
+// ESCAPE '\'.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func (s *AdminService) GetUser(userID string) (*models.User, error) {
+	var user models.User
+	if err := s.db.First(&user, "user_id = ?", userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, fmt.Errorf("failed to fetch user: %v", err)
+	}
+	return &user, nil
+}
+
+// UpdateUser changes a user's tier, role or disabled state on behalf of
+// adminID. Disabling an account signs it out of every session; its API keys
+// stop working while it is disabled.
+func (s *AdminService) UpdateUser(adminID string, userID string, update UserUpdate) (*models.User, error) {
+	user, err := s.GetUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	updates := map[string]interface{}{}
+	if update.Tier != nil {
+		var plan models.SubscriptionPlan
+		if err := s.db.Where("tier = ?", *update.Tier).First(&plan).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, ErrPlanNotFound
+			}
+			return nil, fmt.Errorf("failed to fetch plan: %v", err)
+		}
+		updates["subscription_tier"] = plan.Tier
+	}
+	if update.Role != nil {
+		if *update.Role != models.UserRoleUser && *update.Role != models.UserRoleAdmin {
+			return nil, ErrInvalidUserRole
+		}
+		if userID == adminID && *update.Role != models.UserRoleAdmin {
+			return nil, ErrAdminSelf
+		}
+		updates["role"] = *update.Role
+	}
+
+	now := time.Now()
+	disable := update.Disabled != nil && *update.Disabled && user.DisabledAt == nil
+	if update.Disabled != nil {
+		if userID == adminID && *update.Disabled {
+			return nil, ErrAdminSelf
+		}
+		switch {
+		case disable:
+			updates["disabled_at"] = &now
+		case !*update.Disabled:
+			updates["disabled_at"] = nil
+		}
+	}
+
+	if len(updates) == 0 {
+		return user, nil
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(user).Updates(updates).Error; err != nil {
+			return fmt.Errorf("failed to update user: %v", err)
+		}
+		if disable {
+			if err := tx.Model(&models.Session{}).
+				Where("user_id = ? AND revoked_at IS NULL", userID).
+				Update("revoked_at", &now).Error; err != nil {
+				return fmt.Errorf("failed to revoke sessions: %v", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetUser(userID)
+}
+
+// GrantCredits adds credits to a user's balance, or revokes them if amount is
+// negative. The reason is recorded in the user's credit history.
+func (s *AdminService) GrantCredits(userID string, amount int, reason string) (*models.User, error) {
+	if amount == 0 {
+		return nil, ErrInvalidAmount
+	}
+	if _, err := s.GetUser(userID); err != nil {
+		return nil, err
+	}
+	if err := s.creditService.Grant(userID, amount, strings.TrimSpace(reason)); err != nil {
+		return nil, err
+	}
+	return s.GetUser(userID)
+}
+
+// CreatePlan adds a subscription plan for a new tier. Unset fields of input
+// are zero, except that the plan needs models.
+func (s *AdminService) CreatePlan(tier models.SubscriptionTier, input PlanInput) (*models.SubscriptionPlan, error) {
+	if !tierPattern.MatchString(string(tier)) {
+		return nil, ErrInvalidTier
+	}
+	if input.ModelsAvailable == nil {
+		return nil, ErrNoPlanModels
+	}
+
+	plan := models.SubscriptionPlan{PlanID: uuid.New().String(), Tier: tier}
+	if err := s.applyPlanInput(&plan, input); err != nil {
+		return nil, err
+	}
+
+	var existing int64
+	if err := s.db.Model(&models.SubscriptionPlan{}).Where("tier = ?", tier).Count(&existing).Error; err != nil {
+		return nil, fmt.Errorf("failed to check plan: %v", err)
+	}
+	if existing > 0 {
+		return nil, ErrPlanExists
+	}
+
+	if err := s.db.Create(&plan).Error; err != nil {
+		return nil, fmt.Errorf("failed to create plan: %v", err)
+	}
+	return &plan, nil
+}
+
+// UpdatePlan changes a plan's name, price, allowances and models. A plan's
+// tier can't change, since users and Stripe prices refer to it.
+func (s *AdminService) UpdatePlan(planID string, input PlanInput) (*models.SubscriptionPlan, error) {
+	var plan models.SubscriptionPlan
+	if err := s.db.Where("plan_id = ?", planID).First(&plan).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrPlanNotFound
+		}
+		return nil, fmt.Errorf("failed to fetch plan: %v", err)
+	}
+
+	if err := s.applyPlanInput(&plan, input); err != nil {
+		return nil, err
+	}
+
+	if err := s.db.Save(&plan).Error; err != nil {
+		return nil, fmt.Errorf("failed to update plan: %v", err)
+	}
+	return &plan, nil
+}
+
+// applyPlanInput validates input and copies its set fields to plan.
+func (s *AdminService) applyPlanInput(plan *models.SubscriptionPlan, input PlanInput) error {
+	if input.Name != nil {
+		plan.Name = strings.TrimSpace(*input.Name)
+	}
+	if input.Price != nil {
+		plan.Price = *input.Price
+	}
+	if input.TokensPerMonth != nil {
+		plan.TokensPerMonth = *input.TokensPerMonth
+	}
+	if input.MonthlyCredits != nil {
+		plan.MonthlyCredits = *input.MonthlyCredits
+	}
+	if plan.Price < 0 || plan.MonthlyCredits < 0 || plan.TokensPerMonth < -1 {
+		return ErrInvalidPlan
+	}
+
+	if input.ModelsAvailable != nil {
+		modelIDs := []string{}
+		for _, model := range input.ModelsAvailable {
+			model = strings.TrimSpace(model)
+			if !s.aiService.HasModel(model) {
+				return &UnknownModelError{Model: model}
+			}
+			if !containsString(modelIDs, model) {
+				modelIDs = append(modelIDs, model)
+			}
+		}
+		if len(modelIDs) == 0 {
+			return ErrNoPlanModels
+		}
+		if err := plan.SetModelsAvailable(modelIDs); err != nil {
+			return fmt.Errorf("failed to encode models: %v", err)
+		}
+	}
+	return nil
+}
+
+// AdminMiddleware rejects users who aren't admins. It must run after
+// AuthMiddleware.
+func AdminMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		adminService := c.MustGet("adminService").(*AdminService)
+		admin, err := adminService.IsAdmin(c.GetString("userID"))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+			return
+		}
+		if !admin {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Admin access required"})
+			return
+		}
+		c.Next()
+	}
+}
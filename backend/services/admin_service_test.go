@@ -0,0 +1,42 @@
+package services
+
+import "testing"
+
+func TestGetUsersSearchIsLiteral(t *testing.T) {
+	db := newTestDB(t)
+	s := NewAdminService(db, nil, NewCreditService(db))
+	for _, id := range []string{"ann_lee", "annxlee", "100%", "1000", `back\slash`, "backslash"} {
+		createTestUser(t, db, id, 0)
+	}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"ann_", []string{"ann_lee"}},
+		{"100%", []string{"100%"}},
+		{"%", []string{"100%"}},
+		{`k\s`, []string{`back\slash`}},
+		{"ANN", []string{"annxlee", "ann_lee"}},
+	}
+	for _, tt := range tests {
+		users, total, err := s.GetUsers(tt.query, 10, 0)
+		if err != nil {
+			t.Fatalf("GetUsers(%q): %v", tt.query, err)
+		}
+		var got []string
+		for _, u := range users {
+			got = append(got, u.UserID)
+		}
+		if int(total) != len(tt.want) || len(got) != len(tt.want) {
+			t.Errorf("GetUsers(%q) = %v (total %d), want %v", tt.query, got, total, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("GetUsers(%q) = %v, want %v", tt.query, got, tt.want)
+				break
+			}
+		}
+	}
+}
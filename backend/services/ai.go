@@ -2,28 +2,21 @@ package services
 
 import (
 	"ai-content-creation/models"
-	"bytes"
-	"encoding/json"
+	"context"
 	"fmt"
-	"io"
-	"net/http"
 	"os"
-
-	"github.com/gin-gonic/gin"
+	"time"
+	"unicode/utf8"
 )
 
-type AIService struct {
-	cloudflareAccountID string
-	cloudflareAPIToken  string
-}
-
-type CloudflareAIRequest struct {
-	Messages []Message `json:"messages"`
-	Stream   bool      `json:"stream"`
-}
+const systemPrompt = `
+          You are a marketing and sales professional who is looking to increase your sales and the best in the industry for
+        growing local brands and make sure to be concise and provide the caption and only the caption that is based on the user's prompt.`
 
-type ImageRequest struct {
-	Prompt string `json:"prompt"`
+type AIService struct {
+	providers  map[string]AIProvider
+	textModels map[string]ModelConfig
+	imageModel ModelConfig
 }
 
 type Message struct {
@@ -31,151 +24,171 @@ type Message struct {
 	Content string `json:"content"`
 }
 
-type CloudflareAIResponse struct {
-	Result struct {
-		Response string `json:"response"`
-	} `json:"result"`
-	Success bool `json:"success"`
-	Errors  []struct {
-		Message string `json:"message"`
-	} `json:"errors"`
-}
+// NewAIService builds the provider registry from the environment.
+//
+// Cloudflare is always registered using CLOUDFLARE_ACCOUNT_ID and
+// CLOUDFLARE_API_TOKEN. The OpenAI-compatible provider is registered when
+// OPENAI_BASE_URL is set (OPENAI_API_KEY is optional). See loadModelConfig
+// for how models are mapped to providers. Provider calls time out after
+// AI_REQUEST_TIMEOUT (default 2m), and streams once no data has arrived for
+// AI_STREAM_IDLE_TIMEOUT (default 30s).
+func NewAIService() (*AIService, error) {
+	textModels, imageModel, err := loadModelConfig()
+	if err != nil {
+		return nil, err
+	}
 
-type ImageResponse struct {
-	Result struct {
-		Image []byte `json:"image"`
+	timeout := envDuration("AI_REQUEST_TIMEOUT", 2*time.Minute)
+	idleTimeout := envDuration("AI_STREAM_IDLE_TIMEOUT", 30*time.Second)
+	providers := map[string]AIProvider{
+		providerCloudflare: NewCloudflareProvider(
+			os.Getenv("CLOUDFLARE_ACCOUNT_ID"),
+			os.Getenv("CLOUDFLARE_API_TOKEN"),
+			providerModels(textModels, imageModel, providerCloudflare),
+			timeout,
+			idleTimeout,
+		),
 	}
-	Success bool `json:"success"`
-	Errors  []struct {
-		Message string `json:"message"`
+	if baseURL := os.Getenv("OPENAI_BASE_URL"); baseURL != "" {
+		providers[providerOpenAI] = NewOpenAIProvider(baseURL, os.Getenv("OPENAI_API_KEY"), timeout, idleTimeout)
 	}
-}
 
-func NewAIService() *AIService {
-	return &AIService{
-		cloudflareAccountID: os.Getenv("CLOUDFLARE_ACCOUNT_ID"),
-		cloudflareAPIToken:  os.Getenv("CLOUDFLARE_API_TOKEN"),
+	for _, m := range textModels {
+		if _, ok := providers[m.Provider]; !ok {
+			return nil, fmt.Errorf("model %q uses unknown or unconfigured provider %q", m.ID, m.Provider)
+		}
 	}
-}
-
-func (ai *AIService) GenerateContent(c *gin.Context, contentReq *models.ContentRequest) (string, error) {
-	var modelEndpoint string
-	switch contentReq.AIModel {
-	case "mistral-7b":
-		modelEndpoint = "@cf/mistralai/mistral-7b-instruct-v0.1"
-	case "llama2-7b":
-		modelEndpoint = "@cf/meta/llama-2-7b-chat-fp16"
-	default:
-		modelEndpoint = "@cf/meta/llama-2-7b-chat-fp16"
+	if _, ok := providers[imageModel.Provider]; !ok {
+		return nil, fmt.Errorf("image model uses unknown or unconfigured provider %q", imageModel.Provider)
 	}
 
-	aiReq := CloudflareAIRequest{
-		Messages: []Message{
-			{Role: "system", Content: `
-          You are a marketing and sales professional who is looking to increase your sales and the best in the industry for 
-        growing local brands and make sure to be concise and provide the caption and only the caption that is based on the user's prompt.`},
-			{Role: "user", Content: contentReq.Prompt},
-		},
-		Stream: false,
-	}
+	return &AIService{
+		providers:  providers,
+		textModels: textModels,
+		imageModel: imageModel,
+	}, nil
+}
 
-	reqBody, err := json.Marshal(aiReq)
-	if err != nil {
-		return "", fmt.Errorf("Failed to marshal the request into json: %s", err)
+// Models returns the IDs of all configured text models.
+func (ai *AIService) Models() []string {
+	var ids []string
+	for id := range ai.textModels {
+		ids = append(ids, id)
 	}
+	return ids
+}
 
-	url := fmt.Sprintf("https://api.cloudflare.com/client/v4/accounts/%s/ai/run/%s",
-		ai.cloudflareAccountID, modelEndpoint)
+// HasModel reports whether id is a configured text model.
+func (ai *AIService) HasModel(id string) bool {
+	_, ok := ai.textModels[id]
+	return ok
+}
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(reqBody))
-	if err != nil {
-		return "", fmt.Errorf("failed to create request: %v", err)
+// resolveTextModel returns the provider and config for a public model ID.
+func (ai *AIService) resolveTextModel(id string) (AIProvider, ModelConfig, error) {
+	m, ok := ai.textModels[id]
+	if !ok {
+		return nil, ModelConfig{}, &UnknownModelError{Model: id}
 	}
+	return ai.providers[m.Provider], m, nil
+}
 
-	req.Header.Set("Authorization", "Bearer "+ai.cloudflareAPIToken)
-	req.Header.Set("Content-Type", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
+// GenerateContent generates the caption for a request using the given system
+// prompt. The result always carries token usage, estimated locally if the
+// provider didn't report it.
+func (ai *AIService) GenerateContent(ctx context.Context, contentReq *models.ContentRequest, system string) (*TextGenerationResult, error) {
+	provider, textReq, err := ai.textRequest(contentReq, system)
 	if err != nil {
-		return "", fmt.Errorf("failed to send request: %v", err)
+		return nil, err
 	}
-	defer resp.Body.Close()
 
-	// Read the entire response body
-	body, err := io.ReadAll(resp.Body)
+	result, err := provider.GenerateText(ctx, textReq)
 	if err != nil {
-		return "", fmt.Errorf("failed to read response body: %v", err)
+		return nil, err
 	}
 
-	// Check HTTP status code
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(body))
-	}
+	fillUsage(result, textReq)
+	return result, nil
+}
 
-	// Parse the response
-	var cloudflareResponse CloudflareAIResponse
-	if err := json.Unmarshal(body, &cloudflareResponse); err != nil {
-		return "", fmt.Errorf("failed to parse response JSON: %v", err)
+// StreamContent is like GenerateContent but passes tokens to onToken as the
+// provider produces them. The full text is returned once the stream ends.
+func (ai *AIService) StreamContent(ctx context.Context, contentReq *models.ContentRequest, system string, onToken TokenHandler) (*TextGenerationResult, error) {
+	provider, textReq, err := ai.textRequest(contentReq, system)
+	if err != nil {
+		return nil, err
 	}
 
-	// Check for API errors
-	if !cloudflareResponse.Success && len(cloudflareResponse.Errors) > 0 {
-		return "", fmt.Errorf("API error: %s", cloudflareResponse.Errors[0].Message)
+	result, err := provider.StreamText(ctx, textReq, onToken)
+	if err != nil {
+		return nil, err
 	}
 
-	return cloudflareResponse.Result.Response, nil
+	fillUsage(result, textReq)
+	return result, nil
 }
 
-func (ai *AIService) GenerateImage(c *gin.Context, contentReq *models.ContentRequest) (string, error) {
-	modelEndpoint := "@cf/black-forest-labs/flux-1-schnell"
-
-	imageReq := ImageRequest{
-		Prompt: "You are a senior in digital marketing and your task is to Generate a professional digital illustration of the following prompt: " + contentReq.Prompt,
+// fillUsage estimates token usage when the provider didn't report any.
+func fillUsage(result *TextGenerationResult, req TextGenerationRequest) {
+	if result.Usage.Total() > 0 {
+		return
 	}
 
-	reqBody, err := json.Marshal(imageReq)
-	if err != nil {
-		return "", fmt.Errorf("Failed to marshal the request into json: %s", err)
+	prompt := 0
+	for _, m := range req.Messages {
+		prompt += estimateTokens(m.Content)
 	}
-
-	url := fmt.Sprintf("https://api.cloudflare.com/client/v4/accounts/%s/ai/run/%s",
-		ai.cloudflareAccountID, modelEndpoint)
-
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(reqBody))
-	if err != nil {
-		return "", fmt.Errorf("failed to create request: %v", err)
+	result.Usage = TokenUsage{
+		PromptTokens:     prompt,
+		CompletionTokens: estimateTokens(result.Text),
+		Estimated:        true,
 	}
+}
 
-	req.Header.Set("Authorization", "Bearer "+ai.cloudflareAPIToken)
-
-	client := &http.Client{}
+// estimateTokens approximates a token count using the common rule of thumb
+// of four characters per token for English text.
+func estimateTokens(text string) int {
+	return (utf8.RuneCountInString(text) + 3) / 4
+}
 
-	resp, err := client.Do(req)
+func (ai *AIService) textRequest(contentReq *models.ContentRequest, system string) (AIProvider, TextGenerationRequest, error) {
+	provider, model, err := ai.resolveTextModel(contentReq.AIModel)
 	if err != nil {
-		return "", fmt.Errorf("failed to send request: %v", err)
+		return nil, TextGenerationRequest{}, err
 	}
-	defer resp.Body.Close()
 
-	respBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", fmt.Errorf("failed to read response body: %v", err)
-	}
+	return provider, TextGenerationRequest{
+		Model: model.Upstream,
+		Messages: []Message{
+			{Role: "system", Content: system},
+			{Role: "user", Content: contentReq.Prompt},
+		},
+	}, nil
+}
 
-	var imageResponse ImageResponse
-	if err := json.Unmarshal(respBody, &imageResponse); err != nil {
-		return "", fmt.Errorf("failed to parse response JSON: %v", err)
-	}
+// GenerateImage generates an illustration for the request with the image
+// options it was made with. A style preset replaces the default style of a
+// professional digital illustration.
+func (ai *AIService) GenerateImage(ctx context.Context, contentReq *models.ContentRequest) ([]byte, error) {
+	provider := ai.providers[ai.imageModel.Provider]
 
-	if !imageResponse.Success && len(imageResponse.Errors) > 0 {
-		return "", fmt.Errorf("Image API error: %s", imageResponse.Errors[0].Message)
+	options, err := contentReq.GetImageOptions()
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image options: %v", err)
 	}
 
-	if err := UploadImageToS3(imageResponse.Result.Image, contentReq); err != nil {
-		return "", fmt.Errorf("failed to upload image to S3: %v", err)
+	style := "a professional digital illustration"
+	if preset, ok := imageStylePresets[options.StylePreset]; ok {
+		style = preset
 	}
 
-	imageURL := GetImageURL(contentReq.RequestID)
-
-	return imageURL, nil
+	return provider.GenerateImage(ctx, ImageGenerationRequest{
+		Model:          ai.imageModel.Upstream,
+		Prompt:         "You are a senior in digital marketing and your task is to Generate " + style + " of the following prompt: " + contentReq.Prompt,
+		NegativePrompt: options.NegativePrompt,
+		Steps:          options.Steps,
+		Seed:           options.Seed,
+		Width:          options.Width,
+		Height:         options.Height,
+	})
 }
@@ -0,0 +1,159 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// AIProvider is implemented by every backend that can run a model.
+// ContentService only ever talks to AIService, which picks a provider
+// per model based on configuration.
+type AIProvider interface {
+	Name() string
+	GenerateText(ctx context.Context, req TextGenerationRequest) (*TextGenerationResult, error)
+	StreamText(ctx context.Context, req TextGenerationRequest, onToken TokenHandler) (*TextGenerationResult, error)
+	GenerateImage(ctx context.Context, req ImageGenerationRequest) ([]byte, error)
+	ListModels(ctx context.Context) ([]string, error)
+}
+
+// TextGenerationRequest is a provider-agnostic chat completion request.
+// Model is the provider's own model name, not our public model ID.
+type TextGenerationRequest struct {
+	Model    string
+	Messages []Message
+}
+
+type TextGenerationResult struct {
+	Text  string
+	Usage TokenUsage
+}
+
+// TokenUsage is the token count for one generation. Estimated is set when the
+// provider didn't report usage and it was approximated locally.
+type TokenUsage struct {
+	PromptTokens     int  `json:"prompt_tokens"`
+	CompletionTokens int  `json:"completion_tokens"`
+	Estimated        bool `json:"estimated,omitempty"`
+}
+
+func (u TokenUsage) Total() int {
+	return u.PromptTokens + u.CompletionTokens
+}
+
+// TokenHandler receives generated text incrementally while streaming.
+// Returning an error aborts the stream.
+type TokenHandler func(token string) error
+
+// ImageGenerationRequest is a provider-agnostic image request. Zero values
+// leave an option to the model; ContentService only sets options the model
+// supports.
+type ImageGenerationRequest struct {
+	Model          string
+	Prompt         string
+	NegativePrompt string
+	Steps          int
+	Seed           *int64
+	Width          int
+	Height         int
+}
+
+// ModelConfig maps a public model ID (what clients send as "model") to the
+// provider that serves it and the provider's own name for the model.
+type ModelConfig struct {
+	ID       string
+	Provider string
+	Upstream string
+}
+
+const (
+	providerCloudflare = "cloudflare"
+	providerOpenAI     = "openai"
+)
+
+// defaultTextModels are always available unless overridden by AI_MODELS.
+var defaultTextModels = []ModelConfig{
+	{ID: "mistral-7b", Provider: providerCloudflare, Upstream: "@cf/mistralai/mistral-7b-instruct-v0.1"},
+	{ID: "llama2-7b", Provider: providerCloudflare, Upstream: "@cf/meta/llama-2-7b-chat-fp16"},
+}
+
+var defaultImageModel = ModelConfig{
+	ID:       "flux-1-schnell",
+	Provider: providerCloudflare,
+	Upstream: "@cf/black-forest-labs/flux-1-schnell",
+}
+
+// loadModelConfig reads the text model table and the image model from the
+// environment.
+//
+// AI_MODELS is a comma separated list of "id=provider:upstream" entries, e.g.
+//
+//	AI_MODELS=llama3-local=openai:llama3.1:8b,qwen-local=openai:qwen2.5:7b
+//
+// Entries are added to (or replace) the built-in Cloudflare models.
+// AI_IMAGE_MODEL uses the same "provider:upstream" form.
+func loadModelConfig() (map[string]ModelConfig, ModelConfig, error) {
+	textModels := make(map[string]ModelConfig)
+	for _, m := range defaultTextModels {
+		textModels[m.ID] = m
+	}
+
+	if raw := os.Getenv("AI_MODELS"); raw != "" {
+		for _, entry := range strings.Split(raw, ",") {
+			entry = strings.TrimSpace(entry)
+			if entry == "" {
+				continue
+			}
+			id, target, ok := strings.Cut(entry, "=")
+			id = strings.TrimSpace(id)
+			if !ok || id == "" {
+				return nil, ModelConfig{}, fmt.Errorf("invalid AI_MODELS entry %q: expected id=provider:model", entry)
+			}
+			provider, upstream, err := parseModelTarget(target)
+			if err != nil {
+				return nil, ModelConfig{}, fmt.Errorf("invalid AI_MODELS entry %q: %v", entry, err)
+			}
+			textModels[id] = ModelConfig{ID: id, Provider: provider, Upstream: upstream}
+		}
+	}
+
+	imageModel := defaultImageModel
+	if raw := os.Getenv("AI_IMAGE_MODEL"); raw != "" {
+		provider, upstream, err := parseModelTarget(raw)
+		if err != nil {
+			return nil, ModelConfig{}, fmt.Errorf("invalid AI_IMAGE_MODEL %q: %v", raw, err)
+		}
+		imageModel = ModelConfig{ID: upstream, Provider: provider, Upstream: upstream}
+	}
+
+	return textModels, imageModel, nil
+}
+
+// providerModels returns the upstream names of the text and image models
+// served by provider, sorted and without duplicates.
+func providerModels(textModels map[string]ModelConfig, imageModel ModelConfig, provider string) []string {
+	seen := make(map[string]bool)
+	var names []string
+	add := func(m ModelConfig) {
+		if m.Provider == provider && !seen[m.Upstream] {
+			seen[m.Upstream] = true
+			names = append(names, m.Upstream)
+		}
+	}
+	for _, m := range textModels {
+		add(m)
+	}
+	add(imageModel)
+	sort.Strings(names)
+	return names
+}
+
+func parseModelTarget(target string) (string, string, error) {
+	provider, upstream, ok := strings.Cut(strings.TrimSpace(target), ":")
+	if !ok || provider == "" || upstream == "" {
+		return "", "", fmt.Errorf("expected provider:model")
+	}
+	return provider, upstream, nil
+}
@@ -0,0 +1,54 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestLoadModelConfig(t *testing.T) {
+	t.Setenv("AI_MODELS", "llama3-local=openai:llama3.1:8b, mistral-7b=openai:mistral")
+	textModels, _, err := loadModelConfig()
+	if err != nil {
+		t.Fatalf("loadModelConfig: %v", err)
+	}
+	if m := textModels["llama3-local"]; m.Provider != providerOpenAI || m.Upstream != "llama3.1:8b" {
+		t.Errorf("llama3-local = %+v", m)
+	}
+	if m := textModels["mistral-7b"]; m.Provider != providerOpenAI {
+		t.Errorf("mistral-7b wasn't overridden: %+v", m)
+	}
+	if _, ok := textModels["llama2-7b"]; !ok {
+		t.Error("built-in llama2-7b is missing")
+	}
+
+	for _, raw := range []string{"=openai:x", " =openai:x", "llama3", "llama3=openai", "llama3=:x"} {
+		t.Setenv("AI_MODELS", raw)
+		if _, _, err := loadModelConfig(); err == nil {
+			t.Errorf("AI_MODELS=%q was accepted", raw)
+		}
+	}
+}
+
+func TestCloudflareListModels(t *testing.T) {
+	t.Setenv("AI_MODELS", "mistral-7b=openai:mistral,llama3-cf=cloudflare:@cf/meta/llama-3-8b-instruct")
+	t.Setenv("AI_IMAGE_MODEL", "cloudflare:@cf/stabilityai/stable-diffusion-xl-base-1.0")
+	textModels, imageModel, err := loadModelConfig()
+	if err != nil {
+		t.Fatalf("loadModelConfig: %v", err)
+	}
+
+	p := NewCloudflareProvider("", "", providerModels(textModels, imageModel, providerCloudflare), 0, 0)
+	got, err := p.ListModels(context.Background())
+	if err != nil {
+		t.Fatalf("ListModels: %v", err)
+	}
+	want := []string{
+		"@cf/meta/llama-2-7b-chat-fp16",
+		"@cf/meta/llama-3-8b-instruct",
+		"@cf/stabilityai/stable-diffusion-xl-base-1.0",
+	}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("ListModels = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,224 @@
+package services
+
+import (
+	"ai-content-creation/models"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// apiKeyPrefix starts every API key, which tells them apart from access
+// tokens in the Authorization header.
+const apiKeyPrefix = "aic_"
+
+// prefixLength is how much of a key is stored in the clear and shown in
+// listings
+const prefixLength = len(apiKeyPrefix) + 8
+
+const (
+	ScopeContentRead   = "content:read"
+	ScopeGenerateWrite = "generate:write"
+)
+
+// apiKeyScopes maps each scope to the workspace role a workspace key's
+// creator needs to use it.
+var apiKeyScopes = map[string]models.WorkspaceRole{
+	ScopeContentRead:   models.WorkspaceViewer,
+	ScopeGenerateWrite: models.WorkspaceEditor,
+}
+
+var (
+	ErrInvalidAPIKey   = errors.New("invalid API key")
+	ErrAPIKeyNotFound  = errors.New("API key not found")
+	ErrInvalidScope    = errors.New("scopes must be content:read or generate:write")
+	ErrAPIKeyExpiry    = errors.New("expires_at must be in the future")
+	ErrAPIKeyWorkspace = errors.New("the workspace role does not allow these scopes")
+)
+
+// APIKeyInput is the caller-supplied part of a new API key.
+type APIKeyInput struct {
+	Name        string
+	WorkspaceID string // optional; the key then acts in this workspace
+	Scopes      []string
+	ExpiresAt   *time.Time // nil means the key never expires
+}
+
+type APIKeyService struct {
+	db               *gorm.DB
+	workspaceService *WorkspaceService
+}
+
+func NewAPIKeyService(db *gorm.DB, workspaceService *WorkspaceService) *APIKeyService {
+	return &APIKeyService{db: db, workspaceService: workspaceService}
+}
+
+// CreateAPIKey creates a key for the user and returns it along with the key
+// itself, which is not stored and can't be shown again.
+func (s *APIKeyService) CreateAPIKey(userID string, input APIKeyInput) (*models.APIKey, string, error) {
+	scopes, err := normalizeScopes(input.Scopes)
+	if err != nil {
+		return nil, "", err
+	}
+	if input.ExpiresAt != nil && !input.ExpiresAt.After(time.Now()) {
+		return nil, "", ErrAPIKeyExpiry
+	}
+	if input.WorkspaceID != "" {
+		if err := s.checkWorkspaceRole(userID, input.WorkspaceID, scopes); err != nil {
+			return nil, "", err
+		}
+	}
+
+	secret, err := randomToken()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to generate API key: %v", err)
+	}
+	key := apiKeyPrefix + secret
+
+	apiKey := models.APIKey{
+		KeyID:       uuid.New().String(),
+		UserID:      userID,
+		WorkspaceID: input.WorkspaceID,
+		Name:        strings.TrimSpace(input.Name),
+		Prefix:      key[:prefixLength],
+		KeyHash:     hashToken(key),
+		ExpiresAt:   input.ExpiresAt,
+	}
+	if err := apiKey.SetScopes(scopes); err != nil {
+		return nil, "", fmt.Errorf("failed to encode scopes: %v", err)
+	}
+
+	if err := s.db.Create(&apiKey).Error; err != nil {
+		return nil, "", fmt.Errorf("failed to create API key: %v", err)
+	}
+	return &apiKey, key, nil
+}
+
+// GetAPIKeys returns the user's keys, newest first.
+func (s *APIKeyService) GetAPIKeys(userID string) ([]models.APIKey, error) {
+	var keys []models.APIKey
+	if err := s.db.Where("user_id = ?", userID).Order("id DESC").Find(&keys).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch API keys: %v", err)
+	}
+	return keys, nil
+}
+
+// DeleteAPIKey revokes one of the user's keys.
+func (s *APIKeyService) DeleteAPIKey(userID string, keyID string) error {
+	res := s.db.Where("key_id = ? AND user_id = ?", keyID, userID).Delete(&models.APIKey{})
+	if res.Error != nil {
+		return fmt.Errorf("failed to delete API key: %v", res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// Authenticate checks that key is valid and has every one of scopes. Keys of
+// disabled accounts are invalid. For a workspace key the creator must still
+// have the role the scopes need there.
+func (s *APIKeyService) Authenticate(key string, scopes []string) (*models.APIKey, error) {
+	var apiKey models.APIKey
+	if err := s.db.Where("key_hash = ?", hashToken(key)).First(&apiKey).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidAPIKey
+		}
+		return nil, fmt.Errorf("failed to fetch API key: %v", err)
+	}
+
+	now := time.Now()
+	if apiKey.ExpiresAt != nil && now.After(*apiKey.ExpiresAt) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	var owner models.User
+	if err := s.db.Select("disabled_at").First(&owner, "user_id = ?", apiKey.UserID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidAPIKey
+		}
+		return nil, fmt.Errorf("failed to fetch user: %v", err)
+	}
+	if owner.DisabledAt != nil {
+		return nil, ErrInvalidAPIKey
+	}
+
+	granted, err := apiKey.GetScopes()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse scopes: %v", err)
+	}
+	for _, scope := range scopes {
+		if !containsString(granted, scope) {
+			return nil, &MissingScopeError{Scope: scope}
+		}
+	}
+
+	if apiKey.WorkspaceID != "" {
+		if err := s.checkWorkspaceRole(apiKey.UserID, apiKey.WorkspaceID, scopes); err != nil {
+			return nil, err
+		}
+	}
+
+	// A minute's precision is plenty and saves a write on most requests
+	if apiKey.LastUsedAt == nil || now.Sub(*apiKey.LastUsedAt) > time.Minute {
+		if err := s.db.Model(&apiKey).Update("last_used_at", &now).Error; err != nil {
+			log.Printf("Failed to update API key %s last used time: %v", apiKey.KeyID, err)
+		}
+	}
+
+	return &apiKey, nil
+}
+
+// checkWorkspaceRole returns ErrAPIKeyWorkspace unless the user's role in the
+// workspace allows every scope, or ErrWorkspaceNotFound if they aren't a
+// member.
+func (s *APIKeyService) checkWorkspaceRole(userID string, workspaceID string, scopes []string) error {
+	membership, err := s.workspaceService.GetMembership(workspaceID, userID)
+	if err != nil {
+		return err
+	}
+	for _, scope := range scopes {
+		if !HasRole(membership.Role, apiKeyScopes[scope]) {
+			return ErrAPIKeyWorkspace
+		}
+	}
+	return nil
+}
+
+// normalizeScopes de-duplicates scopes, rejecting unknown ones and empty
+// lists.
+func normalizeScopes(scopes []string) ([]string, error) {
+	normalized := []string{}
+	for _, scope := range scopes {
+		scope = strings.ToLower(strings.TrimSpace(scope))
+		if _, ok := apiKeyScopes[scope]; !ok {
+			return nil, ErrInvalidScope
+		}
+		if !containsString(normalized, scope) {
+			normalized = append(normalized, scope)
+		}
+	}
+	if len(normalized) == 0 {
+		return nil, ErrInvalidScope
+	}
+	return normalized, nil
+}
+
+// isAPIKey reports whether a bearer token is an API key rather than an
+// access token.
+func isAPIKey(token string) bool {
+	return strings.HasPrefix(token, apiKeyPrefix)
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
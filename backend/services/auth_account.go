@@ -0,0 +1,198 @@
+package services
+
+import (
+	"ai-content-creation/models"
+	"errors"
+	"fmt"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidAccountToken  = errors.New("invalid or expired token")
+	ErrEmailAlreadyVerified = errors.New("email address is already verified")
+)
+
+// SendVerificationEmail emails the user a link to verify their address,
+// replacing any link sent before.
+func (s *AuthService) SendVerificationEmail(userID string) error {
+	var user models.User
+	if err := s.db.First(&user, "user_id = ?", userID).Error; err != nil {
+		return fmt.Errorf("user not found")
+	}
+	if user.EmailVerifiedAt != nil {
+		return ErrEmailAlreadyVerified
+	}
+
+	token, err := s.issueAccountToken(user.UserID, models.VerifyEmailToken, s.verifyTTL)
+	if err != nil {
+		return err
+	}
+
+	return s.mailer.Send(Email{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Hi %s,\n\nPlease verify your email address by opening this link:\n\n%s/verify-email?token=%s\n\nThe link expires in %s.\n",
+			user.Name, s.frontendURL, token, formatTTL(s.verifyTTL)),
+	})
+}
+
+// VerifyEmail marks the address of the token's user as verified.
+func (s *AuthService) VerifyEmail(token string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		accountToken, err := consumeAccountToken(tx, token, models.VerifyEmailToken)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		return tx.Model(&models.User{}).
+			Where("user_id = ? AND email_verified_at IS NULL", accountToken.UserID).
+			Update("email_verified_at", &now).Error
+	})
+}
+
+// ForgotPassword emails a password reset link if an account exists for the
+// address. Unknown addresses succeed silently so that the endpoint can't be
+// used to discover accounts.
+func (s *AuthService) ForgotPassword(email string) error {
+	var user models.User
+	if err := s.db.Where("LOWER(email) = ?", normalizeEmail(email)).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return fmt.Errorf("failed to fetch user: %v", err)
+	}
+
+	token, err := s.issueAccountToken(user.UserID, models.ResetPasswordToken, s.resetTTL)
+	if err != nil {
+		return err
+	}
+
+	return s.mailer.Send(Email{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\nSomeone asked to reset the password for your account. If it was you, open this link:\n\n%s/reset-password?token=%s\n\nThe link expires in %s. If you didn't ask for this you can ignore this email.\n",
+			user.Name, s.frontendURL, token, formatTTL(s.resetTTL)),
+	})
+}
+
+// ResetPassword sets a new password using a reset token and signs the user
+// out of every session. Receiving the email also proves the address, so an
+// unverified account becomes verified.
+func (s *AuthService) ResetPassword(token, password string) error {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %v", err)
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		accountToken, err := consumeAccountToken(tx, token, models.ResetPasswordToken)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		if err := tx.Model(&models.User{}).
+			Where("user_id = ?", accountToken.UserID).
+			Update("password", string(hashedPassword)).Error; err != nil {
+			return fmt.Errorf("failed to update password: %v", err)
+		}
+		if err := tx.Model(&models.User{}).
+			Where("user_id = ? AND email_verified_at IS NULL", accountToken.UserID).
+			Update("email_verified_at", &now).Error; err != nil {
+			return fmt.Errorf("failed to verify email: %v", err)
+		}
+
+		if err := tx.Model(&models.Session{}).
+			Where("user_id = ? AND revoked_at IS NULL", accountToken.UserID).
+			Update("revoked_at", &now).Error; err != nil {
+			return fmt.Errorf("failed to revoke sessions: %v", err)
+		}
+		return nil
+	})
+}
+
+// IsEmailVerified reports whether the user has verified their address.
+func (s *AuthService) IsEmailVerified(userID string) (bool, error) {
+	var user models.User
+	if err := s.db.Select("email_verified_at").First(&user, "user_id = ?", userID).Error; err != nil {
+		return false, fmt.Errorf("user not found")
+	}
+	return user.EmailVerifiedAt != nil, nil
+}
+
+// issueAccountToken creates a token for purpose and invalidates any earlier
+// unused token for the same purpose, so only the latest email works.
+func (s *AuthService) issueAccountToken(userID string, purpose models.AccountTokenPurpose, ttl time.Duration) (string, error) {
+	token, err := randomToken()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate token: %v", err)
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		if err := tx.Model(&models.AccountToken{}).
+			Where("user_id = ? AND purpose = ? AND used_at IS NULL", userID, purpose).
+			Update("used_at", &now).Error; err != nil {
+			return fmt.Errorf("failed to invalidate previous tokens: %v", err)
+		}
+
+		return tx.Create(&models.AccountToken{
+			TokenHash: hashToken(token),
+			UserID:    userID,
+			Purpose:   purpose,
+			ExpiresAt: now.Add(ttl),
+		}).Error
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// consumeAccountToken marks an unexpired, unused token for purpose as used.
+func consumeAccountToken(tx *gorm.DB, token string, purpose models.AccountTokenPurpose) (*models.AccountToken, error) {
+	var accountToken models.AccountToken
+	if err := tx.Where("token_hash = ? AND purpose = ?", hashToken(token), purpose).First(&accountToken).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidAccountToken
+		}
+		return nil, fmt.Errorf("failed to fetch token: %v", err)
+	}
+
+	now := time.Now()
+	if accountToken.UsedAt != nil || now.After(accountToken.ExpiresAt) {
+		return nil, ErrInvalidAccountToken
+	}
+
+	// Only one concurrent use of the same token can win
+	res := tx.Model(&models.AccountToken{}).
+		Where("id = ? AND used_at IS NULL", accountToken.ID).
+		Update("used_at", &now)
+	if res.Error != nil {
+		return nil, fmt.Errorf("failed to use token: %v", res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return nil, ErrInvalidAccountToken
+	}
+
+	return &accountToken, nil
+}
+
+// formatTTL renders a link lifetime for an email, e.g. "48 hours".
+func formatTTL(d time.Duration) string {
+	switch {
+	case d >= time.Hour && d%time.Hour == 0:
+		if d == time.Hour {
+			return "1 hour"
+		}
+		return fmt.Sprintf("%d hours", d/time.Hour)
+	case d >= time.Minute && d%time.Minute == 0:
+		return fmt.Sprintf("%d minutes", d/time.Minute)
+	default:
+		return d.String()
+	}
+}
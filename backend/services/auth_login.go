@@ -0,0 +1,232 @@
+package services
+
+import (
+	"ai-content-creation/models"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrAccountDisabled    = errors.New("account has been disabled")
+	ErrSessionNotFound    = errors.New("session not found")
+)
+
+// sessionHistory is how long signed-out sessions stay in the sessions list.
+const sessionHistory = 30 * 24 * time.Hour
+
+// LoginClient describes where a sign-in comes from.
+type LoginClient struct {
+	IP        string
+	UserAgent string
+}
+
+// loginThrottle decides when failed sign-ins slow down or lock out further
+// attempts.
+type loginThrottle struct {
+	threshold   int // failures per email before a lockout
+	ipThreshold int // failures per IP before a lockout
+	lockout     time.Duration
+}
+
+// check returns how long the client has to wait before it may try to sign in
+// as email, or zero if it may try now.
+func (t loginThrottle) check(db *gorm.DB, email string, ip string) (time.Duration, error) {
+	since := time.Now().Add(-t.lockout)
+
+	// A successful sign-in forgives the failures for its email but not for
+	// the IP, which may be guessing at many accounts
+	var lastSuccess models.LoginEvent
+	err := db.Where("email = ? AND result = ? AND created_at > ?", email, models.LoginSucceeded, since).
+		Order("id DESC").Limit(1).Find(&lastSuccess).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch login events: %v", err)
+	}
+	emailSince := since
+	if lastSuccess.ID != 0 {
+		emailSince = lastSuccess.CreatedAt
+	}
+
+	wait, err := t.wait(db.Where("email = ? AND created_at > ?", email, emailSince), t.threshold)
+	if err != nil || wait > 0 {
+		return wait, err
+	}
+	return t.wait(db.Where("ip = ? AND created_at > ?", ip, since), t.ipThreshold)
+}
+
+// wait applies threshold to the failures matched by scope. The first third of
+// the threshold is free; after that each failure doubles the delay before the
+// next attempt, starting at one second. Reaching the threshold locks the
+// client out until the lockout has passed since the last failure.
+func (t loginThrottle) wait(scope *gorm.DB, threshold int) (time.Duration, error) {
+	if threshold <= 0 {
+		return 0, nil
+	}
+
+	var failures []models.LoginEvent
+	err := scope.Where("result = ?", models.LoginFailed).
+		Select("id", "created_at").Order("id DESC").Limit(threshold).Find(&failures).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to fetch login events: %v", err)
+	}
+	if len(failures) == 0 {
+		return 0, nil
+	}
+
+	delay := t.lockout
+	if len(failures) < threshold {
+		free := threshold / 3
+		if len(failures) < free {
+			return 0, nil
+		}
+		if shift := len(failures) - free; shift < 32 && time.Second<<shift < t.lockout {
+			delay = time.Second << shift
+		}
+	}
+
+	wait := time.Until(failures[0].CreatedAt.Add(delay))
+	if wait < 0 {
+		return 0, nil
+	}
+	return wait, nil
+}
+
+var (
+	dummyHashOnce sync.Once
+	dummyHash     []byte
+)
+
+// compareDummyPassword spends as long as checking a real password, so that
+// response times don't reveal which emails have accounts.
+func compareDummyPassword(password string) {
+	dummyHashOnce.Do(func() {
+		dummyHash, _ = bcrypt.GenerateFromPassword([]byte("not a password"), bcrypt.DefaultCost)
+	})
+	bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+}
+
+// LoginUser signs a user in with their password. Failed attempts are counted
+// per email and per IP; once there are too many, attempts are refused with
+// LoginThrottledError without checking the password.
+func (s *AuthService) LoginUser(email, password string, client LoginClient) (*models.User, *Tokens, error) {
+	email = normalizeEmail(email)
+	event := models.LoginEvent{
+		Email:     email,
+		IP:        client.IP,
+		UserAgent: client.UserAgent,
+	}
+
+	wait, err := s.throttle.check(s.db, event.Email, event.IP)
+	if err != nil {
+		return nil, nil, err
+	}
+	if wait > 0 {
+		event.Result = models.LoginThrottled
+		if err := s.recordLogin(&event); err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, &LoginThrottledError{RetryAfter: wait}
+	}
+
+	// Find user
+	var user models.User
+	err = s.db.Where("LOWER(email) = ?", email).First(&user).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil, fmt.Errorf("failed to fetch user: %v", err)
+	}
+
+	// Check password
+	if err != nil {
+		compareDummyPassword(password)
+	} else {
+		event.UserID = user.UserID
+		err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password))
+	}
+	if err != nil {
+		event.Result = models.LoginFailed
+		if err := s.recordLogin(&event); err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, ErrInvalidCredentials
+	}
+
+	// Only tell someone who knows the password that the account is disabled
+	if user.DisabledAt != nil {
+		event.Result = models.LoginDisabled
+		if err := s.recordLogin(&event); err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, ErrAccountDisabled
+	}
+
+	event.Result = models.LoginSucceeded
+	if err := s.recordLogin(&event); err != nil {
+		return nil, nil, err
+	}
+
+	tokens, err := s.startSession(user.UserID, client)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &user, tokens, nil
+}
+
+func (s *AuthService) recordLogin(event *models.LoginEvent) error {
+	if event.Result != models.LoginSucceeded {
+		log.Printf("Sign-in for %s from %s refused: %s", event.Email, event.IP, event.Result)
+	}
+	if err := s.db.Create(event).Error; err != nil {
+		return fmt.Errorf("failed to record login: %v", err)
+	}
+	return nil
+}
+
+// UserSession is a session along with whether it can still be used.
+type UserSession struct {
+	models.Session
+	Active bool
+}
+
+// GetSessions returns the user's active sessions and the ones that ended in
+// the last 30 days, newest first. A session ends when it is revoked or its
+// refresh token expires unused.
+func (s *AuthService) GetSessions(userID string) ([]UserSession, error) {
+	now := time.Now()
+	cutoff := now.Add(-sessionHistory)
+
+	var sessions []models.Session
+	err := s.db.Where("user_id = ? AND (revoked_at > ? OR (revoked_at IS NULL AND last_used_at > ?))",
+		userID, cutoff, cutoff.Add(-s.refreshTTL)).
+		Order("id DESC").Find(&sessions).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch sessions: %v", err)
+	}
+
+	result := make([]UserSession, len(sessions))
+	for i, session := range sessions {
+		result[i] = UserSession{
+			Session: session,
+			Active:  session.RevokedAt == nil && now.Before(session.LastUsedAt.Add(s.refreshTTL)),
+		}
+	}
+	return result, nil
+}
+
+// RevokeSession signs one of the user's sessions out.
+func (s *AuthService) RevokeSession(userID string, sessionID string) error {
+	var session models.Session
+	if err := s.db.Where("session_id = ? AND user_id = ?", sessionID, userID).First(&session).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrSessionNotFound
+		}
+		return fmt.Errorf("failed to fetch session: %v", err)
+	}
+	return revokeSession(s.db, session.SessionID)
+}
@@ -0,0 +1,146 @@
+package services
+
+import (
+	"ai-content-creation/models"
+	"errors"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+func addLoginEvents(t *testing.T, db *gorm.DB, email, ip string, result models.LoginResult, at ...time.Time) {
+	t.Helper()
+	for _, createdAt := range at {
+		event := models.LoginEvent{Email: email, IP: ip, Result: result}
+		event.CreatedAt = createdAt
+		if err := db.Create(&event).Error; err != nil {
+			t.Fatalf("create login event: %v", err)
+		}
+	}
+}
+
+// failuresAt returns n times, a second apart, the last of them at last.
+func failuresAt(n int, last time.Time) []time.Time {
+	times := make([]time.Time, n)
+	for i := range times {
+		times[i] = last.Add(-time.Duration(n-1-i) * time.Second)
+	}
+	return times
+}
+
+func assertWait(t *testing.T, got, want time.Duration) {
+	t.Helper()
+	// The check runs slightly after the last failure was recorded
+	if got > want || got < want-time.Second {
+		t.Errorf("wait = %s, want just under %s", got, want)
+	}
+}
+
+func TestLoginThrottleDelays(t *testing.T) {
+	throttle := loginThrottle{threshold: 9, ipThreshold: 100, lockout: 15 * time.Minute}
+
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, 0},
+		{2, 0}, // a third of the threshold is free
+		{3, time.Second},
+		{4, 2 * time.Second},
+		{8, 32 * time.Second},
+		{9, 15 * time.Minute}, // locked out
+		{20, 15 * time.Minute},
+	}
+	for _, tt := range tests {
+		db := newTestDB(t)
+		addLoginEvents(t, db, "a@example.com", "203.0.113.1", models.LoginFailed, failuresAt(tt.failures, time.Now())...)
+
+		wait, err := throttle.check(db, "a@example.com", "203.0.113.1")
+		if err != nil {
+			t.Fatalf("check: %v", err)
+		}
+		if tt.want == 0 {
+			if wait != 0 {
+				t.Errorf("%d failures: wait = %s, want 0", tt.failures, wait)
+			}
+			continue
+		}
+		assertWait(t, wait, tt.want)
+	}
+}
+
+func TestLoginThrottleLockoutExpires(t *testing.T) {
+	throttle := loginThrottle{threshold: 9, ipThreshold: 100, lockout: 15 * time.Minute}
+	db := newTestDB(t)
+
+	// Locked out until 15 minutes after the last failure
+	addLoginEvents(t, db, "a@example.com", "203.0.113.1", models.LoginFailed, failuresAt(9, time.Now().Add(-10*time.Minute))...)
+	wait, err := throttle.check(db, "a@example.com", "203.0.113.1")
+	if err != nil {
+		t.Fatalf("check: %v", err)
+	}
+	assertWait(t, wait, 5*time.Minute)
+
+	// Failures older than the lockout don't count
+	db = newTestDB(t)
+	addLoginEvents(t, db, "a@example.com", "203.0.113.1", models.LoginFailed, failuresAt(9, time.Now().Add(-16*time.Minute))...)
+	if wait, err := throttle.check(db, "a@example.com", "203.0.113.1"); err != nil || wait != 0 {
+		t.Fatalf("check = %s, %v, want 0", wait, err)
+	}
+}
+
+func TestLoginThrottleSuccessForgivesEmailNotIP(t *testing.T) {
+	throttle := loginThrottle{threshold: 9, ipThreshold: 9, lockout: 15 * time.Minute}
+	db := newTestDB(t)
+
+	now := time.Now()
+	addLoginEvents(t, db, "a@example.com", "203.0.113.1", models.LoginFailed, failuresAt(9, now.Add(-2*time.Second))...)
+	addLoginEvents(t, db, "a@example.com", "198.51.100.7", models.LoginSucceeded, now.Add(-time.Second))
+
+	if wait, err := throttle.check(db, "a@example.com", "198.51.100.7"); err != nil || wait != 0 {
+		t.Fatalf("email after success: check = %s, %v, want 0", wait, err)
+	}
+
+	// The IP that made the failures is still locked out, whatever the email
+	wait, err := throttle.check(db, "b@example.com", "203.0.113.1")
+	if err != nil {
+		t.Fatalf("check: %v", err)
+	}
+	assertWait(t, wait, 15*time.Minute-2*time.Second)
+}
+
+func TestLoginUserThrottled(t *testing.T) {
+	t.Setenv("LOGIN_LOCKOUT_THRESHOLD", "3")
+	s := newTestAuthService(t)
+	user := createTestUser(t, s.db, "u1", 0)
+	hash, err := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.db.Model(user).Update("password", string(hash))
+
+	client := LoginClient{IP: "203.0.113.1"}
+	if _, _, err := s.LoginUser(user.Email, "wrong", client); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("LoginUser(wrong password) = %v, want ErrInvalidCredentials", err)
+	}
+
+	// The password isn't checked while throttled, and the email's case and
+	// spacing don't escape the throttle
+	_, _, err = s.LoginUser("  U1@Example.COM ", "correct horse", client)
+	var throttled *LoginThrottledError
+	if !errors.As(err, &throttled) {
+		t.Fatalf("LoginUser while throttled = %v, want LoginThrottledError", err)
+	}
+	assertWait(t, throttled.RetryAfter, time.Second)
+
+	var events []models.LoginEvent
+	s.db.Order("id").Find(&events)
+	if len(events) != 2 || events[0].Result != models.LoginFailed || events[1].Result != models.LoginThrottled {
+		t.Fatalf("recorded events %+v, want a failure then a throttled attempt", events)
+	}
+	if events[1].Email != user.Email {
+		t.Errorf("throttled attempt recorded for %q, want %q", events[1].Email, user.Email)
+	}
+}
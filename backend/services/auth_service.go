@@ -4,6 +4,7 @@ import (
 	"ai-content-creation/models"
 	"errors"
 	"fmt"
+	"log"
 	"net/http"
 	"os"
 	"strings"
@@ -17,7 +18,15 @@ import (
 )
 
 type AuthService struct {
-	db *gorm.DB
+	db            *gorm.DB
+	creditService *CreditService
+	mailer        Mailer
+	frontendURL   string
+	accessTTL     time.Duration
+	refreshTTL    time.Duration
+	verifyTTL     time.Duration
+	resetTTL      time.Duration
+	throttle      loginThrottle
 }
 
 type LoginRequest struct {
@@ -31,72 +40,104 @@ type RegisterRequest struct {
 	Password string `json:"password" binding:"required,min=6"`
 }
 
-func NewAuthService(db *gorm.DB) *AuthService {
-	return &AuthService{db: db}
+// NewAuthService creates the auth service. Access tokens live for
+// ACCESS_TOKEN_TTL (default 15m) and refresh tokens for REFRESH_TOKEN_TTL
+// (default 30 days) from their last rotation. Emailed links point at
+// FRONTEND_URL and expire after EMAIL_VERIFICATION_TTL (default 48h) or
+// PASSWORD_RESET_TTL (default 1h). Sign-ins are locked out for
+// LOGIN_LOCKOUT_DURATION (default 15m) after LOGIN_LOCKOUT_THRESHOLD (default
+// 10) failures for an email or LOGIN_IP_LOCKOUT_THRESHOLD (default 50) from an
+// IP within that time.
+func NewAuthService(db *gorm.DB, creditService *CreditService, mailer Mailer) *AuthService {
+	return &AuthService{
+		db:            db,
+		creditService: creditService,
+		mailer:        mailer,
+		frontendURL:   os.Getenv("FRONTEND_URL"),
+		accessTTL:     envDuration("ACCESS_TOKEN_TTL", 15*time.Minute),
+		refreshTTL:    envDuration("REFRESH_TOKEN_TTL", 30*24*time.Hour),
+		verifyTTL:     envDuration("EMAIL_VERIFICATION_TTL", 48*time.Hour),
+		resetTTL:      envDuration("PASSWORD_RESET_TTL", time.Hour),
+		throttle: loginThrottle{
+			threshold:   envInt("LOGIN_LOCKOUT_THRESHOLD", 10),
+			ipThreshold: envInt("LOGIN_IP_LOCKOUT_THRESHOLD", 50),
+			lockout:     envDuration("LOGIN_LOCKOUT_DURATION", 15*time.Minute),
+		},
+	}
 }
 
-func (s *AuthService) RegisterUser(name, email, password string) (*models.User, string, error) {
+func (s *AuthService) RegisterUser(name, email, password string, client LoginClient) (*models.User, *Tokens, error) {
+	email = normalizeEmail(email)
+
 	// Check if user already exists
 	var existingUser models.User
-	if err := s.db.Where("email = ?", email).First(&existingUser).Error; err == nil {
-		return nil, "", errors.New("user already exists")
+	if err := s.db.Where("LOWER(email) = ?", email).First(&existingUser).Error; err == nil {
+		return nil, nil, errors.New("user already exists")
 	}
 
 	// Hash password
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
-		return nil, "", fmt.Errorf("failed to hash password: %v", err)
+		return nil, nil, fmt.Errorf("failed to hash password: %v", err)
+	}
+
+	// Create user with the free plan's monthly credits
+	var plan models.SubscriptionPlan
+	if err := s.db.Where("tier = ?", models.FreeTier).First(&plan).Error; err != nil {
+		return nil, nil, fmt.Errorf("plan not found: %v", err)
 	}
 
-	// Create user
+	resetAt := time.Now().AddDate(0, 1, 0)
 	user := models.User{
 		UserID:           strings.Replace(uuid.New().String(), "-", "", -1),
 		Name:             name,
 		Email:            email,
 		Password:         string(hashedPassword),
 		SubscriptionTier: models.FreeTier,
-		RemainingCredits: 200,
-	}
-
-	if err := s.db.Create(&user).Error; err != nil {
-		return nil, "", fmt.Errorf("failed to create user: %v", err)
+		CreditsResetAt:   &resetAt,
 	}
 
-	// Generate token
-	token, err := s.generateToken(user.UserID)
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&user).Error; err != nil {
+			return fmt.Errorf("failed to create user: %v", err)
+		}
+		return s.creditService.WithTx(tx).Grant(user.UserID, plan.MonthlyCredits, "signup")
+	})
 	if err != nil {
-		return nil, "", fmt.Errorf("failed to generate token: %v", err)
+		return nil, nil, err
 	}
+	user.RemainingCredits = plan.MonthlyCredits
 
-	return &user, token, nil
-}
-
-func (s *AuthService) LoginUser(email, password string) (*models.User, string, error) {
-	// Find user
-	var user models.User
-	if err := s.db.Where("email = ?", email).First(&user).Error; err != nil {
-		return nil, "", errors.New("invalid credentials")
+	// A delivery failure shouldn't fail the registration; the user can ask
+	// for the email again
+	if err := s.SendVerificationEmail(user.UserID); err != nil {
+		log.Printf("Failed to send verification email to user %s: %v", user.UserID, err)
 	}
 
-	// Check password
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
-		return nil, "", errors.New("invalid credentials")
-	}
-
-	// Generate token
-	token, err := s.generateToken(user.UserID)
+	// Sign the new user in
+	tokens, err := s.startSession(user.UserID, client)
 	if err != nil {
-		return nil, "", fmt.Errorf("failed to generate token: %v", err)
+		return nil, nil, err
 	}
 
-	return &user, token, nil
+	return &user, tokens, nil
+}
+
+// normalizeEmail ignores case and surrounding whitespace. Accounts created
+// before emails were normalized may be stored with capitals, so look users up
+// with LOWER(email).
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
 }
 
-func (s *AuthService) generateToken(userID string) (string, error) {
+func (s *AuthService) generateToken(userID string, sessionID string) (string, time.Time, error) {
+	now := time.Now()
+	expiresAt := now.Add(s.accessTTL)
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
 		"sub": userID,
-		"exp": time.Now().Add(time.Hour * 24 * 7).Unix(), // 7 days
-		"iat": time.Now().Unix(),
+		"sid": sessionID,
+		"exp": expiresAt.Unix(),
+		"iat": now.Unix(),
 	})
 
 	// Get JWT secret from environment variable
@@ -105,10 +146,17 @@ func (s *AuthService) generateToken(userID string) (string, error) {
 		secret = "your-256-bit-secret" // Default secret for development
 	}
 
-	return token.SignedString([]byte(secret))
+	signed, err := token.SignedString([]byte(secret))
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return signed, expiresAt, nil
 }
 
-func (s *AuthService) ValidateToken(tokenString string) (string, error) {
+// ValidateToken checks an access token's signature and expiry and returns
+// the user and session it names. Authenticate also checks that the session
+// hasn't been revoked.
+func (s *AuthService) ValidateToken(tokenString string) (string, string, error) {
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
@@ -123,20 +171,25 @@ func (s *AuthService) ValidateToken(tokenString string) (string, error) {
 	})
 
 	if err != nil {
-		return "", err
+		return "", "", err
 	}
 
 	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		if sub, ok := claims["sub"].(string); ok {
-			return sub, nil
+		sub, subOK := claims["sub"].(string)
+		sid, sidOK := claims["sid"].(string)
+		if subOK && sidOK {
+			return sub, sid, nil
 		}
 	}
 
-	return "", errors.New("invalid token claims")
+	return "", "", errors.New("invalid token claims")
 }
 
-// AuthMiddleware is a Gin middleware to validate JWT tokens
-func AuthMiddleware() gin.HandlerFunc {
+// AuthMiddleware is a Gin middleware to validate JWT tokens. Routes that name
+// scopes also accept API keys with all of those scopes; other routes only
+// accept access tokens. A workspace API key puts its workspace in the context
+// as workspaceID, so the route works on that workspace's content.
+func AuthMiddleware(scopes ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
@@ -150,15 +203,66 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
+		if isAPIKey(tokenParts[1]) {
+			authenticateAPIKey(c, tokenParts[1], scopes)
+			return
+		}
+
 		authService := c.MustGet("authService").(*AuthService)
-		userID, err := authService.ValidateToken(tokenParts[1])
+		userID, sessionID, err := authService.Authenticate(tokenParts[1])
 		if err != nil {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
 			return
 		}
 
-		// Set user ID in context
+		// Set user and session ID in context
 		c.Set("userID", userID)
+		c.Set("sessionID", sessionID)
 		c.Next()
 	}
-} 
+}
+
+func authenticateAPIKey(c *gin.Context, key string, scopes []string) {
+	if len(scopes) == 0 {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "API keys cannot be used for this endpoint"})
+		return
+	}
+
+	apiKeyService := c.MustGet("apiKeyService").(*APIKeyService)
+	apiKey, err := apiKeyService.Authenticate(key, scopes)
+	if err != nil {
+		var missingScope *MissingScopeError
+		switch {
+		case errors.As(err, &missingScope), errors.Is(err, ErrAPIKeyWorkspace), errors.Is(err, ErrWorkspaceNotFound):
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		default:
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
+		}
+		return
+	}
+
+	c.Set("userID", apiKey.UserID)
+	c.Set("apiKeyID", apiKey.KeyID)
+	if apiKey.WorkspaceID != "" {
+		c.Set("workspaceID", apiKey.WorkspaceID)
+	}
+	c.Next()
+}
+
+// VerifiedEmailMiddleware rejects users who haven't verified their email
+// address yet. It must run after AuthMiddleware.
+func VerifiedEmailMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		authService := c.MustGet("authService").(*AuthService)
+		verified, err := authService.IsEmailVerified(c.GetString("userID"))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+			return
+		}
+		if !verified {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Email address has not been verified"})
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,224 @@
+package services
+
+import (
+	"ai-content-creation/models"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token has already been used")
+	ErrSessionRevoked      = errors.New("session has been revoked")
+)
+
+// Tokens is what a client receives when it signs in or refreshes. The access
+// token is a short-lived JWT; the refresh token is an opaque random string
+// that can be exchanged exactly once for a new pair.
+type Tokens struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresAt    time.Time // when AccessToken expires
+}
+
+// startSession signs a user in on a new session.
+func (s *AuthService) startSession(userID string, client LoginClient) (*Tokens, error) {
+	session := models.Session{
+		SessionID:  uuid.New().String(),
+		UserID:     userID,
+		IP:         client.IP,
+		UserAgent:  client.UserAgent,
+		LastUsedAt: time.Now(),
+	}
+
+	var tokens *Tokens
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&session).Error; err != nil {
+			return fmt.Errorf("failed to create session: %v", err)
+		}
+		var err error
+		tokens, err = s.issueTokens(tx, &session)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// RefreshTokens exchanges a refresh token for a new access and refresh token.
+// Presenting a refresh token that was already exchanged means it has leaked,
+// so the whole session is revoked and ErrRefreshTokenReused is returned.
+func (s *AuthService) RefreshTokens(refreshToken string) (*Tokens, error) {
+	var tokens *Tokens
+	var reusedSession string
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		stored, session, err := findRefreshToken(tx, refreshToken)
+		if err != nil {
+			return err
+		}
+		if session.RevokedAt != nil {
+			return ErrSessionRevoked
+		}
+		if stored.UsedAt != nil {
+			reusedSession = session.SessionID
+			return ErrRefreshTokenReused
+		}
+
+		now := time.Now()
+		if now.After(stored.ExpiresAt) {
+			return ErrInvalidRefreshToken
+		}
+
+		// Only one concurrent exchange of the same token can win
+		res := tx.Model(&models.RefreshToken{}).
+			Where("id = ? AND used_at IS NULL", stored.ID).
+			Update("used_at", &now)
+		if res.Error != nil {
+			return fmt.Errorf("failed to rotate refresh token: %v", res.Error)
+		}
+		if res.RowsAffected == 0 {
+			reusedSession = session.SessionID
+			return ErrRefreshTokenReused
+		}
+
+		if err := tx.Model(session).Update("last_used_at", now).Error; err != nil {
+			return fmt.Errorf("failed to update session: %v", err)
+		}
+
+		tokens, err = s.issueTokens(tx, session)
+		return err
+	})
+
+	// The transaction was rolled back, so revoke separately
+	if reusedSession != "" {
+		log.Printf("Refresh token reuse detected, revoking session %s", reusedSession)
+		if revokeErr := revokeSession(s.db, reusedSession); revokeErr != nil {
+			log.Printf("Failed to revoke session %s: %v", reusedSession, revokeErr)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// Logout revokes the session a refresh token belongs to. Logging out of an
+// already revoked session succeeds.
+func (s *AuthService) Logout(refreshToken string) error {
+	_, session, err := findRefreshToken(s.db, refreshToken)
+	if err != nil {
+		return err
+	}
+	if session.RevokedAt != nil {
+		return nil
+	}
+	return revokeSession(s.db, session.SessionID)
+}
+
+// Authenticate validates an access token and checks that its session is
+// still active, returning the user and session it belongs to.
+func (s *AuthService) Authenticate(tokenString string) (string, string, error) {
+	userID, sessionID, err := s.ValidateToken(tokenString)
+	if err != nil {
+		return "", "", err
+	}
+
+	var session models.Session
+	if err := s.db.Where("session_id = ?", sessionID).First(&session).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", "", ErrSessionRevoked
+		}
+		return "", "", fmt.Errorf("failed to fetch session: %v", err)
+	}
+	if session.RevokedAt != nil || session.UserID != userID {
+		return "", "", ErrSessionRevoked
+	}
+
+	return userID, sessionID, nil
+}
+
+// issueTokens creates a new refresh token for the session and a matching
+// access token.
+func (s *AuthService) issueTokens(tx *gorm.DB, session *models.Session) (*Tokens, error) {
+	refreshToken, err := randomToken()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate refresh token: %v", err)
+	}
+
+	stored := models.RefreshToken{
+		TokenHash: hashToken(refreshToken),
+		SessionID: session.SessionID,
+		ExpiresAt: time.Now().Add(s.refreshTTL),
+	}
+	if err := tx.Create(&stored).Error; err != nil {
+		return nil, fmt.Errorf("failed to store refresh token: %v", err)
+	}
+
+	accessToken, expiresAt, err := s.generateToken(session.UserID, session.SessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate token: %v", err)
+	}
+
+	return &Tokens{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresAt:    expiresAt,
+	}, nil
+}
+
+func findRefreshToken(tx *gorm.DB, refreshToken string) (*models.RefreshToken, *models.Session, error) {
+	var stored models.RefreshToken
+	if err := tx.Where("token_hash = ?", hashToken(refreshToken)).First(&stored).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrInvalidRefreshToken
+		}
+		return nil, nil, fmt.Errorf("failed to fetch refresh token: %v", err)
+	}
+
+	var session models.Session
+	if err := tx.Where("session_id = ?", stored.SessionID).First(&session).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrInvalidRefreshToken
+		}
+		return nil, nil, fmt.Errorf("failed to fetch session: %v", err)
+	}
+
+	return &stored, &session, nil
+}
+
+func revokeSession(tx *gorm.DB, sessionID string) error {
+	now := time.Now()
+	if err := tx.Model(&models.Session{}).
+		Where("session_id = ? AND revoked_at IS NULL", sessionID).
+		Update("revoked_at", &now).Error; err != nil {
+		return fmt.Errorf("failed to revoke session: %v", err)
+	}
+	return nil
+}
+
+// randomToken returns 32 random bytes, URL-safe base64 encoded.
+func randomToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// hashToken is how opaque tokens are stored. They are long and random, so a
+// plain SHA-256 is enough; there is nothing to brute-force.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,119 @@
+package services
+
+import (
+	"errors"
+	"testing"
+)
+
+func newTestAuthService(t *testing.T) *AuthService {
+	t.Helper()
+	t.Setenv("JWT_SECRET", "test-secret")
+	db := newTestDB(t)
+	return NewAuthService(db, NewCreditService(db), NewLogMailer("", "noreply@example.com"))
+}
+
+func TestRefreshTokensRotates(t *testing.T) {
+	s := newTestAuthService(t)
+	createTestUser(t, s.db, "u1", 0)
+
+	first, err := s.startSession("u1", LoginClient{IP: "203.0.113.1"})
+	if err != nil {
+		t.Fatalf("startSession: %v", err)
+	}
+	second, err := s.RefreshTokens(first.RefreshToken)
+	if err != nil {
+		t.Fatalf("RefreshTokens: %v", err)
+	}
+	if second.RefreshToken == first.RefreshToken {
+		t.Fatal("refresh token was not rotated")
+	}
+	if _, _, err := s.Authenticate(second.AccessToken); err != nil {
+		t.Fatalf("Authenticate rotated access token: %v", err)
+	}
+	if _, err := s.RefreshTokens("not-a-token"); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Fatalf("RefreshTokens(unknown) = %v, want ErrInvalidRefreshToken", err)
+	}
+}
+
+func TestRefreshTokenReuseRevokesSession(t *testing.T) {
+	s := newTestAuthService(t)
+	createTestUser(t, s.db, "u1", 0)
+
+	first, err := s.startSession("u1", LoginClient{IP: "203.0.113.1"})
+	if err != nil {
+		t.Fatalf("startSession: %v", err)
+	}
+	second, err := s.RefreshTokens(first.RefreshToken)
+	if err != nil {
+		t.Fatalf("RefreshTokens: %v", err)
+	}
+
+	// Whoever holds the old token replays it
+	if _, err := s.RefreshTokens(first.RefreshToken); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("reused RefreshTokens = %v, want ErrRefreshTokenReused", err)
+	}
+
+	// Neither party can carry on with the session
+	if _, err := s.RefreshTokens(second.RefreshToken); !errors.Is(err, ErrSessionRevoked) {
+		t.Fatalf("RefreshTokens after reuse = %v, want ErrSessionRevoked", err)
+	}
+	if _, _, err := s.Authenticate(second.AccessToken); !errors.Is(err, ErrSessionRevoked) {
+		t.Fatalf("Authenticate after reuse = %v, want ErrSessionRevoked", err)
+	}
+
+	// Other sessions are unaffected
+	other, err := s.startSession("u1", LoginClient{IP: "198.51.100.7"})
+	if err != nil {
+		t.Fatalf("startSession: %v", err)
+	}
+	if _, err := s.RefreshTokens(other.RefreshToken); err != nil {
+		t.Fatalf("RefreshTokens on other session: %v", err)
+	}
+}
+
+func TestRefreshTokenConcurrentExchange(t *testing.T) {
+	s := newTestAuthService(t)
+	createTestUser(t, s.db, "u1", 0)
+
+	tokens, err := s.startSession("u1", LoginClient{})
+	if err != nil {
+		t.Fatalf("startSession: %v", err)
+	}
+
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, err := s.RefreshTokens(tokens.RefreshToken)
+			errs <- err
+		}()
+	}
+	var reused int
+	for i := 0; i < 2; i++ {
+		if err := <-errs; errors.Is(err, ErrRefreshTokenReused) {
+			reused++
+		} else if err != nil {
+			t.Fatalf("RefreshTokens: %v", err)
+		}
+	}
+	if reused != 1 {
+		t.Fatalf("%d exchanges were reuse, want exactly 1", reused)
+	}
+}
+
+func TestLogoutRevokesSession(t *testing.T) {
+	s := newTestAuthService(t)
+	createTestUser(t, s.db, "u1", 0)
+
+	tokens, err := s.startSession("u1", LoginClient{})
+	if err != nil {
+		t.Fatalf("startSession: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := s.Logout(tokens.RefreshToken); err != nil {
+			t.Fatalf("Logout: %v", err)
+		}
+	}
+	if _, err := s.RefreshTokens(tokens.RefreshToken); !errors.Is(err, ErrSessionRevoked) {
+		t.Fatalf("RefreshTokens after logout = %v, want ErrSessionRevoked", err)
+	}
+}
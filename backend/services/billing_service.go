@@ -0,0 +1,351 @@
+package services
+
+import (
+	"ai-content-creation/models"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrBillingNotConfigured = errors.New("billing is not configured")
+	ErrInvalidSignature     = errors.New("invalid webhook signature")
+	ErrNoBillingAccount     = errors.New("user has no billing account")
+	ErrPlanNotPurchasable   = errors.New("plan cannot be purchased")
+)
+
+// webhookTolerance is how old a signed webhook timestamp may be
+const webhookTolerance = 5 * time.Minute
+
+// BillingService connects users to Stripe subscriptions. Plans map to Stripe
+// prices through STRIPE_PRICE_PRO and STRIPE_PRICE_ENTERPRISE; tier changes
+// and credit grants happen only in response to verified webhooks.
+type BillingService struct {
+	db            *gorm.DB
+	client        BillingClient
+	creditService *CreditService
+	webhookSecret string
+	prices        map[models.SubscriptionTier]string
+	frontendURL   string
+}
+
+type stripeEvent struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+	Data struct {
+		Object json.RawMessage `json:"object"`
+	} `json:"data"`
+}
+
+type stripeCheckoutSession struct {
+	ID                string            `json:"id"`
+	Customer          string            `json:"customer"`
+	Subscription      string            `json:"subscription"`
+	ClientReferenceID string            `json:"client_reference_id"`
+	Metadata          map[string]string `json:"metadata"`
+}
+
+type stripePriceItems struct {
+	Data []struct {
+		Price struct {
+			ID string `json:"id"`
+		} `json:"price"`
+	} `json:"data"`
+}
+
+type stripeSubscription struct {
+	ID       string           `json:"id"`
+	Customer string           `json:"customer"`
+	Status   string           `json:"status"`
+	Items    stripePriceItems `json:"items"`
+}
+
+type stripeInvoice struct {
+	ID           string           `json:"id"`
+	Customer     string           `json:"customer"`
+	Subscription string           `json:"subscription"`
+	AmountPaid   int64            `json:"amount_paid"`
+	Lines        stripePriceItems `json:"lines"`
+}
+
+// NewBillingService creates the billing service. client may be nil when
+// Stripe isn't configured, in which case every operation returns
+// ErrBillingNotConfigured.
+func NewBillingService(db *gorm.DB, client BillingClient, creditService *CreditService) *BillingService {
+	return &BillingService{
+		db:            db,
+		client:        client,
+		creditService: creditService,
+		webhookSecret: os.Getenv("STRIPE_WEBHOOK_SECRET"),
+		prices: map[models.SubscriptionTier]string{
+			models.ProTier:        os.Getenv("STRIPE_PRICE_PRO"),
+			models.EnterpriseTier: os.Getenv("STRIPE_PRICE_ENTERPRISE"),
+		},
+		frontendURL: os.Getenv("FRONTEND_URL"),
+	}
+}
+
+// CreateCheckoutSession starts a Stripe Checkout for upgrading to tier,
+// creating the Stripe customer on first use.
+func (s *BillingService) CreateCheckoutSession(ctx context.Context, userID string, tier models.SubscriptionTier) (*CheckoutSession, error) {
+	if s.client == nil {
+		return nil, ErrBillingNotConfigured
+	}
+
+	priceID := s.prices[tier]
+	if priceID == "" {
+		return nil, ErrPlanNotPurchasable
+	}
+
+	var user models.User
+	if err := s.db.First(&user, "user_id = ?", userID).Error; err != nil {
+		return nil, fmt.Errorf("user not found")
+	}
+
+	if user.StripeCustomerID == "" {
+		customerID, err := s.client.CreateCustomer(ctx, CustomerParams{
+			Email:  user.Email,
+			Name:   user.Name,
+			UserID: user.UserID,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create customer: %v", err)
+		}
+		if err := s.db.Model(&user).Update("stripe_customer_id", customerID).Error; err != nil {
+			return nil, fmt.Errorf("failed to save customer: %v", err)
+		}
+		user.StripeCustomerID = customerID
+	}
+
+	session, err := s.client.CreateCheckoutSession(ctx, CheckoutParams{
+		CustomerID: user.StripeCustomerID,
+		PriceID:    priceID,
+		UserID:     user.UserID,
+		Tier:       string(tier),
+		SuccessURL: s.frontendURL + "/billing/success?session_id={CHECKOUT_SESSION_ID}",
+		CancelURL:  s.frontendURL + "/billing/cancel",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create checkout session: %v", err)
+	}
+
+	return session, nil
+}
+
+// CreatePortalSession returns a link to the Stripe customer portal where the
+// user can manage or cancel their subscription.
+func (s *BillingService) CreatePortalSession(ctx context.Context, userID string) (string, error) {
+	if s.client == nil {
+		return "", ErrBillingNotConfigured
+	}
+
+	var user models.User
+	if err := s.db.First(&user, "user_id = ?", userID).Error; err != nil {
+		return "", fmt.Errorf("user not found")
+	}
+	if user.StripeCustomerID == "" {
+		return "", ErrNoBillingAccount
+	}
+
+	url, err := s.client.CreatePortalSession(ctx, user.StripeCustomerID, s.frontendURL+"/billing")
+	if err != nil {
+		return "", fmt.Errorf("failed to create portal session: %v", err)
+	}
+	return url, nil
+}
+
+// HandleWebhook verifies and applies a Stripe webhook. Events are recorded by
+// ID so that Stripe's retries are harmless.
+func (s *BillingService) HandleWebhook(payload []byte, signature string) error {
+	if s.webhookSecret == "" {
+		return ErrBillingNotConfigured
+	}
+	if err := verifyStripeSignature(payload, signature, s.webhookSecret, time.Now()); err != nil {
+		return err
+	}
+
+	var event stripeEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return fmt.Errorf("failed to parse event: %v", err)
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var seen int64
+		if err := tx.Model(&models.BillingEvent{}).Where("event_id = ?", event.ID).Count(&seen).Error; err != nil {
+			return fmt.Errorf("failed to check event: %v", err)
+		}
+		if seen > 0 {
+			return nil
+		}
+
+		if err := s.applyEvent(tx, &event); err != nil {
+			return err
+		}
+
+		return tx.Create(&models.BillingEvent{EventID: event.ID, Type: event.Type}).Error
+	})
+}
+
+func (s *BillingService) applyEvent(tx *gorm.DB, event *stripeEvent) error {
+	switch event.Type {
+	case "checkout.session.completed":
+		var session stripeCheckoutSession
+		if err := json.Unmarshal(event.Data.Object, &session); err != nil {
+			return fmt.Errorf("failed to parse checkout session: %v", err)
+		}
+		updates := map[string]interface{}{
+			"stripe_customer_id":     session.Customer,
+			"stripe_subscription_id": session.Subscription,
+		}
+		if tier := models.SubscriptionTier(session.Metadata["tier"]); s.prices[tier] != "" {
+			updates["subscription_tier"] = tier
+		}
+		return tx.Model(&models.User{}).Where("user_id = ?", session.ClientReferenceID).Updates(updates).Error
+
+	case "customer.subscription.created", "customer.subscription.updated":
+		var sub stripeSubscription
+		if err := json.Unmarshal(event.Data.Object, &sub); err != nil {
+			return fmt.Errorf("failed to parse subscription: %v", err)
+		}
+		updates := map[string]interface{}{"stripe_subscription_id": sub.ID}
+		switch sub.Status {
+		case "active", "trialing", "past_due":
+			if tier, ok := s.tierForItems(sub.Items); ok {
+				updates["subscription_tier"] = tier
+			}
+		case "canceled", "unpaid", "incomplete_expired":
+			// The subscription is over, whether or not a deleted event follows
+			return endSubscription(tx, &sub)
+		default:
+			// Incomplete or paused subscriptions are waiting on the customer,
+			// for example during a plan change, so the tier stays as it is
+		}
+		return tx.Model(&models.User{}).Where("stripe_customer_id = ?", sub.Customer).Updates(updates).Error
+
+	case "customer.subscription.deleted":
+		var sub stripeSubscription
+		if err := json.Unmarshal(event.Data.Object, &sub); err != nil {
+			return fmt.Errorf("failed to parse subscription: %v", err)
+		}
+		return endSubscription(tx, &sub)
+
+	case "invoice.paid":
+		var invoice stripeInvoice
+		if err := json.Unmarshal(event.Data.Object, &invoice); err != nil {
+			return fmt.Errorf("failed to parse invoice: %v", err)
+		}
+		return s.grantInvoiceCredits(tx, &invoice)
+
+	default:
+		// Everything else is acknowledged and ignored
+		return nil
+	}
+}
+
+// endSubscription moves the customer back to the free tier and forgets the
+// subscription, so that they get the free monthly credits again. Events for a
+// subscription the customer has since replaced are ignored.
+func endSubscription(tx *gorm.DB, sub *stripeSubscription) error {
+	return tx.Model(&models.User{}).
+		Where("stripe_customer_id = ? AND stripe_subscription_id = ?", sub.Customer, sub.ID).
+		Updates(map[string]interface{}{
+			"subscription_tier":      models.FreeTier,
+			"stripe_subscription_id": "",
+		}).Error
+}
+
+// grantInvoiceCredits resets the customer's balance to the paid plan's
+// monthly credits and starts their next monthly period. Invoices that
+// charged nothing, such as for a trial, don't grant credits.
+func (s *BillingService) grantInvoiceCredits(tx *gorm.DB, invoice *stripeInvoice) error {
+	if invoice.AmountPaid <= 0 {
+		return nil
+	}
+
+	var user models.User
+	if err := tx.First(&user, "stripe_customer_id = ?", invoice.Customer).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("Ignoring invoice %s for unknown customer %s", invoice.ID, invoice.Customer)
+			return nil
+		}
+		return fmt.Errorf("failed to fetch user: %v", err)
+	}
+
+	tier, ok := s.tierForItems(invoice.Lines)
+	if !ok {
+		tier = user.SubscriptionTier
+	}
+
+	var plan models.SubscriptionPlan
+	if err := tx.Where("tier = ?", tier).First(&plan).Error; err != nil {
+		return fmt.Errorf("plan not found: %v", err)
+	}
+
+	return s.creditService.WithTx(tx).ResetCredits(user.UserID, plan.MonthlyCredits, "invoice "+invoice.ID)
+}
+
+func (s *BillingService) tierForItems(items stripePriceItems) (models.SubscriptionTier, bool) {
+	for _, item := range items.Data {
+		for tier, priceID := range s.prices {
+			if priceID != "" && priceID == item.Price.ID {
+				return tier, true
+			}
+		}
+	}
+	return "", false
+}
+
+// verifyStripeSignature checks a Stripe-Signature header of the form
+// "t=<unix time>,v1=<hex hmac>[,v1=...]" against the raw payload.
+func verifyStripeSignature(payload []byte, header, secret string, now time.Time) error {
+	var timestamp string
+	var signatures []string
+	for _, part := range strings.Split(header, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+	if timestamp == "" || len(signatures) == 0 {
+		return ErrInvalidSignature
+	}
+
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	if age := now.Sub(time.Unix(ts, 0)); age > webhookTolerance || age < -webhookTolerance {
+		return ErrInvalidSignature
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	expected := mac.Sum(nil)
+
+	for _, sig := range signatures {
+		decoded, err := hex.DecodeString(sig)
+		if err == nil && hmac.Equal(decoded, expected) {
+			return nil
+		}
+	}
+	return ErrInvalidSignature
+}
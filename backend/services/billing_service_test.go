@@ -0,0 +1,181 @@
+package services
+
+import (
+	"ai-content-creation/models"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// stripeSignature returns the v1 signature Stripe sends with payload at t.
+func stripeSignature(payload []byte, secret string, t time.Time) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(t.Unix(), 10) + "."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// signStripePayload returns the Stripe-Signature header for payload sent at t.
+func signStripePayload(payload []byte, secret string, t time.Time) string {
+	return fmt.Sprintf("t=%d,v1=%s", t.Unix(), stripeSignature(payload, secret, t))
+}
+
+func TestVerifyStripeSignature(t *testing.T) {
+	const secret = "whsec_test"
+	payload := []byte(`{"id":"evt_1","type":"invoice.paid"}`)
+	now := time.Unix(1700000000, 0)
+	ts := "t=1700000000"
+	sig := stripeSignature(payload, secret, now)
+
+	tests := []struct {
+		name    string
+		payload []byte
+		header  string
+		now     time.Time
+		valid   bool
+	}{
+		{"valid", payload, ts + ",v1=" + sig, now, true},
+		{"within tolerance", payload, ts + ",v1=" + sig, now.Add(4 * time.Minute), true},
+		{"spaces", payload, ts + ", v1=" + sig, now, true},
+		{"rolled secret", payload, ts + ",v1=" + stripeSignature(payload, "whsec_old", now) + ",v1=" + sig, now, true},
+		{"wrong secret", payload, signStripePayload(payload, "whsec_other", now), now, false},
+		{"modified payload", []byte(`{"id":"evt_1","type":"invoice.paid","x":1}`), ts + ",v1=" + sig, now, false},
+		{"stale", payload, ts + ",v1=" + sig, now.Add(6 * time.Minute), false},
+		{"from the future", payload, ts + ",v1=" + sig, now.Add(-6 * time.Minute), false},
+		{"timestamp changed", payload, "t=1700000001,v1=" + sig, now, false},
+		{"missing timestamp", payload, "v1=" + sig, now, false},
+		{"missing signature", payload, ts, now, false},
+		{"bad timestamp", payload, "t=soon,v1=" + sig, now, false},
+		{"not hex", payload, ts + ",v1=zz", now, false},
+		{"v0 only", payload, ts + ",v0=" + sig, now, false},
+		{"empty", payload, "", now, false},
+	}
+	for _, tt := range tests {
+		err := verifyStripeSignature(tt.payload, tt.header, secret, tt.now)
+		switch {
+		case tt.valid && err != nil:
+			t.Errorf("%s: %v, want nil", tt.name, err)
+		case !tt.valid && !errors.Is(err, ErrInvalidSignature):
+			t.Errorf("%s: %v, want ErrInvalidSignature", tt.name, err)
+		}
+	}
+}
+
+func TestHandleWebhookInvoicePaid(t *testing.T) {
+	const secret = "whsec_test"
+	t.Setenv("STRIPE_WEBHOOK_SECRET", secret)
+	t.Setenv("STRIPE_PRICE_PRO", "price_pro")
+	db := newTestDB(t)
+	s := NewBillingService(db, nil, NewCreditService(db))
+
+	user := createTestUser(t, db, "u1", 12)
+	db.Model(user).Update("stripe_customer_id", "cus_1")
+
+	invoice := func(eventID string, amountPaid int) []byte {
+		return []byte(fmt.Sprintf(`{"id":%q,"type":"invoice.paid","data":{"object":{"id":"in_%s","customer":"cus_1","amount_paid":%d,"lines":{"data":[{"price":{"id":"price_pro"}}]}}}}`,
+			eventID, eventID, amountPaid))
+	}
+	credits := func() int {
+		var u models.User
+		db.First(&u, "user_id = ?", "u1")
+		return u.RemainingCredits
+	}
+
+	forged := invoice("evt_forged", 2000)
+	if err := s.HandleWebhook(forged, signStripePayload(forged, "whsec_other", time.Now())); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("forged webhook = %v, want ErrInvalidSignature", err)
+	}
+	if got := credits(); got != 12 {
+		t.Fatalf("credits after forged webhook = %d, want 12", got)
+	}
+
+	// A trial invoice charges nothing and grants nothing
+	trial := invoice("evt_trial", 0)
+	if err := s.HandleWebhook(trial, signStripePayload(trial, secret, time.Now())); err != nil {
+		t.Fatalf("HandleWebhook: %v", err)
+	}
+	if got := credits(); got != 12 {
+		t.Fatalf("credits after trial invoice = %d, want 12", got)
+	}
+
+	// Stripe retries deliveries, so the same event may arrive twice
+	paid := invoice("evt_paid", 2000)
+	for i := 0; i < 2; i++ {
+		if err := s.HandleWebhook(paid, signStripePayload(paid, secret, time.Now())); err != nil {
+			t.Fatalf("HandleWebhook: %v", err)
+		}
+	}
+	if got := credits(); got != 5000 {
+		t.Fatalf("credits after paid invoice = %d, want 5000", got)
+	}
+	var resets int64
+	db.Model(&models.CreditTransaction{}).Where("type = ?", models.CreditMonthlyReset).Count(&resets)
+	if resets != 1 {
+		t.Fatalf("%d monthly reset entries, want 1", resets)
+	}
+}
+
+func TestHandleWebhookSubscriptionEnded(t *testing.T) {
+	const secret = "whsec_test"
+	t.Setenv("STRIPE_WEBHOOK_SECRET", secret)
+	t.Setenv("STRIPE_PRICE_PRO", "price_pro")
+	db := newTestDB(t)
+	credits := NewCreditService(db)
+	s := NewBillingService(db, nil, credits)
+
+	subscriptionUpdated := func(eventID, subscriptionID, status string) {
+		t.Helper()
+		payload := []byte(fmt.Sprintf(`{"id":%q,"type":"customer.subscription.updated","data":{"object":{"id":%q,"customer":"cus_1","status":%q,"items":{"data":[{"price":{"id":"price_pro"}}]}}}}`,
+			eventID, subscriptionID, status))
+		if err := s.HandleWebhook(payload, signStripePayload(payload, secret, time.Now())); err != nil {
+			t.Fatalf("HandleWebhook: %v", err)
+		}
+	}
+	user := func() models.User {
+		var u models.User
+		db.First(&u, "user_id = ?", "u1")
+		return u
+	}
+
+	for _, status := range []string{"canceled", "unpaid", "incomplete_expired"} {
+		createTestUser(t, db, "u1", 3)
+		db.Model(&models.User{}).Where("user_id = ?", "u1").Updates(map[string]interface{}{
+			"stripe_customer_id": "cus_1",
+			"subscription_tier":  models.ProTier,
+		})
+
+		subscriptionUpdated("evt_active_"+status, "sub_1", "active")
+		if u := user(); u.SubscriptionTier != models.ProTier || u.StripeSubscriptionID != "sub_1" {
+			t.Fatalf("after active: tier %s, subscription %q", u.SubscriptionTier, u.StripeSubscriptionID)
+		}
+
+		// An update for a subscription the customer has replaced changes nothing
+		subscriptionUpdated("evt_old_"+status, "sub_0", status)
+		if u := user(); u.StripeSubscriptionID != "sub_1" {
+			t.Fatalf("%s for an old subscription: subscription %q, want sub_1", status, u.StripeSubscriptionID)
+		}
+
+		subscriptionUpdated("evt_"+status, "sub_1", status)
+		if u := user(); u.SubscriptionTier != models.FreeTier || u.StripeSubscriptionID != "" {
+			t.Fatalf("after %s: tier %s, subscription %q, want free and none", status, u.SubscriptionTier, u.StripeSubscriptionID)
+		}
+
+		// Without a subscription the monthly reset gives back the free credits
+		past := time.Now().Add(-time.Hour)
+		db.Model(&models.User{}).Where("user_id = ?", "u1").Update("credits_reset_at", &past)
+		balance, err := credits.GetBalance("u1")
+		if err != nil {
+			t.Fatalf("GetBalance: %v", err)
+		}
+		if balance.RemainingCredits != 200 {
+			t.Fatalf("after %s: credits = %d, want the free tier's 200", status, balance.RemainingCredits)
+		}
+
+		db.Unscoped().Where("user_id = ?", "u1").Delete(&models.User{})
+	}
+}
@@ -0,0 +1,178 @@
+package services
+
+import (
+	"ai-content-creation/models"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var ErrBrandNotFound = errors.New("brand not found")
+
+// BrandInput holds the editable fields of a brand profile.
+type BrandInput struct {
+	Name        string
+	Industry    string
+	Location    string
+	Audience    string
+	ToneOfVoice string
+	BannedWords []string
+	Hashtags    []string
+	SamplePosts []string
+}
+
+type BrandService struct {
+	db *gorm.DB
+}
+
+func NewBrandService(db *gorm.DB) *BrandService {
+	return &BrandService{db: db}
+}
+
+func (s *BrandService) CreateBrand(userID string, input BrandInput) (*models.Brand, error) {
+	brand := &models.Brand{
+		BrandID: uuid.New().String(),
+		UserID:  userID,
+	}
+	if err := applyBrandInput(brand, input); err != nil {
+		return nil, err
+	}
+
+	if err := s.db.Create(brand).Error; err != nil {
+		return nil, fmt.Errorf("failed to create brand: %v", err)
+	}
+	return brand, nil
+}
+
+func (s *BrandService) GetBrands(userID string) ([]models.Brand, error) {
+	var brands []models.Brand
+	if err := s.db.Where("user_id = ?", userID).Order("name").Find(&brands).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch brands: %v", err)
+	}
+	return brands, nil
+}
+
+func (s *BrandService) GetBrand(userID string, brandID string) (*models.Brand, error) {
+	return s.findBrand(s.db.Where("brand_id = ? AND user_id = ?", brandID, userID))
+}
+
+// brandByID returns a brand whoever owns it, for requests that were checked
+// against their owner when they were made.
+func (s *BrandService) brandByID(brandID string) (*models.Brand, error) {
+	return s.findBrand(s.db.Where("brand_id = ?", brandID))
+}
+
+func (s *BrandService) findBrand(query *gorm.DB) (*models.Brand, error) {
+	var brand models.Brand
+	if err := query.First(&brand).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrBrandNotFound
+		}
+		return nil, fmt.Errorf("failed to fetch brand: %v", err)
+	}
+	return &brand, nil
+}
+
+// UpdateBrand replaces every editable field of the brand.
+func (s *BrandService) UpdateBrand(userID string, brandID string, input BrandInput) (*models.Brand, error) {
+	brand, err := s.GetBrand(userID, brandID)
+	if err != nil {
+		return nil, err
+	}
+	if err := applyBrandInput(brand, input); err != nil {
+		return nil, err
+	}
+
+	if err := s.db.Save(brand).Error; err != nil {
+		return nil, fmt.Errorf("failed to update brand: %v", err)
+	}
+	return brand, nil
+}
+
+// DeleteBrand removes the brand. Content already generated for it is kept,
+// but its requests can no longer be regenerated with the brand.
+func (s *BrandService) DeleteBrand(userID string, brandID string) error {
+	brand, err := s.GetBrand(userID, brandID)
+	if err != nil {
+		return err
+	}
+	if err := s.db.Delete(brand).Error; err != nil {
+		return fmt.Errorf("failed to delete brand: %v", err)
+	}
+	return nil
+}
+
+func applyBrandInput(brand *models.Brand, input BrandInput) error {
+	brand.Name = strings.TrimSpace(input.Name)
+	brand.Industry = strings.TrimSpace(input.Industry)
+	brand.Location = strings.TrimSpace(input.Location)
+	brand.Audience = strings.TrimSpace(input.Audience)
+	brand.ToneOfVoice = strings.TrimSpace(input.ToneOfVoice)
+
+	hashtags := cleanList(input.Hashtags)
+	for i, tag := range hashtags {
+		hashtags[i] = "#" + strings.TrimLeft(tag, "#")
+	}
+
+	if err := brand.SetBannedWords(cleanList(input.BannedWords)); err != nil {
+		return fmt.Errorf("failed to encode banned words: %v", err)
+	}
+	if err := brand.SetHashtags(hashtags); err != nil {
+		return fmt.Errorf("failed to encode hashtags: %v", err)
+	}
+	if err := brand.SetSamplePosts(cleanList(input.SamplePosts)); err != nil {
+		return fmt.Errorf("failed to encode sample posts: %v", err)
+	}
+	return nil
+}
+
+// cleanList trims every value and drops empty ones.
+func cleanList(values []string) []string {
+	cleaned := []string{}
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			cleaned = append(cleaned, v)
+		}
+	}
+	return cleaned
+}
+
+// brandProfile renders a brand as a section of the system prompt.
+func brandProfile(brand *models.Brand) string {
+	var b strings.Builder
+	b.WriteString("You are writing for the following brand:\n")
+
+	field := func(label, value string) {
+		if value != "" {
+			fmt.Fprintf(&b, "- %s: %s\n", label, value)
+		}
+	}
+	field("Name", brand.Name)
+	field("Industry", brand.Industry)
+	field("Location", brand.Location)
+	field("Target audience", brand.Audience)
+	field("Tone of voice", brand.ToneOfVoice)
+
+	// The lists were validated when the brand was saved
+	bannedWords, _ := brand.GetBannedWords()
+	hashtags, _ := brand.GetHashtags()
+	samplePosts, _ := brand.GetSamplePosts()
+
+	if len(bannedWords) > 0 {
+		fmt.Fprintf(&b, "Never use these words: %s\n", strings.Join(bannedWords, ", "))
+	}
+	if len(hashtags) > 0 {
+		fmt.Fprintf(&b, "Use hashtags from this list where they fit: %s\n", strings.Join(hashtags, " "))
+	}
+	if len(samplePosts) > 0 {
+		b.WriteString("Match the style of these past posts:\n")
+		for i, post := range samplePosts {
+			fmt.Fprintf(&b, "%d. %s\n", i+1, post)
+		}
+	}
+
+	return b.String()
+}
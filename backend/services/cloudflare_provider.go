@@ -0,0 +1,261 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const cloudflareBaseURL = "https://api.cloudflare.com/client/v4/accounts"
+
+// CloudflareProvider runs models on Cloudflare Workers AI.
+type CloudflareProvider struct {
+	accountID    string
+	apiToken     string
+	models       []string // upstream names of the models configured for this provider
+	client       *http.Client
+	streamClient *http.Client
+	idleTimeout  time.Duration
+}
+
+type CloudflareAIRequest struct {
+	Messages []Message `json:"messages"`
+	Stream   bool      `json:"stream"`
+}
+
+type CloudflareAIResponse struct {
+	Result struct {
+		Response string           `json:"response"`
+		Usage    *cloudflareUsage `json:"usage"`
+	} `json:"result"`
+	Success bool `json:"success"`
+	Errors  []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+type cloudflareStreamEvent struct {
+	Response string           `json:"response"`
+	Usage    *cloudflareUsage `json:"usage"`
+}
+
+// cloudflareUsage is only reported by newer Workers AI models.
+type cloudflareUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+}
+
+func (u *cloudflareUsage) toTokenUsage() TokenUsage {
+	if u == nil {
+		return TokenUsage{}
+	}
+	return TokenUsage{PromptTokens: u.PromptTokens, CompletionTokens: u.CompletionTokens}
+}
+
+// ImageRequest covers the inputs of the FLUX and Stable Diffusion models.
+// FLUX calls the number of diffusion steps steps, Stable Diffusion num_steps.
+type ImageRequest struct {
+	Prompt         string `json:"prompt"`
+	NegativePrompt string `json:"negative_prompt,omitempty"`
+	Steps          int    `json:"steps,omitempty"`
+	NumSteps       int    `json:"num_steps,omitempty"`
+	Seed           *int64 `json:"seed,omitempty"`
+	Width          int    `json:"width,omitempty"`
+	Height         int    `json:"height,omitempty"`
+}
+
+type ImageResponse struct {
+	Result struct {
+		Image []byte `json:"image"`
+	}
+	Success bool `json:"success"`
+	Errors  []struct {
+		Message string `json:"message"`
+	}
+}
+
+// NewCloudflareProvider creates the provider for the given upstream models.
+// Requests time out after timeout, except streams, which time out once they
+// have been idle for idleTimeout.
+func NewCloudflareProvider(accountID, apiToken string, models []string, timeout, idleTimeout time.Duration) *CloudflareProvider {
+	return &CloudflareProvider{
+		accountID:    accountID,
+		apiToken:     apiToken,
+		models:       models,
+		client:       &http.Client{Timeout: timeout},
+		streamClient: &http.Client{},
+		idleTimeout:  idleTimeout,
+	}
+}
+
+func (p *CloudflareProvider) Name() string {
+	return providerCloudflare
+}
+
+func (p *CloudflareProvider) GenerateText(ctx context.Context, req TextGenerationRequest) (*TextGenerationResult, error) {
+	aiReq := CloudflareAIRequest{
+		Messages: req.Messages,
+		Stream:   false,
+	}
+
+	body, err := p.run(ctx, req.Model, aiReq)
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse the response
+	var cloudflareResponse CloudflareAIResponse
+	if err := json.Unmarshal(body, &cloudflareResponse); err != nil {
+		return nil, fmt.Errorf("failed to parse response JSON: %v", err)
+	}
+
+	// Check for API errors
+	if !cloudflareResponse.Success && len(cloudflareResponse.Errors) > 0 {
+		return nil, fmt.Errorf("API error: %s", cloudflareResponse.Errors[0].Message)
+	}
+
+	return &TextGenerationResult{
+		Text:  cloudflareResponse.Result.Response,
+		Usage: cloudflareResponse.Result.Usage.toTokenUsage(),
+	}, nil
+}
+
+func (p *CloudflareProvider) StreamText(ctx context.Context, req TextGenerationRequest, onToken TokenHandler) (*TextGenerationResult, error) {
+	stream := newIdleStream(ctx, p.idleTimeout)
+	defer stream.stop()
+
+	resp, err := p.send(stream.ctx, p.streamClient, req.Model, CloudflareAIRequest{
+		Messages: req.Messages,
+		Stream:   true,
+	})
+	if err != nil {
+		return nil, stream.err(err)
+	}
+	defer resp.Body.Close()
+
+	var text strings.Builder
+	var usage TokenUsage
+	err = readSSE(stream.reader(resp.Body), func(data string) error {
+		var event cloudflareStreamEvent
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			return fmt.Errorf("failed to parse stream event: %v", err)
+		}
+		if event.Usage != nil {
+			usage = event.Usage.toTokenUsage()
+		}
+		if event.Response == "" {
+			return nil
+		}
+		text.WriteString(event.Response)
+		return onToken(event.Response)
+	})
+	if err != nil {
+		return nil, stream.err(err)
+	}
+
+	return &TextGenerationResult{Text: text.String(), Usage: usage}, nil
+}
+
+// GenerateImage runs an image model. FLUX answers with JSON holding the
+// image, while Stable Diffusion models answer with the image itself.
+func (p *CloudflareProvider) GenerateImage(ctx context.Context, req ImageGenerationRequest) ([]byte, error) {
+	imageReq := ImageRequest{
+		Prompt:         req.Prompt,
+		NegativePrompt: req.NegativePrompt,
+		Seed:           req.Seed,
+		Width:          req.Width,
+		Height:         req.Height,
+	}
+	if strings.HasPrefix(req.Model, "@cf/black-forest-labs/") {
+		imageReq.Steps = req.Steps
+	} else {
+		imageReq.NumSteps = req.Steps
+	}
+
+	resp, err := p.send(ctx, p.client, req.Model, imageReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %v", err)
+	}
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "image/") {
+		return body, nil
+	}
+
+	var imageResponse ImageResponse
+	if err := json.Unmarshal(body, &imageResponse); err != nil {
+		return nil, fmt.Errorf("failed to parse response JSON: %v", err)
+	}
+
+	if !imageResponse.Success && len(imageResponse.Errors) > 0 {
+		return nil, fmt.Errorf("Image API error: %s", imageResponse.Errors[0].Message)
+	}
+
+	return imageResponse.Result.Image, nil
+}
+
+// ListModels returns the Workers AI models this deployment is configured to
+// use. Cloudflare's catalogue is large and mostly irrelevant, so we don't
+// query it.
+func (p *CloudflareProvider) ListModels(ctx context.Context) ([]string, error) {
+	return append([]string(nil), p.models...), nil
+}
+
+// run POSTs payload to the given model endpoint and returns the raw body.
+func (p *CloudflareProvider) run(ctx context.Context, model string, payload interface{}) ([]byte, error) {
+	resp, err := p.send(ctx, p.client, model, payload)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// Read the entire response body
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %v", err)
+	}
+
+	return body, nil
+}
+
+// send POSTs payload to the given model endpoint with client. On success the
+// caller owns the response body.
+func (p *CloudflareProvider) send(ctx context.Context, client *http.Client, model string, payload interface{}) (*http.Response, error) {
+	reqBody, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to marshal the request into json: %s", err)
+	}
+
+	url := fmt.Sprintf("%s/%s/ai/run/%s", cloudflareBaseURL, p.accountID, model)
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(reqBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+p.apiToken)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %v", err)
+	}
+
+	// Check HTTP status code
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,139 @@
+package services
+
+import (
+	"ai-content-creation/models"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// cachedGenerationCost is charged instead of generationCost for each platform
+// of a request served from the cache
+const cachedGenerationCost = 1
+
+// cacheKeyInput is everything that influences a generation's output. Adding
+// a generation parameter means adding it here so that requests differing in
+// it don't share cache entries.
+type cacheKeyInput struct {
+	Model        string `json:"model"`
+	System       string `json:"system"`
+	Prompt       string `json:"prompt"`
+	ImageOptions string `json:"image_options,omitempty"`
+	TextOnly     bool   `json:"text_only,omitempty"`
+}
+
+// cacheKey derives a deterministic key for a request from its model, system
+// prompt, normalized prompt and generation parameters. The system prompt
+// includes the brand profile, so editing a brand invalidates its entries.
+func cacheKey(contentReq *models.ContentRequest, system string) string {
+	data, _ := json.Marshal(cacheKeyInput{
+		Model:        contentReq.AIModel,
+		System:       system,
+		Prompt:       normalizePrompt(contentReq.Prompt),
+		ImageOptions: contentReq.ImageOptions,
+		TextOnly:     contentReq.TextOnly,
+	})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// normalizePrompt ignores differences in case and whitespace.
+func normalizePrompt(prompt string) string {
+	return strings.ToLower(strings.Join(strings.Fields(prompt), " "))
+}
+
+// lookupCache finds the most recent content for each of the request's
+// platforms that is younger than the cache TTL, among the user's personal
+// content or the workspace's content. It returns nil unless every platform
+// has a cached caption, or when caching is disabled.
+func (s *ContentService) lookupCache(contentReq *models.ContentRequest, system string) ([]models.GeneratedContent, error) {
+	if s.cacheTTL <= 0 {
+		return nil, nil
+	}
+
+	platformIDs, err := requestPlatforms(contentReq)
+	if err != nil {
+		return nil, err
+	}
+
+	var hits []models.GeneratedContent
+	for _, platform := range platformIDs {
+		var content models.GeneratedContent
+		scope := ContentScope{UserID: contentReq.UserID, WorkspaceID: contentReq.WorkspaceID}
+		err := scope.where(s.db.Joins("JOIN content_requests ON content_requests.request_id = generated_contents.request_id")).
+			Where("generated_contents.cache_key = ? AND generated_contents.created_at >= ?",
+				cacheKey(contentReq, platformPrompt(system, platform)), time.Now().Add(-s.cacheTTL)).
+			Order("generated_contents.created_at DESC").
+			First(&content).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("failed to look up cache: %v", err)
+		}
+		hits = append(hits, content)
+	}
+	return hits, nil
+}
+
+// serveFromCache completes a new request immediately with copies of cached
+// content, charging cachedGenerationCost per platform and no tokens.
+func (s *ContentService) serveFromCache(contentReq *models.ContentRequest, cached []models.GeneratedContent) ([]models.GeneratedContent, error) {
+	if err := s.checkModel(contentReq.RunBy, contentReq.AIModel); err != nil {
+		return nil, err
+	}
+	if err := s.creditService.Reserve(contentReq.RunBy, contentReq.WorkspaceID, contentReq.RequestID, cachedGenerationCost*len(cached)); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	contentReq.Status = models.RequestRunning
+	contentReq.StartedAt = &now
+	if err := s.db.Create(contentReq).Error; err != nil {
+		if refundErr := s.creditService.Refund(contentReq.RunBy, contentReq.RequestID); refundErr != nil {
+			log.Printf("Failed to refund credits for request %s: %v", contentReq.RequestID, refundErr)
+		}
+		return nil, fmt.Errorf("failed to create content request: %v", err)
+	}
+
+	contents := make([]models.GeneratedContent, len(cached))
+	for i, hit := range cached {
+		source := hit.ContentID
+		if hit.CachedFrom != "" {
+			source = hit.CachedFrom
+		}
+		contents[i] = models.GeneratedContent{
+			ContentID:  uuid.New().String(),
+			RequestID:  contentReq.RequestID,
+			Platform:   hit.Platform,
+			Output:     hit.Output,
+			ImageURL:   hit.ImageURL,
+			ImageKey:   hit.ImageKey,
+			ImageID:    hit.ImageID,
+			Version:    1,
+			CacheKey:   hit.CacheKey,
+			CachedFrom: source,
+			Prompt:     contentReq.Prompt,
+			AIModel:    contentReq.AIModel,
+		}
+	}
+	if err := s.db.Create(&contents).Error; err != nil {
+		s.finish(contentReq, err)
+		return nil, fmt.Errorf("failed to create generated content: %v", err)
+	}
+
+	s.finish(contentReq, nil)
+	completedAt := time.Now()
+	contentReq.Status = models.RequestCompleted
+	contentReq.CompletedAt = &completedAt
+
+	return contents, nil
+}
@@ -2,103 +2,992 @@ package services
 
 import (
 	"ai-content-creation/models"
+	"context"
+	"errors"
 	"fmt"
+	"log"
+	"time"
 
-	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
+var (
+	ErrRequestNotFound       = errors.New("content request not found")
+	ErrRequestNotCancellable = errors.New("content request has already finished")
+	ErrRequestInProgress     = errors.New("content request is still being generated")
+	ErrContentNotFound       = errors.New("content not found")
+	ErrModelRequired         = errors.New("model is required")
+	ErrPromptRequired        = errors.New("prompt is required")
+	ErrPromptWithTemplate    = errors.New("a prompt cannot be combined with a template")
+	ErrStreamPlatforms       = errors.New("streaming supports a single platform")
+	ErrImageOptionsTextOnly  = errors.New("image options cannot be combined with text_only")
+
+	errStreamInterrupted = errors.New("the server restarted while the content was being streamed")
+)
+
+// generationCost is the number of credits charged per generation, for each
+// platform a request targets
+const generationCost = 10
+
+// cancelWait is how long cancelling a running request waits for its worker
+// to stop, so that the response can show the outcome
+const cancelWait = 5 * time.Second
+
+// GenerateOptions describes a generation request. Either Prompt or
+// TemplateID must be set; a template supplies the prompt from Variables and
+// may supply a default model. Each of Platforms gets its own caption; none
+// means a single generic one. The captions share one image, made with Image,
+// unless TextOnly is set.
+type GenerateOptions struct {
+	WorkspaceID string // generate in a workspace, paid for from its pool
+	Model       string
+	Prompt      string
+	TemplateID  string
+	Variables   map[string]string
+	BrandID     string // optional brand whose profile shapes the system prompt
+	Platforms   []string
+	Image       models.ImageOptions
+	TextOnly    bool
+	NoCache     bool // always generate, even if an identical request is cached
+}
+
+// ContentScope selects the content a query sees: a workspace's content when
+// WorkspaceID is set, otherwise the user's personal content.
+type ContentScope struct {
+	UserID      string
+	WorkspaceID string
+}
+
+// where restricts a query joined with content_requests to the scope.
+func (sc ContentScope) where(db *gorm.DB) *gorm.DB {
+	if sc.WorkspaceID != "" {
+		return db.Where("content_requests.workspace_id = ?", sc.WorkspaceID)
+	}
+	return db.Where("content_requests.user_id = ? AND content_requests.workspace_id = ''", sc.UserID)
+}
+
 type ContentService struct {
-	db        *gorm.DB
-	aiService *AIService
+	db                  *gorm.DB
+	aiService           *AIService
+	creditService       *CreditService
+	subscriptionService *SubscriptionService
+	usageService        *UsageService
+	brandService        *BrandService
+	templateService     *TemplateService
+	storage             Storage
+	queue               *GenerationQueue
+	cacheTTL            time.Duration
+	imageURLTTL         time.Duration
 }
 
-func NewContentService(db *gorm.DB) *ContentService {
+// NewContentService creates the content service and its generation queue.
+// The queue is sized by GENERATION_WORKERS (default 4) and
+// GENERATION_QUEUE_SIZE (default 100); call Start to begin processing.
+// Identical requests are served from cache for GENERATION_CACHE_TTL
+// (default 24h, 0 disables caching). Image URLs handed out with content stay
+// valid for IMAGE_URL_TTL (default 1h).
+func NewContentService(db *gorm.DB, aiService *AIService, creditService *CreditService, subscriptionService *SubscriptionService, usageService *UsageService, brandService *BrandService, templateService *TemplateService, storage Storage) *ContentService {
 	return &ContentService{
-		db:        db,
-		aiService: NewAIService(),
+		db:                  db,
+		aiService:           aiService,
+		creditService:       creditService,
+		subscriptionService: subscriptionService,
+		usageService:        usageService,
+		brandService:        brandService,
+		templateService:     templateService,
+		storage:             storage,
+		queue:               NewGenerationQueue(envInt("GENERATION_WORKERS", 4), envInt("GENERATION_QUEUE_SIZE", 100)),
+		cacheTTL:            envDuration("GENERATION_CACHE_TTL", 24*time.Hour),
+		imageURLTTL:         envDuration("IMAGE_URL_TTL", time.Hour),
+	}
+}
+
+// Start launches the generation workers and re-queues any requests that were
+// queued or running when the server last stopped. Streamed requests can't be
+// resumed once their client is gone, so those that were running fail and are
+// refunded instead. Images that are still public from before they were made
+// private are made private in the background.
+func (s *ContentService) Start() error {
+	s.queue.Start(s.process)
+	go s.makeLegacyImagesPrivate()
+
+	var streamed []models.ContentRequest
+	if err := s.db.Where("status = ? AND streamed = ?", models.RequestRunning, true).Find(&streamed).Error; err != nil {
+		return fmt.Errorf("failed to load streamed requests: %v", err)
+	}
+	for i := range streamed {
+		s.finish(&streamed[i], errStreamInterrupted)
+	}
+
+	if err := s.db.Model(&models.ContentRequest{}).
+		Where("status = ?", models.RequestRunning).
+		Updates(map[string]interface{}{"status": models.RequestQueued, "started_at": nil}).Error; err != nil {
+		return fmt.Errorf("failed to reset running requests: %v", err)
 	}
+
+	var pending []models.ContentRequest
+	if err := s.db.Where("status = ?", models.RequestQueued).Order("created_at").Find(&pending).Error; err != nil {
+		return fmt.Errorf("failed to load queued requests: %v", err)
+	}
+
+	// The backlog may be larger than the queue, so feed it in the background
+	// instead of rejecting anything.
+	go func() {
+		for _, req := range pending {
+			s.queue.push(req.RequestID)
+		}
+	}()
+
+	return nil
 }
 
-func (s *ContentService) Generate(c *gin.Context, userID string, model string, prompt string) (*models.GeneratedContent, error) {
-	// Check user's subscription and credits
+// Enqueue validates and records a content request and hands it to the
+// generation queue. The returned request is in the queued state; poll
+// GetRequest for the result. If the request can be served from cache it is
+// completed immediately and the cached content is returned as well.
+func (s *ContentService) Enqueue(userID string, opts GenerateOptions) (*models.ContentRequest, []models.GeneratedContent, error) {
+	contentReq, err := s.newContentRequest(userID, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	system, err := s.systemPrompt(contentReq)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !opts.NoCache {
+		cached, err := s.lookupCache(contentReq, system)
+		if err != nil {
+			return nil, nil, err
+		}
+		if cached != nil {
+			contents, err := s.serveFromCache(contentReq, cached)
+			if err != nil {
+				return nil, nil, err
+			}
+			if err := s.signImages(contents); err != nil {
+				return nil, nil, err
+			}
+			return contentReq, contents, nil
+		}
+	}
+
+	contentReq.Status = models.RequestQueued
+	if err := s.create(contentReq); err != nil {
+		return nil, nil, err
+	}
+
+	if err := s.queue.Enqueue(contentReq.RequestID); err != nil {
+		s.finish(contentReq, err)
+		return nil, nil, err
+	}
+
+	return contentReq, nil, nil
+}
+
+// GenerateStream generates content synchronously, relaying text tokens to
+// onToken as they arrive. The content is only stored, and credits are only
+// deducted, once the stream has completed successfully. A cache hit is sent
+// as a single token. Streams target at most one platform.
+func (s *ContentService) GenerateStream(ctx context.Context, userID string, opts GenerateOptions, onToken TokenHandler) (*models.GeneratedContent, error) {
+	if len(opts.Platforms) > 1 {
+		return nil, ErrStreamPlatforms
+	}
+
+	contentReq, err := s.newContentRequest(userID, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	system, err := s.systemPrompt(contentReq)
+	if err != nil {
+		return nil, err
+	}
+
+	if !opts.NoCache {
+		cached, err := s.lookupCache(contentReq, system)
+		if err != nil {
+			return nil, err
+		}
+		if cached != nil {
+			contents, err := s.serveFromCache(contentReq, cached)
+			if err != nil {
+				return nil, err
+			}
+			if err := s.signImages(contents); err != nil {
+				return nil, err
+			}
+			if err := onToken(contents[0].Output); err != nil {
+				return nil, err
+			}
+			return &contents[0], nil
+		}
+	}
+
+	now := time.Now()
+	contentReq.Status = models.RequestRunning
+	contentReq.StartedAt = &now
+	contentReq.Streamed = true
+	if err := s.create(contentReq); err != nil {
+		return nil, err
+	}
+
+	contents, err := s.run(ctx, contentReq, onToken)
+	if err != nil {
+		s.finish(contentReq, ctxErr(ctx, err))
+		return nil, err
+	}
+	if err := s.signImage(&contents[0]); err != nil {
+		return nil, err
+	}
+
+	return &contents[0], nil
+}
+
+// newContentRequest builds a request from opts, rendering its template if it
+// has one.
+func (s *ContentService) newContentRequest(userID string, opts GenerateOptions) (*models.ContentRequest, error) {
+	contentReq := &models.ContentRequest{
+		RequestID:   uuid.New().String(),
+		UserID:      userID,
+		RunBy:       userID,
+		WorkspaceID: opts.WorkspaceID,
+		AIModel:     opts.Model,
+		Prompt:      opts.Prompt,
+		BrandID:     opts.BrandID,
+		TemplateID:  opts.TemplateID,
+	}
+
+	platformIDs, err := normalizePlatforms(opts.Platforms)
+	if err != nil {
+		return nil, err
+	}
+	if err := contentReq.SetPlatforms(platformIDs); err != nil {
+		return nil, fmt.Errorf("failed to encode platforms: %v", err)
+	}
+
+	contentReq.TextOnly = opts.TextOnly
+	if opts.TextOnly && opts.Image != (models.ImageOptions{}) {
+		return nil, ErrImageOptionsTextOnly
+	}
+	imageOptions, err := s.aiService.ResolveImageOptions(opts.Image)
+	if err != nil {
+		return nil, err
+	}
+	if err := contentReq.SetImageOptions(imageOptions); err != nil {
+		return nil, fmt.Errorf("failed to encode image options: %v", err)
+	}
+
+	if opts.TemplateID != "" {
+		if opts.Prompt != "" {
+			return nil, ErrPromptWithTemplate
+		}
+
+		template, err := s.templateService.GetTemplate(userID, opts.TemplateID)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkVariables(template, opts.Variables); err != nil {
+			return nil, err
+		}
+		if err := contentReq.SetVariables(opts.Variables); err != nil {
+			return nil, fmt.Errorf("failed to encode variables: %v", err)
+		}
+
+		contentReq.Prompt = renderTemplate(template.UserPrompt, opts.Variables)
+		if contentReq.AIModel == "" {
+			contentReq.AIModel = template.DefaultModel
+		}
+	}
+
+	if opts.BrandID != "" {
+		if _, err := s.brandService.GetBrand(userID, opts.BrandID); err != nil {
+			return nil, err
+		}
+	}
+
+	if contentReq.AIModel == "" {
+		return nil, ErrModelRequired
+	}
+	if contentReq.Prompt == "" {
+		return nil, ErrPromptRequired
+	}
+
+	return contentReq, nil
+}
+
+// systemPrompt builds the system prompt for a request: its template's system
+// prompt if it has one, otherwise the default, followed by its brand's
+// profile when it has one. The template and brand were checked to be the
+// user's when the request was made; a regeneration by another workspace
+// member keeps using them.
+func (s *ContentService) systemPrompt(contentReq *models.ContentRequest) (string, error) {
+	system := systemPrompt
+
+	if contentReq.TemplateID != "" {
+		template, err := s.templateService.templateByID(contentReq.TemplateID)
+		if err != nil {
+			return "", err
+		}
+		if template.SystemPrompt != "" {
+			variables, err := contentReq.GetVariables()
+			if err != nil {
+				return "", fmt.Errorf("failed to parse variables: %v", err)
+			}
+			system = renderTemplate(template.SystemPrompt, variables)
+		}
+	}
+
+	if contentReq.BrandID == "" {
+		return system, nil
+	}
+
+	brand, err := s.brandService.brandByID(contentReq.BrandID)
+	if err != nil {
+		return "", err
+	}
+	return system + "\n" + brandProfile(brand), nil
+}
+
+// Regenerate re-runs the request behind a piece of content, optionally with a
+// different prompt or model, producing a new version for each of the
+// request's platforms once it completes. Empty prompt and model keep the
+// request's current values. The run is admitted by the plan and quota of the
+// scope's user, who is charged for it (from the workspace's pool for
+// workspace content) and whose usage it counts towards. The request keeps
+// its owner.
+func (s *ContentService) Regenerate(scope ContentScope, contentID string, prompt string, model string) (*models.ContentRequest, error) {
+	content, err := s.GetContentByID(scope, contentID)
+	if err != nil {
+		return nil, err
+	}
+
+	var contentReq models.ContentRequest
+	if err := s.db.Where("request_id = ?", content.RequestID).First(&contentReq).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch content request: %v", err)
+	}
+	if contentReq.Status == models.RequestQueued || contentReq.Status == models.RequestRunning {
+		return nil, ErrRequestInProgress
+	}
+	contentReq.RunBy = scope.UserID
+	if _, err := s.systemPrompt(&contentReq); err != nil {
+		return nil, err
+	}
+
+	// Claim the request by moving it back to the queue; only one concurrent
+	// regeneration can win.
+	previous := contentReq
+	res := s.db.Model(&models.ContentRequest{}).
+		Where("request_id = ? AND status = ?", contentReq.RequestID, contentReq.Status).
+		Updates(map[string]interface{}{
+			"status":       models.RequestQueued,
+			"error":        "",
+			"started_at":   nil,
+			"completed_at": nil,
+		})
+	if res.Error != nil {
+		return nil, fmt.Errorf("failed to queue content request: %v", res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return nil, ErrRequestInProgress
+	}
+
+	if prompt != "" {
+		contentReq.Prompt = prompt
+	}
+	if model != "" {
+		contentReq.AIModel = model
+	}
+
+	if err := s.admit(&contentReq); err != nil {
+		// Put the request back the way it was
+		if dbErr := s.db.Model(&models.ContentRequest{}).
+			Where("request_id = ?", previous.RequestID).
+			Updates(map[string]interface{}{
+				"status":       previous.Status,
+				"error":        previous.Error,
+				"started_at":   previous.StartedAt,
+				"completed_at": previous.CompletedAt,
+			}).Error; dbErr != nil {
+			log.Printf("Failed to restore content request %s: %v", previous.RequestID, dbErr)
+		}
+		return nil, err
+	}
+
+	if err := s.db.Model(&contentReq).Updates(map[string]interface{}{
+		"run_by":   contentReq.RunBy,
+		"prompt":   contentReq.Prompt,
+		"ai_model": contentReq.AIModel,
+		"streamed": false,
+	}).Error; err != nil {
+		s.finish(&contentReq, err)
+		return nil, fmt.Errorf("failed to update content request: %v", err)
+	}
+	contentReq.Streamed = false
+	contentReq.Status = models.RequestQueued
+	contentReq.Error = ""
+	contentReq.StartedAt = nil
+	contentReq.CompletedAt = nil
+
+	if err := s.queue.Enqueue(contentReq.RequestID); err != nil {
+		s.finish(&contentReq, err)
+		return nil, err
+	}
+
+	return &contentReq, nil
+}
+
+// GetVersions returns every version of the content's request for the
+// content's platform, oldest first.
+func (s *ContentService) GetVersions(scope ContentScope, contentID string) ([]models.GeneratedContent, error) {
+	content, err := s.GetContentByID(scope, contentID)
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []models.GeneratedContent
+	if err := s.db.Where("request_id = ? AND platform = ?", content.RequestID, content.Platform).
+		Order("version").
+		Find(&versions).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch versions: %v", err)
+	}
+	if err := s.signImages(versions); err != nil {
+		return nil, err
+	}
+	return versions, nil
+}
+
+// admit checks the requested model and token quota against the plan of the
+// user running the request and reserves credits for one run, from the
+// workspace's pool if the request belongs to one.
+func (s *ContentService) admit(contentReq *models.ContentRequest) error {
+	if err := s.checkModel(contentReq.RunBy, contentReq.AIModel); err != nil {
+		return err
+	}
+
+	if err := s.usageService.CheckQuota(contentReq.RunBy); err != nil {
+		return err
+	}
+
+	platformIDs, err := requestPlatforms(contentReq)
+	if err != nil {
+		return err
+	}
+
+	return s.creditService.Reserve(contentReq.RunBy, contentReq.WorkspaceID, contentReq.RequestID, generationCost*len(platformIDs))
+}
+
+// create admits a new request and stores it.
+func (s *ContentService) create(contentReq *models.ContentRequest) error {
+	if err := s.admit(contentReq); err != nil {
+		return err
+	}
+
+	if err := s.db.Create(contentReq).Error; err != nil {
+		if refundErr := s.creditService.Refund(contentReq.RunBy, contentReq.RequestID); refundErr != nil {
+			log.Printf("Failed to refund credits for request %s: %v", contentReq.RequestID, refundErr)
+		}
+		return fmt.Errorf("failed to create content request: %v", err)
+	}
+
+	return nil
+}
+
+// checkModel returns an UnknownModelError if model isn't configured and a
+// ModelNotAllowedError if the user's plan doesn't include it.
+func (s *ContentService) checkModel(userID string, model string) error {
+	if !s.aiService.HasModel(model) {
+		return &UnknownModelError{Model: model}
+	}
+
 	var user models.User
 	if err := s.db.First(&user, "user_id = ?", userID).Error; err != nil {
-		return nil, fmt.Errorf("user not found")
+		return fmt.Errorf("user not found")
+	}
+
+	plan, err := s.subscriptionService.GetPlanByTier(user.SubscriptionTier)
+	if err != nil {
+		return err
+	}
+
+	available, err := plan.GetModelsAvailable()
+	if err != nil {
+		return fmt.Errorf("failed to parse models available: %v", err)
+	}
+	for _, m := range available {
+		if m == model {
+			return nil
+		}
+	}
+
+	return &ModelNotAllowedError{Model: model, Tier: user.SubscriptionTier}
+}
+
+// GetRequest returns a content request in the scope and, once it has
+// completed, the latest version of the content it produced for each
+// platform.
+func (s *ContentService) GetRequest(scope ContentScope, requestID string) (*models.ContentRequest, []models.GeneratedContent, error) {
+	var contentReq models.ContentRequest
+	if err := scope.where(s.db).Where("request_id = ?", requestID).First(&contentReq).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrRequestNotFound
+		}
+		return nil, nil, fmt.Errorf("failed to fetch content request: %v", err)
+	}
+
+	if contentReq.Status != models.RequestCompleted {
+		return &contentReq, nil, nil
+	}
+
+	// Every run stores all platforms at once, so they share a version
+	var contents []models.GeneratedContent
+	if err := s.db.Where("request_id = ? AND version = (?)", requestID,
+		s.db.Model(&models.GeneratedContent{}).Select("MAX(version)").Where("request_id = ?", requestID)).
+		Order("id").
+		Find(&contents).Error; err != nil {
+		return nil, nil, fmt.Errorf("failed to fetch generated content: %v", err)
+	}
+	if err := s.signImages(contents); err != nil {
+		return nil, nil, err
+	}
+
+	return &contentReq, contents, nil
+}
+
+// CancelRequest cancels a queued or running request in the scope and returns
+// it as it was left. A running request is cancelled once its worker has
+// aborted the current step, which the response waits for up to cancelWait;
+// after that it is returned still running. Streamed requests stop when their
+// client disconnects and can't be cancelled here.
+func (s *ContentService) CancelRequest(scope ContentScope, requestID string) (*models.ContentRequest, error) {
+	contentReq, _, err := s.GetRequest(scope, requestID)
+	if err != nil {
+		return nil, err
+	}
+
+	switch contentReq.Status {
+	case models.RequestQueued:
+		// The worker checks the status before starting, so flipping it is
+		// enough to make it skip the job.
+		res := s.db.Model(&models.ContentRequest{}).
+			Where("request_id = ? AND status = ?", requestID, models.RequestQueued).
+			Update("status", models.RequestCancelled)
+		if res.Error != nil {
+			return nil, fmt.Errorf("failed to cancel content request: %v", res.Error)
+		}
+		if res.RowsAffected == 0 {
+			// A worker picked it up in the meantime
+			s.stopWorker(requestID)
+		} else {
+			s.finish(contentReq, context.Canceled)
+		}
+	case models.RequestRunning:
+		s.stopWorker(requestID)
+	default:
+		return nil, ErrRequestNotCancellable
+	}
+
+	contentReq, _, err = s.GetRequest(scope, requestID)
+	return contentReq, err
+}
+
+// stopWorker cancels a request's worker and waits up to cancelWait for it to
+// record the outcome.
+func (s *ContentService) stopWorker(requestID string) {
+	done, ok := s.queue.Cancel(requestID)
+	if !ok {
+		return
+	}
+	select {
+	case <-done:
+	case <-time.After(cancelWait):
+	}
+}
+
+// deleteRequests permanently deletes requests and all of their content, and
+// returns the storage keys of their images. Delete the images with
+// deleteImages once the transaction has committed.
+func deleteRequests(tx *gorm.DB, requestIDs []string) ([]string, error) {
+	var imageKeys []string
+	if err := tx.Model(&models.GeneratedContent{}).Unscoped().
+		Where("request_id IN ? AND image_key <> ''", requestIDs).
+		Distinct().Pluck("image_key", &imageKeys).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch images: %v", err)
+	}
+	var derivativeKeys []string
+	if err := tx.Model(&models.GeneratedImage{}).Unscoped().
+		Where("request_id IN ? AND original_id <> ''", requestIDs).
+		Pluck("key", &derivativeKeys).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch image derivatives: %v", err)
+	}
+	imageKeys = append(imageKeys, derivativeKeys...)
+
+	if err := tx.Unscoped().Where("request_id IN ?", requestIDs).Delete(&models.GeneratedContent{}).Error; err != nil {
+		return nil, fmt.Errorf("failed to delete generated content: %v", err)
+	}
+	if err := tx.Unscoped().Where("request_id IN ?", requestIDs).Delete(&models.GeneratedImage{}).Error; err != nil {
+		return nil, fmt.Errorf("failed to delete images: %v", err)
+	}
+	if err := tx.Unscoped().Where("request_id IN ?", requestIDs).Delete(&models.ContentRequest{}).Error; err != nil {
+		return nil, fmt.Errorf("failed to delete content requests: %v", err)
+	}
+	return imageKeys, nil
+}
+
+// stopRequests cancels deleted requests that are still running. Queued ones
+// are skipped by the worker because their row is gone.
+func (s *ContentService) stopRequests(requestIDs []string) {
+	for _, requestID := range requestIDs {
+		s.queue.Cancel(requestID)
+	}
+}
+
+// signImages sets the image URL of each piece of content to a signed URL
+// that expires after imageURLTTL, and fills in the image's derivatives with
+// signed URLs of their own. Only content the caller may see should be
+// signed. Content from before images were kept in storage has no key and
+// keeps the URL it was stored with.
+func (s *ContentService) signImages(contents []models.GeneratedContent) error {
+	var imageIDs []string
+	for i := range contents {
+		if contents[i].ImageID != "" {
+			imageIDs = append(imageIDs, contents[i].ImageID)
+		}
+	}
+	var derivatives []models.GeneratedImage
+	if len(imageIDs) > 0 {
+		if err := s.db.Where("original_id IN ?", imageIDs).Order("id").Find(&derivatives).Error; err != nil {
+			return fmt.Errorf("failed to fetch image derivatives: %v", err)
+		}
+	}
+
+	for i := range contents {
+		if contents[i].ImageKey == "" {
+			continue
+		}
+		imageURL, err := s.storage.SignedURL(contents[i].ImageKey, s.imageURLTTL)
+		if err != nil {
+			return fmt.Errorf("failed to sign image URL: %v", err)
+		}
+		contents[i].ImageURL = imageURL
+
+		contents[i].Derivatives = nil
+		for _, derivative := range derivatives {
+			if derivative.OriginalID != contents[i].ImageID {
+				continue
+			}
+			derivative.URL, err = s.storage.SignedURL(derivative.Key, s.imageURLTTL)
+			if err != nil {
+				return fmt.Errorf("failed to sign image URL: %v", err)
+			}
+			contents[i].Derivatives = append(contents[i].Derivatives, derivative)
+		}
+	}
+	return nil
+}
+
+func (s *ContentService) signImage(content *models.GeneratedContent) error {
+	signed := []models.GeneratedContent{*content}
+	if err := s.signImages(signed); err != nil {
+		return err
 	}
+	*content = signed[0]
+	return nil
+}
 
-	if user.RemainingCredits <= 0 {
-		return nil, fmt.Errorf("no remaining credits")
+// deleteImages removes images from storage. Failures are only logged; the
+// content referring to them is already gone.
+func (s *ContentService) deleteImages(imageKeys []string) {
+	for _, key := range imageKeys {
+		if err := s.storage.Delete(context.Background(), key); err != nil {
+			log.Printf("Failed to delete image %s: %v", key, err)
+		}
 	}
+}
 
-	// Create content request
-	contentReq := models.ContentRequest{
-		RequestID: uuid.New().String(),
-		UserID:    userID,
-		AIModel:   model,
-		Prompt:    prompt,
-		Status:    "pending",
+// makeLegacyImagesPrivate removes public access from images uploaded before
+// images were private. Their content still has the public URL it was stored
+// with, and clearing it marks an image as done, so each is only handled
+// once. Failures are logged and retried on the next start.
+func (s *ContentService) makeLegacyImagesPrivate() {
+	privatizer, ok := s.storage.(objectPrivatizer)
+	if !ok {
+		return
 	}
 
-	if err := s.db.Create(&contentReq).Error; err != nil {
-		return nil, fmt.Errorf("failed to create content request: %v", err)
+	var keys []string
+	if err := s.db.Model(&models.GeneratedContent{}).Unscoped().
+		Where("image_key <> '' AND image_url <> ''").
+		Distinct().Pluck("image_key", &keys).Error; err != nil {
+		log.Printf("Failed to fetch public images: %v", err)
+		return
 	}
 
-	// Generate content
-	response, err := s.aiService.GenerateContent(c, &contentReq)
+	for _, key := range keys {
+		if err := privatizer.MakePrivate(context.Background(), key); err != nil {
+			log.Printf("Failed to make image %s private: %v", key, err)
+			continue
+		}
+		if err := s.db.Model(&models.GeneratedContent{}).Unscoped().
+			Where("image_key = ?", key).
+			Update("image_url", "").Error; err != nil {
+			log.Printf("Failed to clear public URL of image %s: %v", key, err)
+		}
+	}
+	if len(keys) > 0 {
+		log.Printf("Made %d public images private", len(keys))
+	}
+}
+
+// process is the queue worker for a single request.
+func (s *ContentService) process(ctx context.Context, requestID string) {
+	now := time.Now()
+	res := s.db.Model(&models.ContentRequest{}).
+		Where("request_id = ? AND status = ?", requestID, models.RequestQueued).
+		Updates(map[string]interface{}{"status": models.RequestRunning, "started_at": &now})
+	if res.Error != nil {
+		log.Printf("Failed to start content request %s: %v", requestID, res.Error)
+		return
+	}
+	if res.RowsAffected == 0 {
+		// Cancelled while waiting in the queue
+		return
+	}
+
+	var contentReq models.ContentRequest
+	if err := s.db.Where("request_id = ?", requestID).First(&contentReq).Error; err != nil {
+		log.Printf("Failed to load content request %s: %v", requestID, err)
+		return
+	}
+
+	if _, err := s.run(ctx, &contentReq, nil); err != nil {
+		log.Printf("Content request %s failed: %v", requestID, err)
+		s.finish(&contentReq, ctxErr(ctx, err))
+	}
+}
+
+// run generates a caption for each of the request's platforms and one shared
+// image, stores the results as the request's next version and marks the
+// request completed. When onToken is set the text is streamed.
+func (s *ContentService) run(ctx context.Context, contentReq *models.ContentRequest, onToken TokenHandler) ([]models.GeneratedContent, error) {
+	system, err := s.systemPrompt(contentReq)
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate content: %v", err)
+		return nil, err
 	}
 
-	imageResponse, err := s.aiService.GenerateImage(c, &contentReq)
+	platformIDs, err := requestPlatforms(contentReq)
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate image: %v", err)
+		return nil, err
+	}
+
+	contents := make([]models.GeneratedContent, len(platformIDs))
+	for i, platform := range platformIDs {
+		platformSystem := platformPrompt(system, platform)
+
+		// Generate content
+		var result *TextGenerationResult
+		if onToken != nil {
+			result, err = s.aiService.StreamContent(ctx, contentReq, platformSystem, onToken)
+		} else {
+			result, err = s.aiService.GenerateContent(ctx, contentReq, platformSystem)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate content: %v", err)
+		}
+
+		if err := s.recordUsage(contentReq, result.Usage); err != nil {
+			return nil, err
+		}
+
+		contents[i] = models.GeneratedContent{
+			ContentID: uuid.New().String(),
+			RequestID: contentReq.RequestID,
+			Platform:  platform,
+			Output:    fitPlatform(result.Text, platform),
+			CacheKey:  cacheKey(contentReq, platformSystem),
+			Prompt:    contentReq.Prompt,
+			AIModel:   contentReq.AIModel,
+		}
+	}
+
+	// Variants share one image, stored under the first one's ID
+	var image *models.GeneratedImage
+	var derivatives []models.GeneratedImage
+	if !contentReq.TextOnly {
+		image, derivatives, err = s.generateImage(ctx, contentReq, contents[0].ContentID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var latest int
+	if err := s.db.Model(&models.GeneratedContent{}).
+		Where("request_id = ?", contentReq.RequestID).
+		Select("COALESCE(MAX(version), 0)").
+		Scan(&latest).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch content version: %v", err)
+	}
+
+	for i := range contents {
+		if image != nil {
+			contents[i].ImageKey = image.Key
+			contents[i].ImageID = image.ImageID
+		}
+		contents[i].Version = latest + 1
 	}
 
 	// Create generated content
-	generatedContent := &models.GeneratedContent{
-		ContentID: uuid.New().String(),
-		RequestID: contentReq.RequestID,
-		Output:    response,
-		ImageURL:  imageResponse,
-		Version:   1,
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if image != nil {
+			if err := tx.Create(image).Error; err != nil {
+				return fmt.Errorf("failed to record image: %v", err)
+			}
+		}
+		if len(derivatives) > 0 {
+			if err := tx.Create(&derivatives).Error; err != nil {
+				return fmt.Errorf("failed to record image derivatives: %v", err)
+			}
+		}
+		if err := tx.Create(&contents).Error; err != nil {
+			return fmt.Errorf("failed to create generated content: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	if err := s.db.Create(generatedContent).Error; err != nil {
-		return nil, fmt.Errorf("failed to create generated content: %v", err)
+	s.finish(contentReq, nil)
+
+	return contents, nil
+}
+
+// generateImage generates the request's image and stores it under the given
+// name, along with its derivatives.
+func (s *ContentService) generateImage(ctx context.Context, contentReq *models.ContentRequest, name string) (*models.GeneratedImage, []models.GeneratedImage, error) {
+	data, err := s.aiService.GenerateImage(ctx, contentReq)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate image: %v", err)
+	}
+	image, err := inspectImage(data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate image: %v", err)
 	}
 
-	// Deduct credits
-	if err := s.db.Model(&user).Update("remaining_credits", user.RemainingCredits-10).Error; err != nil {
-		return nil, fmt.Errorf("failed to update credits: %v", err)
+	image.ImageID = uuid.New().String()
+	image.RequestID = contentReq.RequestID
+	image.Key = name + "." + imageExtensions[image.Format]
+	if err := s.storage.Put(ctx, image.Key, data, image.ContentType, imageCacheControl); err != nil {
+		return nil, nil, fmt.Errorf("failed to store image: %v", err)
 	}
 
-	if err := s.db.Model(&contentReq).Update("status", "completed").Error; err != nil {
-		return nil, fmt.Errorf("failed to update content request status: %v", err)
+	// The original is enough to work with, so content is still saved
+	// without derivatives if they can't be made
+	derivatives, err := s.storeDerivatives(ctx, image, data)
+	if err != nil {
+		log.Printf("Failed to create derivatives of image %s: %v", image.ImageID, err)
 	}
+	return image, derivatives, nil
+}
 
-	return generatedContent, nil
+// recordUsage records the tokens of one generation for the quota of the user
+// running the request and adds them to the request's totals, which
+// accumulate across platforms and regenerations.
+func (s *ContentService) recordUsage(contentReq *models.ContentRequest, usage TokenUsage) error {
+	contentReq.PromptTokens += usage.PromptTokens
+	contentReq.CompletionTokens += usage.CompletionTokens
+	contentReq.TokensEstimated = contentReq.TokensEstimated || usage.Estimated
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&models.UsageRecord{
+			RequestID:        contentReq.RequestID,
+			UserID:           contentReq.RunBy,
+			PromptTokens:     usage.PromptTokens,
+			CompletionTokens: usage.CompletionTokens,
+			Estimated:        usage.Estimated,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Model(contentReq).Updates(map[string]interface{}{
+			"prompt_tokens":     gorm.Expr("prompt_tokens + ?", usage.PromptTokens),
+			"completion_tokens": gorm.Expr("completion_tokens + ?", usage.CompletionTokens),
+			"tokens_estimated":  contentReq.TokensEstimated,
+		}).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record token usage: %v", err)
+	}
+	return nil
 }
 
-func (s *ContentService) GetUserContent(userID string) ([]models.GeneratedContent, error) {
+// finish records the final status of a request and settles its credit
+// reservation. A nil err means success and context.Canceled means the
+// request was cancelled; anything but success refunds the credits.
+func (s *ContentService) finish(contentReq *models.ContentRequest, err error) {
+	now := time.Now()
+	updates := map[string]interface{}{
+		"status":       models.RequestCompleted,
+		"error":        "",
+		"completed_at": &now,
+	}
+	if errors.Is(err, context.Canceled) {
+		updates["status"] = models.RequestCancelled
+	} else if err != nil {
+		updates["status"] = models.RequestFailed
+		updates["error"] = err.Error()
+	}
+
+	if dbErr := s.db.Model(contentReq).Updates(updates).Error; dbErr != nil {
+		log.Printf("Failed to update content request %s status: %v", contentReq.RequestID, dbErr)
+	}
+
+	settle := s.creditService.Commit
+	if err != nil {
+		settle = s.creditService.Refund
+	}
+	if creditErr := settle(contentReq.RunBy, contentReq.RequestID); creditErr != nil {
+		log.Printf("Failed to settle credits for request %s: %v", contentReq.RequestID, creditErr)
+	}
+}
+
+// ctxErr prefers the context's error so that cancellation is reported as such
+// rather than as whatever the HTTP client wrapped it in.
+func ctxErr(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// GetContent returns all content in the scope.
+func (s *ContentService) GetContent(scope ContentScope) ([]models.GeneratedContent, error) {
 	var content []models.GeneratedContent
-	err := s.db.Joins("JOIN content_requests ON content_requests.request_id = generated_contents.request_id").
-		Where("content_requests.user_id = ?", userID).
+	err := scope.where(s.db.Joins("JOIN content_requests ON content_requests.request_id = generated_contents.request_id")).
 		Find(&content).Error
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch content: %v", err)
 	}
+	if err := s.signImages(content); err != nil {
+		return nil, err
+	}
 	return content, nil
 }
 
-func (s *ContentService) GetContentByID(userID string, contentID string) (*models.GeneratedContent, error) {
+func (s *ContentService) GetContentByID(scope ContentScope, contentID string) (*models.GeneratedContent, error) {
 	var content models.GeneratedContent
-	err := s.db.Joins("JOIN content_requests ON content_requests.request_id = generated_contents.request_id").
-		Where("content_requests.user_id = ? AND generated_contents.content_id = ?", userID, contentID).
+	err := scope.where(s.db.Joins("JOIN content_requests ON content_requests.request_id = generated_contents.request_id")).
+		Where("generated_contents.content_id = ?", contentID).
 		First(&content).Error
 	if err != nil {
-		return nil, fmt.Errorf("content not found: %v", err)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrContentNotFound
+		}
+		return nil, fmt.Errorf("failed to fetch content: %v", err)
+	}
+	if err := s.signImage(&content); err != nil {
+		return nil, err
 	}
 	return &content, nil
 }
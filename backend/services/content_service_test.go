@@ -0,0 +1,94 @@
+package services
+
+import (
+	"ai-content-creation/models"
+	"errors"
+	"testing"
+)
+
+func newTestContentService(t *testing.T) *ContentService {
+	t.Helper()
+	db := newTestDB(t)
+	credits := NewCreditService(db)
+	subscriptions := NewSubscriptionService(db)
+	ai := &AIService{textModels: map[string]ModelConfig{}}
+	for _, m := range defaultTextModels {
+		ai.textModels[m.ID] = m
+	}
+	// The queue isn't started, so queued requests stay queued
+	return NewContentService(db, ai, credits, subscriptions, NewUsageService(db, credits, subscriptions),
+		NewBrandService(db), NewTemplateService(db), nil)
+}
+
+func TestRegenerateByAnotherMember(t *testing.T) {
+	s := newTestContentService(t)
+	db := s.db
+	createTestUser(t, db, "owner", 0)
+	createTestUser(t, db, "member", 0)
+	db.Model(&models.User{}).Where("user_id = ?", "member").Update("subscription_tier", models.ProTier)
+	db.Create(&models.Workspace{WorkspaceID: "ws1", Name: "Team", OwnerID: "owner", RemainingCredits: 100})
+
+	db.Create(&models.ContentRequest{
+		RequestID:   "req-1",
+		UserID:      "owner",
+		RunBy:       "owner",
+		WorkspaceID: "ws1",
+		AIModel:     "llama2-7b",
+		Prompt:      "Launch post",
+		TextOnly:    true,
+		Status:      models.RequestCompleted,
+	})
+	db.Create(&models.GeneratedContent{ContentID: "c1", RequestID: "req-1", Output: "v1", Version: 1})
+
+	// The member's pro plan admits a model the owner's free plan doesn't
+	scope := ContentScope{UserID: "member", WorkspaceID: "ws1"}
+	contentReq, err := s.Regenerate(scope, "c1", "", "mistral-7b")
+	if err != nil {
+		t.Fatalf("Regenerate: %v", err)
+	}
+	if contentReq.UserID != "owner" || contentReq.RunBy != "member" {
+		t.Fatalf("user, run by = %s, %s, want owner, member", contentReq.UserID, contentReq.RunBy)
+	}
+	var stored models.ContentRequest
+	db.First(&stored, "request_id = ?", "req-1")
+	if stored.UserID != "owner" || stored.RunBy != "member" {
+		t.Fatalf("stored user, run by = %s, %s, want owner, member", stored.UserID, stored.RunBy)
+	}
+
+	var reserve models.CreditTransaction
+	db.Where("request_id = ? AND type = ?", "req-1", models.CreditReserve).First(&reserve)
+	if reserve.UserID != "member" || reserve.WorkspaceID != "ws1" || reserve.Amount != -generationCost {
+		t.Fatalf("reservation = %+v, want %d from ws1 by member", reserve, generationCost)
+	}
+
+	// What the worker does once the run completes
+	if err := s.recordUsage(contentReq, TokenUsage{PromptTokens: 70, CompletionTokens: 30}); err != nil {
+		t.Fatalf("recordUsage: %v", err)
+	}
+	s.finish(contentReq, nil)
+
+	for userID, want := range map[string]int{"member": 100, "owner": 0} {
+		usage, err := s.usageService.GetUsage(userID)
+		if err != nil {
+			t.Fatalf("GetUsage: %v", err)
+		}
+		if usage.TokensUsed != want {
+			t.Errorf("%s used %d tokens, want %d", userID, usage.TokensUsed, want)
+		}
+	}
+	var commits int64
+	db.Model(&models.CreditTransaction{}).Where("request_id = ? AND type = ? AND user_id = ?", "req-1", models.CreditCommit, "member").Count(&commits)
+	if commits != 1 {
+		t.Errorf("%d commits by member, want 1", commits)
+	}
+
+	// The owner's own regeneration is admitted by the owner's plan
+	var notAllowed *ModelNotAllowedError
+	if _, err := s.Regenerate(ContentScope{UserID: "owner", WorkspaceID: "ws1"}, "c1", "", ""); !errors.As(err, &notAllowed) {
+		t.Fatalf("owner regenerating with mistral-7b = %v, want ModelNotAllowedError", err)
+	}
+	db.First(&stored, "request_id = ?", "req-1")
+	if stored.RunBy != "member" || stored.Status != models.RequestCompleted {
+		t.Errorf("refused regeneration changed the request: run by %s, status %s", stored.RunBy, stored.Status)
+	}
+}
@@ -0,0 +1,316 @@
+package services
+
+import (
+	"ai-content-creation/models"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var ErrInsufficientCredits = errors.New("no remaining credits")
+
+// CreditService owns every change to User.RemainingCredits and
+// Workspace.RemainingCredits. Each change is applied with a conditional UPDATE
+// and recorded in the credit_transactions ledger inside the same database
+// transaction.
+type CreditService struct {
+	db *gorm.DB
+}
+
+func NewCreditService(db *gorm.DB) *CreditService {
+	return &CreditService{db: db}
+}
+
+// WithTx returns a CreditService that runs inside an existing transaction.
+func (s *CreditService) WithTx(tx *gorm.DB) *CreditService {
+	return &CreditService{db: tx}
+}
+
+// Reserve holds amount credits for a request, from the workspace's pool when
+// workspaceID is set and from the user's own balance otherwise. It fails with
+// ErrInsufficientCredits if the balance is too low.
+func (s *CreditService) Reserve(userID, workspaceID, requestID string, amount int) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		// Workspace pools are only topped up by transfers
+		if workspaceID == "" {
+			if err := applyMonthlyReset(tx, userID); err != nil {
+				return err
+			}
+		}
+
+		res := balance(tx, userID, workspaceID).
+			Where("remaining_credits >= ?", amount).
+			Update("remaining_credits", gorm.Expr("remaining_credits - ?", amount))
+		if res.Error != nil {
+			return fmt.Errorf("failed to reserve credits: %v", res.Error)
+		}
+		if res.RowsAffected == 0 {
+			return ErrInsufficientCredits
+		}
+
+		return record(tx, userID, workspaceID, requestID, models.CreditReserve, -amount, "")
+	})
+}
+
+// Commit finalises a reservation once its request has completed. The balance
+// was already reduced by Reserve, so this only records the outcome.
+func (s *CreditService) Commit(userID, requestID string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		reserve, settled, err := reservation(tx, requestID)
+		if err != nil || reserve == nil || settled {
+			return err
+		}
+		return record(tx, userID, reserve.WorkspaceID, requestID, models.CreditCommit, 0, "")
+	})
+}
+
+// Refund returns a reservation to the balance it was taken from after a
+// request failed or was cancelled. Refunding an already settled reservation
+// is a no-op.
+func (s *CreditService) Refund(userID, requestID string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		reserve, settled, err := reservation(tx, requestID)
+		if err != nil || reserve == nil || settled {
+			return err
+		}
+
+		if err := balance(tx, userID, reserve.WorkspaceID).
+			Update("remaining_credits", gorm.Expr("remaining_credits + ?", -reserve.Amount)).Error; err != nil {
+			return fmt.Errorf("failed to refund credits: %v", err)
+		}
+
+		return record(tx, userID, reserve.WorkspaceID, requestID, models.CreditRefund, -reserve.Amount, "")
+	})
+}
+
+// Grant adds amount credits to a user's balance. A negative amount revokes
+// credits, never taking the balance below zero.
+func (s *CreditService) Grant(userID string, amount int, reason string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		query := tx.Model(&models.User{}).Where("user_id = ?", userID)
+		if amount < 0 {
+			query = query.Where("remaining_credits >= ?", -amount)
+		}
+
+		res := query.Update("remaining_credits", gorm.Expr("remaining_credits + ?", amount))
+		if res.Error != nil {
+			return fmt.Errorf("failed to grant credits: %v", res.Error)
+		}
+		if res.RowsAffected == 0 {
+			if amount < 0 {
+				return ErrInsufficientCredits
+			}
+			return fmt.Errorf("user not found")
+		}
+
+		return record(tx, userID, "", "", models.CreditGrant, amount, reason)
+	})
+}
+
+// ResetCredits sets a user's balance to amount and starts a new monthly
+// period, for a subscription that has just been paid for.
+func (s *CreditService) ResetCredits(userID string, amount int, reason string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var user models.User
+		if err := tx.First(&user, "user_id = ?", userID).Error; err != nil {
+			return fmt.Errorf("user not found")
+		}
+
+		next := time.Now().AddDate(0, 1, 0)
+		if err := tx.Model(&user).Updates(map[string]interface{}{
+			"remaining_credits": amount,
+			"credits_reset_at":  &next,
+		}).Error; err != nil {
+			return fmt.Errorf("failed to reset credits: %v", err)
+		}
+
+		return record(tx, userID, "", "", models.CreditMonthlyReset, amount-user.RemainingCredits, reason)
+	})
+}
+
+// Transfer moves amount credits from a user's own balance into a workspace's
+// pool. It fails with ErrInsufficientCredits if the user's balance is too low.
+func (s *CreditService) Transfer(userID, workspaceID string, amount int) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := applyMonthlyReset(tx, userID); err != nil {
+			return err
+		}
+
+		res := balance(tx, userID, "").
+			Where("remaining_credits >= ?", amount).
+			Update("remaining_credits", gorm.Expr("remaining_credits - ?", amount))
+		if res.Error != nil {
+			return fmt.Errorf("failed to transfer credits: %v", res.Error)
+		}
+		if res.RowsAffected == 0 {
+			return ErrInsufficientCredits
+		}
+		if err := record(tx, userID, "", "", models.CreditTransfer, -amount, "to workspace "+workspaceID); err != nil {
+			return err
+		}
+
+		res = balance(tx, userID, workspaceID).
+			Update("remaining_credits", gorm.Expr("remaining_credits + ?", amount))
+		if res.Error != nil {
+			return fmt.Errorf("failed to transfer credits: %v", res.Error)
+		}
+		if res.RowsAffected == 0 {
+			return ErrWorkspaceNotFound
+		}
+		return record(tx, userID, workspaceID, "", models.CreditTransfer, amount, "")
+	})
+}
+
+// GetBalance returns the user's current balance and next reset date, applying
+// a monthly reset first if one is due.
+func (s *CreditService) GetBalance(userID string) (*models.User, error) {
+	var user models.User
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := applyMonthlyReset(tx, userID); err != nil {
+			return err
+		}
+		if err := tx.First(&user, "user_id = ?", userID).Error; err != nil {
+			return fmt.Errorf("user not found")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// GetHistory returns the ledger of the user's own balance, newest first.
+func (s *CreditService) GetHistory(userID string, limit, offset int) ([]models.CreditTransaction, error) {
+	var transactions []models.CreditTransaction
+	if err := s.db.Where("user_id = ? AND workspace_id = ''", userID).
+		Order("id DESC").
+		Limit(limit).
+		Offset(offset).
+		Find(&transactions).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch credit history: %v", err)
+	}
+	return transactions, nil
+}
+
+// GetWorkspaceHistory returns the ledger of a workspace's pool, newest first.
+func (s *CreditService) GetWorkspaceHistory(workspaceID string, limit, offset int) ([]models.CreditTransaction, error) {
+	var transactions []models.CreditTransaction
+	if err := s.db.Where("workspace_id = ?", workspaceID).
+		Order("id DESC").
+		Limit(limit).
+		Offset(offset).
+		Find(&transactions).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch credit history: %v", err)
+	}
+	return transactions, nil
+}
+
+// applyMonthlyReset restores the user's balance to their plan's monthly
+// allowance when the reset date has passed. Users without a reset date get
+// one a month from now. The balance of a Stripe subscriber is reset by each
+// paid invoice instead, so for them only the date moves on.
+func applyMonthlyReset(tx *gorm.DB, userID string) error {
+	var user models.User
+	if err := tx.First(&user, "user_id = ?", userID).Error; err != nil {
+		return fmt.Errorf("user not found")
+	}
+
+	now := time.Now()
+	if user.CreditsResetAt == nil {
+		next := now.AddDate(0, 1, 0)
+		return tx.Model(&user).Update("credits_reset_at", &next).Error
+	}
+	if now.Before(*user.CreditsResetAt) {
+		return nil
+	}
+
+	var plan models.SubscriptionPlan
+	if err := tx.Where("tier = ?", user.SubscriptionTier).First(&plan).Error; err != nil {
+		return fmt.Errorf("plan not found: %v", err)
+	}
+
+	next := *user.CreditsResetAt
+	for !next.After(now) {
+		next = next.AddDate(0, 1, 0)
+	}
+
+	subscriber := user.StripeSubscriptionID != ""
+	updates := map[string]interface{}{"credits_reset_at": &next}
+	if !subscriber {
+		updates["remaining_credits"] = plan.MonthlyCredits
+	}
+
+	// Only the first concurrent caller to see the old reset date wins
+	res := tx.Model(&models.User{}).
+		Where("user_id = ? AND credits_reset_at = ?", userID, user.CreditsResetAt).
+		Updates(updates)
+	if res.Error != nil {
+		return fmt.Errorf("failed to reset credits: %v", res.Error)
+	}
+	if res.RowsAffected == 0 || subscriber {
+		return nil
+	}
+
+	return record(tx, userID, "", "", models.CreditMonthlyReset, plan.MonthlyCredits-user.RemainingCredits, "")
+}
+
+// reservation returns the latest reservation entry for a request, or nil if
+// there is none, and whether it has already been committed or refunded. A
+// request is reserved again each time it is regenerated.
+func reservation(tx *gorm.DB, requestID string) (*models.CreditTransaction, bool, error) {
+	var entries []models.CreditTransaction
+	if err := tx.Where("request_id = ?", requestID).Order("id").Find(&entries).Error; err != nil {
+		return nil, false, fmt.Errorf("failed to fetch reservation: %v", err)
+	}
+
+	var reserve *models.CreditTransaction
+	settled := false
+	for i, e := range entries {
+		switch e.Type {
+		case models.CreditReserve:
+			reserve, settled = &entries[i], false
+		case models.CreditCommit, models.CreditRefund:
+			settled = true
+		}
+	}
+	return reserve, settled, nil
+}
+
+// balance selects the balance credits move in and out of: the workspace's
+// pool when workspaceID is set, otherwise the user's own.
+func balance(tx *gorm.DB, userID, workspaceID string) *gorm.DB {
+	if workspaceID != "" {
+		return tx.Model(&models.Workspace{}).Where("workspace_id = ?", workspaceID)
+	}
+	return tx.Model(&models.User{}).Where("user_id = ?", userID)
+}
+
+// record appends a ledger entry, reading the balance it resulted in.
+func record(tx *gorm.DB, userID, workspaceID, requestID string, txType models.CreditTransactionType, amount int, reason string) error {
+	var balances []int
+	if err := balance(tx, userID, workspaceID).Pluck("remaining_credits", &balances).Error; err != nil || len(balances) == 0 {
+		if workspaceID != "" {
+			return ErrWorkspaceNotFound
+		}
+		return fmt.Errorf("user not found")
+	}
+
+	entry := models.CreditTransaction{
+		TransactionID: uuid.New().String(),
+		UserID:        userID,
+		WorkspaceID:   workspaceID,
+		RequestID:     requestID,
+		Type:          txType,
+		Amount:        amount,
+		BalanceAfter:  balances[0],
+		Reason:        reason,
+	}
+	if err := tx.Create(&entry).Error; err != nil {
+		return fmt.Errorf("failed to record credit transaction: %v", err)
+	}
+	return nil
+}
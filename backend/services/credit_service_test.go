@@ -0,0 +1,176 @@
+package services
+
+import (
+	"ai-content-creation/models"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func creditsOf(t *testing.T, s *CreditService, userID string) int {
+	t.Helper()
+	user, err := s.GetBalance(userID)
+	if err != nil {
+		t.Fatalf("GetBalance: %v", err)
+	}
+	return user.RemainingCredits
+}
+
+func TestReserveCommitRefund(t *testing.T) {
+	db := newTestDB(t)
+	s := NewCreditService(db)
+	createTestUser(t, db, "u1", 100)
+
+	if err := s.Reserve("u1", "", "req-1", 30); err != nil {
+		t.Fatalf("Reserve: %v", err)
+	}
+	if got := creditsOf(t, s, "u1"); got != 70 {
+		t.Fatalf("balance after reserve = %d, want 70", got)
+	}
+	if err := s.Commit("u1", "req-1"); err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+	// A committed reservation is spent and can't be refunded
+	if err := s.Refund("u1", "req-1"); err != nil {
+		t.Fatalf("Refund after commit: %v", err)
+	}
+	if got := creditsOf(t, s, "u1"); got != 70 {
+		t.Fatalf("balance after commit = %d, want 70", got)
+	}
+
+	if err := s.Reserve("u1", "", "req-2", 20); err != nil {
+		t.Fatalf("Reserve: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := s.Refund("u1", "req-2"); err != nil {
+			t.Fatalf("Refund: %v", err)
+		}
+	}
+	if got := creditsOf(t, s, "u1"); got != 70 {
+		t.Fatalf("balance after refunds = %d, want 70", got)
+	}
+
+	history, err := s.GetHistory("u1", 10, 0)
+	if err != nil {
+		t.Fatalf("GetHistory: %v", err)
+	}
+	counts := map[models.CreditTransactionType]int{}
+	for _, e := range history {
+		counts[e.Type]++
+	}
+	want := map[models.CreditTransactionType]int{models.CreditReserve: 2, models.CreditCommit: 1, models.CreditRefund: 1}
+	for typ, n := range want {
+		if counts[typ] != n {
+			t.Errorf("%s entries = %d, want %d", typ, counts[typ], n)
+		}
+	}
+}
+
+func TestReserveInsufficientCredits(t *testing.T) {
+	db := newTestDB(t)
+	s := NewCreditService(db)
+	createTestUser(t, db, "u1", 10)
+
+	if err := s.Reserve("u1", "", "req-1", 11); !errors.Is(err, ErrInsufficientCredits) {
+		t.Fatalf("Reserve = %v, want ErrInsufficientCredits", err)
+	}
+	if got := creditsOf(t, s, "u1"); got != 10 {
+		t.Fatalf("balance = %d, want 10", got)
+	}
+	var entries int64
+	db.Model(&models.CreditTransaction{}).Where("request_id = ?", "req-1").Count(&entries)
+	if entries != 0 {
+		t.Fatalf("failed reservation left %d ledger entries", entries)
+	}
+}
+
+func TestReserveConcurrentRequests(t *testing.T) {
+	db := newTestDB(t)
+	s := NewCreditService(db)
+	createTestUser(t, db, "u1", 100)
+
+	const requests = 25
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		reserved []string
+	)
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func(requestID string) {
+			defer wg.Done()
+			err := s.Reserve("u1", "", requestID, 10)
+			switch {
+			case err == nil:
+				mu.Lock()
+				reserved = append(reserved, requestID)
+				mu.Unlock()
+			case !errors.Is(err, ErrInsufficientCredits):
+				t.Errorf("Reserve(%s): %v", requestID, err)
+			}
+		}(fmt.Sprintf("req-%d", i))
+	}
+	wg.Wait()
+
+	if len(reserved) != 10 {
+		t.Fatalf("%d reservations succeeded, want 10", len(reserved))
+	}
+	if got := creditsOf(t, s, "u1"); got != 0 {
+		t.Fatalf("balance = %d, want 0", got)
+	}
+
+	// Cancellation and the worker can both try to refund the same request
+	for _, requestID := range reserved {
+		for i := 0; i < 2; i++ {
+			wg.Add(1)
+			go func(requestID string) {
+				defer wg.Done()
+				if err := s.Refund("u1", requestID); err != nil {
+					t.Errorf("Refund(%s): %v", requestID, err)
+				}
+			}(requestID)
+		}
+	}
+	wg.Wait()
+
+	if got := creditsOf(t, s, "u1"); got != 100 {
+		t.Fatalf("balance after refunds = %d, want 100", got)
+	}
+	var refunds int64
+	db.Model(&models.CreditTransaction{}).Where("type = ?", models.CreditRefund).Count(&refunds)
+	if refunds != 10 {
+		t.Fatalf("%d refund entries, want 10", refunds)
+	}
+}
+
+func TestReserveFromWorkspacePool(t *testing.T) {
+	db := newTestDB(t)
+	s := NewCreditService(db)
+	createTestUser(t, db, "u1", 50)
+	if err := db.Create(&models.Workspace{WorkspaceID: "ws1", Name: "Team", OwnerID: "u1"}).Error; err != nil {
+		t.Fatalf("create workspace: %v", err)
+	}
+
+	if err := s.Transfer("u1", "ws1", 30); err != nil {
+		t.Fatalf("Transfer: %v", err)
+	}
+	if err := s.Reserve("u1", "ws1", "req-1", 40); !errors.Is(err, ErrInsufficientCredits) {
+		t.Fatalf("Reserve over pool = %v, want ErrInsufficientCredits", err)
+	}
+	if err := s.Reserve("u1", "ws1", "req-2", 25); err != nil {
+		t.Fatalf("Reserve: %v", err)
+	}
+	if err := s.Refund("u1", "req-2"); err != nil {
+		t.Fatalf("Refund: %v", err)
+	}
+
+	var ws models.Workspace
+	db.First(&ws, "workspace_id = ?", "ws1")
+	if ws.RemainingCredits != 30 {
+		t.Fatalf("pool = %d, want 30", ws.RemainingCredits)
+	}
+	if got := creditsOf(t, s, "u1"); got != 20 {
+		t.Fatalf("personal balance = %d, want 20", got)
+	}
+}
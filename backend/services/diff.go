@@ -0,0 +1,66 @@
+package services
+
+import "strings"
+
+// DiffOp is one run of a word-level diff.
+type DiffOp struct {
+	Op   string `json:"op"` // "equal", "insert" or "delete"
+	Text string `json:"text"`
+}
+
+// DiffWords returns the word-level edits that turn a into b, using a longest
+// common subsequence over whitespace-separated words. Captions are short, so
+// the quadratic table is fine.
+func DiffWords(a, b string) []DiffOp {
+	x, y := strings.Fields(a), strings.Fields(b)
+
+	// lcs[i][j] is the LCS length of x[i:] and y[j:]
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var ops []DiffOp
+	add := func(op, word string) {
+		if n := len(ops); n > 0 && ops[n-1].Op == op {
+			ops[n-1].Text += " " + word
+			return
+		}
+		ops = append(ops, DiffOp{Op: op, Text: word})
+	}
+
+	i, j := 0, 0
+	for i < len(x) && j < len(y) {
+		switch {
+		case x[i] == y[j]:
+			add("equal", x[i])
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			add("delete", x[i])
+			i++
+		default:
+			add("insert", y[j])
+			j++
+		}
+	}
+	for ; i < len(x); i++ {
+		add("delete", x[i])
+	}
+	for ; j < len(y); j++ {
+		add("insert", y[j])
+	}
+
+	return ops
+}
@@ -0,0 +1,65 @@
+package services
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// envInt reads an integer from the environment, falling back to def when the
+// variable is unset or invalid.
+func envInt(key string, def int) int {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return def
+	}
+	v, err := strconv.Atoi(raw)
+	if err != nil {
+		log.Printf("Warning: invalid %s %q, using %d", key, raw, def)
+		return def
+	}
+	return v
+}
+
+// envDuration reads a time.ParseDuration value from the environment, falling
+// back to def when the variable is unset or invalid.
+func envDuration(key string, def time.Duration) time.Duration {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return def
+	}
+	v, err := time.ParseDuration(raw)
+	if err != nil {
+		log.Printf("Warning: invalid %s %q, using %s", key, raw, def)
+		return def
+	}
+	return v
+}
+
+// envRateLimit reads a rate limit such as "60/1m" (60 requests a minute) from
+// the environment. "0" means no limit. It falls back to def when the variable
+// is unset or invalid.
+func envRateLimit(key string, def RateLimit) RateLimit {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return def
+	}
+	if raw == "0" {
+		return RateLimit{}
+	}
+
+	requests, per, ok := strings.Cut(raw, "/")
+	n, err := strconv.Atoi(requests)
+	if !ok || err != nil || n < 0 {
+		log.Printf("Warning: invalid %s %q, using %s", key, raw, def)
+		return def
+	}
+	d, err := time.ParseDuration(per)
+	if err != nil || d <= 0 {
+		log.Printf("Warning: invalid %s %q, using %s", key, raw, def)
+		return def
+	}
+	return RateLimit{Requests: n, Per: d}
+}
@@ -0,0 +1,92 @@
+package services
+
+import (
+	"ai-content-creation/models"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// UnknownModelError is returned when a request names a model that isn't
+// configured.
+type UnknownModelError struct {
+	Model string
+}
+
+func (e *UnknownModelError) Error() string {
+	return fmt.Sprintf("unknown model %q", e.Model)
+}
+
+// ModelNotAllowedError is returned when a model exists but isn't part of the
+// user's subscription plan.
+type ModelNotAllowedError struct {
+	Model string
+	Tier  models.SubscriptionTier
+}
+
+func (e *ModelNotAllowedError) Error() string {
+	return fmt.Sprintf("model %q is not available on the %s plan", e.Model, e.Tier)
+}
+
+// UnknownPlatformError is returned when a request targets a platform we have
+// no conventions for.
+type UnknownPlatformError struct {
+	Platform string
+}
+
+func (e *UnknownPlatformError) Error() string {
+	return fmt.Sprintf("unknown platform %q", e.Platform)
+}
+
+// TemplateVariablesError is returned when the variables of a request don't
+// match the placeholders of its template.
+type TemplateVariablesError struct {
+	Missing []string
+	Unknown []string
+	Empty   []string
+}
+
+func (e *TemplateVariablesError) Error() string {
+	var problems []string
+	if len(e.Missing) > 0 {
+		problems = append(problems, "missing variables: "+strings.Join(e.Missing, ", "))
+	}
+	if len(e.Unknown) > 0 {
+		problems = append(problems, "unknown variables: "+strings.Join(e.Unknown, ", "))
+	}
+	if len(e.Empty) > 0 {
+		problems = append(problems, "empty variables: "+strings.Join(e.Empty, ", "))
+	}
+	return strings.Join(problems, "; ")
+}
+
+// ImageOptionError is returned when an image option is invalid or the image
+// model doesn't support it.
+type ImageOptionError struct {
+	Option string
+	Reason string
+}
+
+func (e *ImageOptionError) Error() string {
+	return fmt.Sprintf("invalid image option %s: %s", e.Option, e.Reason)
+}
+
+// MissingScopeError is returned when an API key is used for an endpoint that
+// needs a scope the key wasn't given.
+type MissingScopeError struct {
+	Scope string
+}
+
+func (e *MissingScopeError) Error() string {
+	return fmt.Sprintf("API key is missing the %s scope", e.Scope)
+}
+
+// LoginThrottledError is returned when too many sign-ins have failed for an
+// email or IP. The attempt was refused without checking the password.
+type LoginThrottledError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LoginThrottledError) Error() string {
+	return fmt.Sprintf("too many failed sign-in attempts, try again in %s", e.RetryAfter.Round(time.Second))
+}
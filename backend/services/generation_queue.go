@@ -0,0 +1,103 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+var ErrQueueFull = errors.New("generation queue is full, try again later")
+
+// GenerationQueue runs content requests on a fixed number of workers.
+// Jobs are identified by their RequestID; the job state itself lives in the
+// content_requests table so it survives restarts.
+type GenerationQueue struct {
+	jobs    chan string
+	workers int
+
+	mu      sync.Mutex
+	running map[string]*runningJob
+}
+
+type runningJob struct {
+	cancel context.CancelFunc
+	done   chan struct{} // closed once the job's handler has returned
+}
+
+// NewGenerationQueue creates a queue with the given number of workers and
+// room for size waiting jobs.
+func NewGenerationQueue(workers, size int) *GenerationQueue {
+	if workers < 1 {
+		workers = 1
+	}
+	if size < 0 {
+		size = 0
+	}
+	return &GenerationQueue{
+		jobs:    make(chan string, size),
+		workers: workers,
+		running: make(map[string]*runningJob),
+	}
+}
+
+// Start launches the workers. handle is called once per job with a context
+// that is cancelled if Cancel is called for that job.
+func (q *GenerationQueue) Start(handle func(ctx context.Context, requestID string)) {
+	for i := 0; i < q.workers; i++ {
+		go func() {
+			for requestID := range q.jobs {
+				q.run(requestID, handle)
+			}
+		}()
+	}
+}
+
+func (q *GenerationQueue) run(requestID string, handle func(ctx context.Context, requestID string)) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	job := &runningJob{cancel: cancel, done: make(chan struct{})}
+	q.mu.Lock()
+	q.running[requestID] = job
+	q.mu.Unlock()
+
+	defer func() {
+		q.mu.Lock()
+		delete(q.running, requestID)
+		q.mu.Unlock()
+		close(job.done)
+	}()
+
+	handle(ctx, requestID)
+}
+
+// Enqueue adds a job without blocking, returning ErrQueueFull if there is no
+// room left.
+func (q *GenerationQueue) Enqueue(requestID string) error {
+	select {
+	case q.jobs <- requestID:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// push adds a job, blocking until there is room.
+func (q *GenerationQueue) push(requestID string) {
+	q.jobs <- requestID
+}
+
+// Cancel stops a job that is currently being processed. It reports whether
+// the job was running and, if so, returns a channel that is closed once its
+// handler has returned.
+func (q *GenerationQueue) Cancel(requestID string) (<-chan struct{}, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	job, ok := q.running[requestID]
+	if !ok {
+		return nil, false
+	}
+	job.cancel()
+	return job.done, true
+}
@@ -0,0 +1,61 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestGenerationQueueFull(t *testing.T) {
+	q := NewGenerationQueue(1, 2) // not started, so nothing drains it
+
+	for _, id := range []string{"req-1", "req-2"} {
+		if err := q.Enqueue(id); err != nil {
+			t.Fatalf("Enqueue(%s): %v", id, err)
+		}
+	}
+	if err := q.Enqueue("req-3"); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("Enqueue beyond size = %v, want ErrQueueFull", err)
+	}
+}
+
+func TestGenerationQueueCancelWaitsForHandler(t *testing.T) {
+	q := NewGenerationQueue(1, 1)
+	started := make(chan struct{})
+	finished := make(chan struct{})
+	q.Start(func(ctx context.Context, requestID string) {
+		close(started)
+		<-ctx.Done()
+		// The handler records the cancellation before returning
+		time.Sleep(10 * time.Millisecond)
+		close(finished)
+	})
+
+	if _, ok := q.Cancel("req-1"); ok {
+		t.Fatal("Cancel reported a job that isn't running")
+	}
+	if err := q.Enqueue("req-1"); err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+	<-started
+
+	done, ok := q.Cancel("req-1")
+	if !ok {
+		t.Fatal("Cancel didn't find the running job")
+	}
+	select {
+	case <-done:
+		select {
+		case <-finished:
+		default:
+			t.Fatal("done was closed before the handler returned")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("handler wasn't cancelled")
+	}
+
+	if _, ok := q.Cancel("req-1"); ok {
+		t.Fatal("Cancel found a job that has finished")
+	}
+}
@@ -0,0 +1,52 @@
+package services
+
+import (
+	"ai-content-creation/models"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+
+	_ "golang.org/x/image/webp"
+)
+
+var ErrUnsupportedImage = errors.New("unsupported image format")
+
+// imageCacheControl is set on stored images. Keys are never reused, so an
+// image can be cached for as long as a client likes, but only by the client:
+// images are private.
+const imageCacheControl = "private, max-age=31536000, immutable"
+
+// imageExtensions maps the formats inspectImage recognises to the file
+// extension images of that format are stored with.
+var imageExtensions = map[string]string{
+	"jpeg": "jpg",
+	"png":  "png",
+	"gif":  "gif",
+	"webp": "webp",
+}
+
+// inspectImage detects the format and dimensions of an image from its bytes
+// and returns them with its size and SHA-256 hash, ready to be recorded.
+// Providers don't reliably say what they return, so the bytes are the only
+// source of truth.
+func inspectImage(data []byte) (*models.GeneratedImage, error) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupportedImage
+	}
+
+	hash := sha256.Sum256(data)
+	return &models.GeneratedImage{
+		Format:      format,
+		ContentType: "image/" + format,
+		Width:       config.Width,
+		Height:      config.Height,
+		Size:        int64(len(data)),
+		Hash:        hex.EncodeToString(hash[:]),
+	}, nil
+}
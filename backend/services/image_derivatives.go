@@ -0,0 +1,169 @@
+package services
+
+import (
+	"ai-content-creation/models"
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"math"
+
+	"github.com/google/uuid"
+)
+
+// imageDerivative is a size generated images are also stored in. Cropped
+// derivatives are exactly Width x Height, cut from the middle of the image;
+// the others fit within Width x Height and keep the image's proportions.
+type imageDerivative struct {
+	Name   string
+	Width  int
+	Height int
+	Crop   bool
+}
+
+var imageDerivatives = []imageDerivative{
+	{Name: "thumbnail", Width: 320, Height: 320},
+	{Name: "square", Width: 1080, Height: 1080, Crop: true},   // feed posts
+	{Name: "story", Width: 1080, Height: 1920, Crop: true},    // stories and reels
+	{Name: "link_card", Width: 1200, Height: 628, Crop: true}, // link previews
+}
+
+// derivativeQuality is the JPEG quality derivatives are encoded with
+const derivativeQuality = 85
+
+// storeDerivatives resizes an original image to each of imageDerivatives and
+// stores the copies next to it as JPEGs.
+func (s *ContentService) storeDerivatives(ctx context.Context, original *models.GeneratedImage, data []byte) ([]models.GeneratedImage, error) {
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %v", err)
+	}
+
+	base := original.Key[:len(original.Key)-len(imageExtensions[original.Format])-1]
+	var derivatives []models.GeneratedImage
+	for _, d := range imageDerivatives {
+		resized := resize(src, d.Width, d.Height, d.Crop)
+
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, resized, &jpeg.Options{Quality: derivativeQuality}); err != nil {
+			return nil, fmt.Errorf("failed to encode %s: %v", d.Name, err)
+		}
+
+		derivative, err := inspectImage(buf.Bytes())
+		if err != nil {
+			return nil, err
+		}
+		derivative.ImageID = uuid.New().String()
+		derivative.RequestID = original.RequestID
+		derivative.OriginalID = original.ImageID
+		derivative.Derivative = d.Name
+		derivative.Key = base + "-" + d.Name + "." + imageExtensions[derivative.Format]
+		if err := s.storage.Put(ctx, derivative.Key, buf.Bytes(), derivative.ContentType, imageCacheControl); err != nil {
+			return nil, fmt.Errorf("failed to store %s: %v", d.Name, err)
+		}
+		derivatives = append(derivatives, *derivative)
+	}
+	return derivatives, nil
+}
+
+// resize scales src to width x height. With crop set, the largest centred
+// area of the target's proportions is cut out first; otherwise the result is
+// shrunk to fit within width x height with src's proportions, and is never
+// enlarged. Transparent areas are flattened onto white, since derivatives
+// are JPEGs.
+func resize(src image.Image, width int, height int, crop bool) *image.RGBA {
+	bounds := src.Bounds()
+	sw, sh := bounds.Dx(), bounds.Dy()
+	if crop {
+		// Cut the source to the target's aspect ratio
+		if sw*height > sh*width {
+			cw := max(1, sh*width/height)
+			bounds.Min.X += (sw - cw) / 2
+			bounds.Max.X = bounds.Min.X + cw
+		} else {
+			ch := max(1, sw*height/width)
+			bounds.Min.Y += (sh - ch) / 2
+			bounds.Max.Y = bounds.Min.Y + ch
+		}
+		sw, sh = bounds.Dx(), bounds.Dy()
+	} else {
+		scale := math.Min(1, math.Min(float64(width)/float64(sw), float64(height)/float64(sh)))
+		width = max(1, int(math.Round(float64(sw)*scale)))
+		height = max(1, int(math.Round(float64(sh)*scale)))
+	}
+
+	flat := image.NewRGBA(image.Rect(0, 0, sw, sh))
+	draw.Draw(flat, flat.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(flat, flat.Bounds(), src, bounds.Min, draw.Over)
+
+	// Each pass resizes rows and transposes, so doing it twice resizes both
+	// axes and leaves the pixels the right way round
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	dst.Pix = resampleRows(resampleRows(flat.Pix, sw, sh, width), sh, width, height)
+	return dst
+}
+
+// resampleRows scales each of the h rows of a w x h RGBA image to newW
+// pixels with a triangle filter and returns the result transposed, as newW
+// rows of h pixels. When shrinking, the filter is widened so that every
+// source pixel contributes.
+func resampleRows(pix []uint8, w int, h int, newW int) []uint8 {
+	scale := float64(newW) / float64(w)
+	support := 1.0
+	if scale < 1 {
+		support = 1 / scale
+	}
+
+	// Work out every output pixel's weights once and reuse them per row
+	type tap struct {
+		first   int
+		weights []float64
+	}
+	taps := make([]tap, newW)
+	for x := range taps {
+		center := (float64(x)+0.5)/scale - 0.5
+		first := max(0, int(math.Ceil(center-support)))
+		last := min(w-1, int(math.Floor(center+support)))
+		var weights []float64
+		var total float64
+		for i := first; i <= last; i++ {
+			weight := math.Max(0, 1-math.Abs(float64(i)-center)/support)
+			weights = append(weights, weight)
+			total += weight
+		}
+		if total == 0 {
+			// Only happens at the very edge; take the nearest pixel
+			first = min(max(0, int(math.Round(center))), w-1)
+			weights, total = []float64{1}, 1
+		}
+		for i := range weights {
+			weights[i] /= total
+		}
+		taps[x] = tap{first: first, weights: weights}
+	}
+
+	out := make([]uint8, newW*h*4)
+	for y := 0; y < h; y++ {
+		row := pix[y*w*4 : (y+1)*w*4]
+		for x, t := range taps {
+			var r, g, b, a float64
+			for i, weight := range t.weights {
+				p := row[(t.first+i)*4:]
+				r += weight * float64(p[0])
+				g += weight * float64(p[1])
+				b += weight * float64(p[2])
+				a += weight * float64(p[3])
+			}
+			o := out[(x*h+y)*4:]
+			o[0], o[1], o[2], o[3] = clamp8(r), clamp8(g), clamp8(b), clamp8(a)
+		}
+	}
+	return out
+}
+
+func clamp8(v float64) uint8 {
+	return uint8(math.Max(0, math.Min(255, math.Round(v))))
+}
@@ -0,0 +1,210 @@
+package services
+
+import (
+	"ai-content-creation/models"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// imageSize is a width and height in pixels
+type imageSize struct {
+	Width  int
+	Height int
+}
+
+// imageCapabilities describes the options an image model accepts. A model
+// takes either one of Sizes or any size from MinSize to MaxSize on each side;
+// with neither, its size is fixed.
+type imageCapabilities struct {
+	MaxSteps       int // 0 if steps can't be set
+	Seed           bool
+	NegativePrompt bool
+	Sizes          []imageSize
+	MinSize        int
+	MaxSize        int
+}
+
+// imageModelCapabilities is keyed by the provider's model name. Models that
+// aren't listed take no options besides a style preset.
+var imageModelCapabilities = map[string]imageCapabilities{
+	"@cf/black-forest-labs/flux-1-schnell":         {MaxSteps: 8, Seed: true},
+	"@cf/stabilityai/stable-diffusion-xl-base-1.0": {MaxSteps: 20, Seed: true, NegativePrompt: true, MinSize: 256, MaxSize: 2048},
+	"@cf/bytedance/stable-diffusion-xl-lightning":  {MaxSteps: 20, Seed: true, NegativePrompt: true, MinSize: 256, MaxSize: 2048},
+	"@cf/lykon/dreamshaper-8-lcm":                  {MaxSteps: 20, Seed: true, NegativePrompt: true, MinSize: 256, MaxSize: 2048},
+	"dall-e-2":                                     {Sizes: []imageSize{{256, 256}, {512, 512}, {1024, 1024}}},
+	"dall-e-3":                                     {Sizes: []imageSize{{1024, 1024}, {1792, 1024}, {1024, 1792}}},
+	"gpt-image-1":                                  {Sizes: []imageSize{{1024, 1024}, {1536, 1024}, {1024, 1536}}},
+}
+
+// imageStylePresets work with every model, by describing the style in the
+// prompt.
+var imageStylePresets = map[string]string{
+	"photographic": "a high-quality professional photograph with natural lighting",
+	"cinematic":    "a cinematic still with dramatic lighting and shallow depth of field",
+	"digital-art":  "a vibrant, detailed piece of digital art",
+	"illustration": "a clean, modern editorial illustration",
+	"flat":         "a flat vector graphic with bold shapes and a limited palette",
+	"3d-render":    "a polished 3D render with soft studio lighting",
+	"watercolor":   "a soft watercolor painting on textured paper",
+}
+
+// defaultImageSide is the longer side of an image requested by aspect ratio
+// from a model that takes any size
+const defaultImageSide = 1024
+
+// maxNegativePromptLength bounds the negative prompt in characters
+const maxNegativePromptLength = 1000
+
+// ResolveImageOptions checks image options against what the configured image
+// model accepts and returns them with an aspect ratio turned into a width
+// and height.
+func (ai *AIService) ResolveImageOptions(options models.ImageOptions) (models.ImageOptions, error) {
+	capabilities := imageModelCapabilities[ai.imageModel.Upstream]
+	unsupported := func(option string) error {
+		return &ImageOptionError{Option: option, Reason: fmt.Sprintf("not supported by %s", ai.imageModel.ID)}
+	}
+
+	if options.Steps != 0 {
+		if capabilities.MaxSteps == 0 {
+			return options, unsupported("steps")
+		}
+		if options.Steps < 1 || options.Steps > capabilities.MaxSteps {
+			return options, &ImageOptionError{Option: "steps", Reason: fmt.Sprintf("must be between 1 and %d", capabilities.MaxSteps)}
+		}
+	}
+
+	if options.Seed != nil {
+		if !capabilities.Seed {
+			return options, unsupported("seed")
+		}
+		if *options.Seed < 0 {
+			return options, &ImageOptionError{Option: "seed", Reason: "must not be negative"}
+		}
+	}
+
+	if options.NegativePrompt != "" {
+		if !capabilities.NegativePrompt {
+			return options, unsupported("negative_prompt")
+		}
+		if len([]rune(options.NegativePrompt)) > maxNegativePromptLength {
+			return options, &ImageOptionError{Option: "negative_prompt", Reason: fmt.Sprintf("must be at most %d characters", maxNegativePromptLength)}
+		}
+	}
+
+	if options.StylePreset != "" {
+		if _, ok := imageStylePresets[options.StylePreset]; !ok {
+			return options, &ImageOptionError{Option: "style_preset", Reason: fmt.Sprintf("unknown preset %q", options.StylePreset)}
+		}
+	}
+
+	if options.AspectRatio != "" {
+		if options.Width != 0 || options.Height != 0 {
+			return options, &ImageOptionError{Option: "aspect_ratio", Reason: "cannot be combined with width and height"}
+		}
+		if !capabilities.sizable() {
+			return options, unsupported("aspect_ratio")
+		}
+		size, err := capabilities.sizeForRatio(options.AspectRatio)
+		if err != nil {
+			return options, err
+		}
+		options.Width, options.Height = size.Width, size.Height
+		return options, nil
+	}
+
+	if options.Width != 0 || options.Height != 0 {
+		if !capabilities.sizable() {
+			return options, unsupported("width")
+		}
+		if options.Width == 0 || options.Height == 0 {
+			return options, &ImageOptionError{Option: "width", Reason: "width and height must be set together"}
+		}
+		if err := capabilities.checkSize(imageSize{options.Width, options.Height}); err != nil {
+			return options, err
+		}
+	}
+	return options, nil
+}
+
+func (c imageCapabilities) sizable() bool {
+	return len(c.Sizes) > 0 || c.MaxSize > 0
+}
+
+func (c imageCapabilities) checkSize(size imageSize) error {
+	if len(c.Sizes) > 0 {
+		for _, s := range c.Sizes {
+			if s == size {
+				return nil
+			}
+		}
+		return &ImageOptionError{Option: "width", Reason: "size must be one of " + c.sizeList()}
+	}
+	if size.Width < c.MinSize || size.Width > c.MaxSize || size.Height < c.MinSize || size.Height > c.MaxSize {
+		return &ImageOptionError{Option: "width", Reason: fmt.Sprintf("width and height must be between %d and %d", c.MinSize, c.MaxSize)}
+	}
+	return nil
+}
+
+// sizeForRatio picks the size for an aspect ratio such as "16:9": the listed
+// size closest to that ratio, as long as it is within 5%, or one whose longer
+// side is defaultImageSide, rounded to multiples of 64.
+func (c imageCapabilities) sizeForRatio(ratio string) (imageSize, error) {
+	w, h, err := parseAspectRatio(ratio)
+	if err != nil {
+		return imageSize{}, err
+	}
+
+	if len(c.Sizes) > 0 {
+		want := float64(w) / float64(h)
+		var best imageSize
+		bestOff := 0.05
+		for _, s := range c.Sizes {
+			off := math.Abs(float64(s.Width)/float64(s.Height)-want) / want
+			if off <= bestOff {
+				best, bestOff = s, off
+			}
+		}
+		if best == (imageSize{}) {
+			return imageSize{}, &ImageOptionError{Option: "aspect_ratio", Reason: "size must be one of " + c.sizeList()}
+		}
+		return best, nil
+	}
+
+	long := min(defaultImageSide, c.MaxSize)
+	short := func(n, d int) int {
+		side := int(math.Round(float64(long)*float64(n)/float64(d)/64)) * 64
+		return max(side, c.MinSize)
+	}
+	if w >= h {
+		return imageSize{long, short(h, w)}, nil
+	}
+	return imageSize{short(w, h), long}, nil
+}
+
+func (c imageCapabilities) sizeList() string {
+	var sizes []string
+	for _, s := range c.Sizes {
+		sizes = append(sizes, fmt.Sprintf("%dx%d", s.Width, s.Height))
+	}
+	return strings.Join(sizes, ", ")
+}
+
+// parseAspectRatio reads a ratio of two positive whole numbers such as "16:9"
+func parseAspectRatio(ratio string) (int, int, error) {
+	invalid := &ImageOptionError{Option: "aspect_ratio", Reason: `must look like "16:9"`}
+	ws, hs, ok := strings.Cut(ratio, ":")
+	if !ok {
+		return 0, 0, invalid
+	}
+	w, err := strconv.Atoi(ws)
+	if err != nil || w < 1 || w > 100 {
+		return 0, 0, invalid
+	}
+	h, err := strconv.Atoi(hs)
+	if err != nil || h < 1 || h > 100 {
+		return 0, 0, invalid
+	}
+	return w, h, nil
+}
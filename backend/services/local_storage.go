@@ -0,0 +1,138 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// LocalStorage keeps objects as files in a directory, for development and
+// single-server deployments. The API serves them at the base URL it is given,
+// to anyone holding a URL signed with secret that hasn't expired yet.
+type LocalStorage struct {
+	dir     string
+	baseURL string
+	secret  []byte
+}
+
+func NewLocalStorage(dir string, baseURL string, secret []byte) (*LocalStorage, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create storage directory: %v", err)
+	}
+	return &LocalStorage{dir: dir, baseURL: baseURL, secret: secret}, nil
+}
+
+// path maps a key to a file inside the storage directory. Cleaning the key as
+// an absolute path drops any ".." that would leave the directory.
+func (s *LocalStorage) path(key string) string {
+	return filepath.Join(s.dir, filepath.FromSlash(path.Clean("/"+key)))
+}
+
+// Put writes the object to a temporary file first so that readers never see
+// a partial file. Files carry no metadata, so contentType and cacheControl
+// are not kept.
+func (s *LocalStorage) Put(ctx context.Context, key string, data []byte, contentType string, cacheControl string) error {
+	target := s.path(key)
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return fmt.Errorf("failed to create directory for %s: %v", key, err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(target), ".upload-*")
+	if err != nil {
+		return fmt.Errorf("failed to store %s: %v", key, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to store %s: %v", key, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to store %s: %v", key, err)
+	}
+	if err := os.Rename(tmp.Name(), target); err != nil {
+		return fmt.Errorf("failed to store %s: %v", key, err)
+	}
+	return nil
+}
+
+// Get opens the object's file. Files don't record a content type, so it is
+// detected from the first bytes.
+func (s *LocalStorage) Get(ctx context.Context, key string) (*StoredObject, error) {
+	file, err := os.Open(s.path(key))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrObjectNotFound
+		}
+		return nil, fmt.Errorf("failed to open %s: %v", key, err)
+	}
+
+	info, err := file.Stat()
+	if err != nil || info.IsDir() {
+		file.Close()
+		return nil, ErrObjectNotFound
+	}
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		file.Close()
+		return nil, fmt.Errorf("failed to read %s: %v", key, err)
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to read %s: %v", key, err)
+	}
+
+	return &StoredObject{
+		Body:        file,
+		ContentType: http.DetectContentType(head[:n]),
+		Size:        info.Size(),
+	}, nil
+}
+
+func (s *LocalStorage) Delete(ctx context.Context, key string) error {
+	if err := os.Remove(s.path(key)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to delete %s: %v", key, err)
+	}
+	return nil
+}
+
+func (s *LocalStorage) SignedURL(key string, expiry time.Duration) (string, error) {
+	expires := strconv.FormatInt(time.Now().Add(expiry).Unix(), 10)
+	query := url.Values{
+		"expires":   {expires},
+		"signature": {s.sign(key, expires)},
+	}
+	return s.baseURL + "/" + key + "?" + query.Encode(), nil
+}
+
+// Verify checks the expiry and signature of a URL made by SignedURL and
+// returns ErrInvalidURLSignature if it has expired or wasn't made for key.
+func (s *LocalStorage) Verify(key string, expires string, signature string) error {
+	unix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > unix {
+		return ErrInvalidURLSignature
+	}
+	if !hmac.Equal([]byte(signature), []byte(s.sign(key, expires))) {
+		return ErrInvalidURLSignature
+	}
+	return nil
+}
+
+func (s *LocalStorage) sign(key string, expires string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(key + "\n" + expires))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,139 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Email is a plain-text message.
+type Email struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers account emails. SMTPMailer is used in production;
+// LogMailer is for development and tests.
+type Mailer interface {
+	Send(email Email) error
+}
+
+// NewMailer picks a mailer from the environment: SMTPMailer when SMTP_HOST
+// is set, otherwise a LogMailer writing to MAIL_DIR (or just the log).
+func NewMailer() Mailer {
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "no-reply@localhost"
+	}
+
+	if host := os.Getenv("SMTP_HOST"); host != "" {
+		port := os.Getenv("SMTP_PORT")
+		if port == "" {
+			port = "587"
+		}
+		return NewSMTPMailer(host, port, os.Getenv("SMTP_USERNAME"), os.Getenv("SMTP_PASSWORD"), from)
+	}
+
+	log.Println("Warning: SMTP_HOST not set, emails will be logged instead of sent")
+	return NewLogMailer(os.Getenv("MAIL_DIR"), from)
+}
+
+// SMTPMailer sends email through an SMTP server, using STARTTLS when the
+// server offers it.
+type SMTPMailer struct {
+	addr     string
+	host     string
+	username string
+	password string
+	from     string
+}
+
+func NewSMTPMailer(host, port, username, password, from string) *SMTPMailer {
+	return &SMTPMailer{
+		addr:     net.JoinHostPort(host, port),
+		host:     host,
+		username: username,
+		password: password,
+		from:     from,
+	}
+}
+
+func (m *SMTPMailer) Send(email Email) error {
+	var auth smtp.Auth
+	if m.username != "" {
+		auth = smtp.PlainAuth("", m.username, m.password, m.host)
+	}
+
+	if err := smtp.SendMail(m.addr, auth, m.from, []string{email.To}, formatEmail(m.from, email)); err != nil {
+		return fmt.Errorf("failed to send email: %v", err)
+	}
+	return nil
+}
+
+// LogMailer writes each email to a file in dir, or to the log when dir is
+// empty, so that links can be followed without a mail server.
+type LogMailer struct {
+	dir  string
+	from string
+}
+
+func NewLogMailer(dir, from string) *LogMailer {
+	return &LogMailer{dir: dir, from: from}
+}
+
+func (m *LogMailer) Send(email Email) error {
+	message := formatEmail(m.from, email)
+	if m.dir == "" {
+		log.Printf("Email to %s:\n%s", email.To, message)
+		return nil
+	}
+
+	if err := os.MkdirAll(m.dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create mail directory: %v", err)
+	}
+	name := fmt.Sprintf("%d-%s.eml", time.Now().UnixNano(), sanitizeFilename(email.To))
+	if err := os.WriteFile(filepath.Join(m.dir, name), message, 0o644); err != nil {
+		return fmt.Errorf("failed to write email: %v", err)
+	}
+	return nil
+}
+
+// formatEmail renders an email as an RFC 5322 message.
+func formatEmail(from string, email Email) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", headerValue(from))
+	fmt.Fprintf(&b, "To: %s\r\n", headerValue(email.To))
+	fmt.Fprintf(&b, "Subject: %s\r\n", headerValue(email.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(email.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
+
+// headerValue keeps a header on one line. Header values can contain user
+// input, and a line break would let it add headers or start the body.
+func headerValue(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '\r' || r == '\n' {
+			return ' '
+		}
+		return r
+	}, s)
+}
+
+func sanitizeFilename(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '-' || r == '@' {
+			return r
+		}
+		return '_'
+	}, s)
+}
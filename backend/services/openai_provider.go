@@ -0,0 +1,291 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// OpenAIProvider talks to any server implementing the OpenAI HTTP API
+// (OpenAI itself, llama.cpp's server, Ollama, vLLM, LM Studio, ...).
+type OpenAIProvider struct {
+	baseURL      string
+	apiKey       string
+	client       *http.Client
+	streamClient *http.Client
+	idleTimeout  time.Duration
+}
+
+type openAIChatRequest struct {
+	Model         string               `json:"model"`
+	Messages      []Message            `json:"messages"`
+	Stream        bool                 `json:"stream"`
+	StreamOptions *openAIStreamOptions `json:"stream_options,omitempty"`
+}
+
+type openAIStreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+type openAIUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+}
+
+func (u *openAIUsage) toTokenUsage() TokenUsage {
+	if u == nil {
+		return TokenUsage{}
+	}
+	return TokenUsage{PromptTokens: u.PromptTokens, CompletionTokens: u.CompletionTokens}
+}
+
+type openAIChatResponse struct {
+	Choices []struct {
+		Message Message `json:"message"`
+	} `json:"choices"`
+	Usage *openAIUsage `json:"usage"`
+}
+
+type openAIStreamChunk struct {
+	Choices []struct {
+		Delta struct {
+			Content string `json:"content"`
+		} `json:"delta"`
+		FinishReason string `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *openAIUsage `json:"usage"`
+}
+
+type openAIImageRequest struct {
+	Model          string `json:"model"`
+	Prompt         string `json:"prompt"`
+	N              int    `json:"n"`
+	Size           string `json:"size,omitempty"`
+	ResponseFormat string `json:"response_format"`
+}
+
+type openAIImageResponse struct {
+	Data []struct {
+		B64JSON string `json:"b64_json"`
+	} `json:"data"`
+}
+
+type openAIModelsResponse struct {
+	Data []struct {
+		ID string `json:"id"`
+	} `json:"data"`
+}
+
+type openAIErrorResponse struct {
+	Error struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// NewOpenAIProvider creates a provider for baseURL, which should include the
+// API version prefix, e.g. "http://localhost:11434/v1". apiKey may be empty
+// for local servers that don't check it. Requests time out after timeout,
+// except streams, which time out once they have been idle for idleTimeout.
+func NewOpenAIProvider(baseURL, apiKey string, timeout, idleTimeout time.Duration) *OpenAIProvider {
+	return &OpenAIProvider{
+		baseURL:      strings.TrimRight(baseURL, "/"),
+		apiKey:       apiKey,
+		client:       &http.Client{Timeout: timeout},
+		streamClient: &http.Client{},
+		idleTimeout:  idleTimeout,
+	}
+}
+
+func (p *OpenAIProvider) Name() string {
+	return providerOpenAI
+}
+
+func (p *OpenAIProvider) GenerateText(ctx context.Context, req TextGenerationRequest) (*TextGenerationResult, error) {
+	body, err := p.do(ctx, "POST", "/chat/completions", openAIChatRequest{
+		Model:    req.Model,
+		Messages: req.Messages,
+		Stream:   false,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var chatResponse openAIChatResponse
+	if err := json.Unmarshal(body, &chatResponse); err != nil {
+		return nil, fmt.Errorf("failed to parse response JSON: %v", err)
+	}
+	if len(chatResponse.Choices) == 0 {
+		return nil, fmt.Errorf("API returned no choices")
+	}
+
+	return &TextGenerationResult{
+		Text:  chatResponse.Choices[0].Message.Content,
+		Usage: chatResponse.Usage.toTokenUsage(),
+	}, nil
+}
+
+func (p *OpenAIProvider) StreamText(ctx context.Context, req TextGenerationRequest, onToken TokenHandler) (*TextGenerationResult, error) {
+	stream := newIdleStream(ctx, p.idleTimeout)
+	defer stream.stop()
+
+	resp, err := p.send(stream.ctx, p.streamClient, "POST", "/chat/completions", openAIChatRequest{
+		Model:         req.Model,
+		Messages:      req.Messages,
+		Stream:        true,
+		StreamOptions: &openAIStreamOptions{IncludeUsage: true},
+	})
+	if err != nil {
+		return nil, stream.err(err)
+	}
+	defer resp.Body.Close()
+
+	var text strings.Builder
+	var usage TokenUsage
+	finished := false
+	err = readSSE(stream.reader(resp.Body), func(data string) error {
+		var chunk openAIStreamChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return fmt.Errorf("failed to parse stream event: %v", err)
+		}
+		if chunk.Usage != nil {
+			usage = chunk.Usage.toTokenUsage()
+		}
+		if len(chunk.Choices) == 0 {
+			return nil
+		}
+		if chunk.Choices[0].FinishReason != "" {
+			finished = true
+		}
+		token := chunk.Choices[0].Delta.Content
+		if token == "" {
+			return nil
+		}
+		text.WriteString(token)
+		return onToken(token)
+	})
+	// Some compatible servers close the stream after the final chunk
+	// without sending [DONE]
+	if errors.Is(err, errStreamTruncated) && finished {
+		err = nil
+	}
+	if err != nil {
+		return nil, stream.err(err)
+	}
+
+	return &TextGenerationResult{Text: text.String(), Usage: usage}, nil
+}
+
+// GenerateImage only passes on the size; the images API has no steps, seed
+// or negative prompt.
+func (p *OpenAIProvider) GenerateImage(ctx context.Context, req ImageGenerationRequest) ([]byte, error) {
+	imageReq := openAIImageRequest{
+		Model:          req.Model,
+		Prompt:         req.Prompt,
+		N:              1,
+		ResponseFormat: "b64_json",
+	}
+	if req.Width != 0 {
+		imageReq.Size = fmt.Sprintf("%dx%d", req.Width, req.Height)
+	}
+	body, err := p.do(ctx, "POST", "/images/generations", imageReq)
+	if err != nil {
+		return nil, err
+	}
+
+	var imageResponse openAIImageResponse
+	if err := json.Unmarshal(body, &imageResponse); err != nil {
+		return nil, fmt.Errorf("failed to parse response JSON: %v", err)
+	}
+	if len(imageResponse.Data) == 0 {
+		return nil, fmt.Errorf("Image API returned no images")
+	}
+
+	image, err := base64.StdEncoding.DecodeString(imageResponse.Data[0].B64JSON)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %v", err)
+	}
+	return image, nil
+}
+
+func (p *OpenAIProvider) ListModels(ctx context.Context) ([]string, error) {
+	body, err := p.do(ctx, "GET", "/models", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var modelsResponse openAIModelsResponse
+	if err := json.Unmarshal(body, &modelsResponse); err != nil {
+		return nil, fmt.Errorf("failed to parse response JSON: %v", err)
+	}
+
+	var names []string
+	for _, m := range modelsResponse.Data {
+		names = append(names, m.ID)
+	}
+	return names, nil
+}
+
+// do sends payload (if any) as JSON to baseURL+path and returns the raw body.
+func (p *OpenAIProvider) do(ctx context.Context, method, path string, payload interface{}) ([]byte, error) {
+	resp, err := p.send(ctx, p.client, method, path, payload)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %v", err)
+	}
+
+	return body, nil
+}
+
+// send is like do but sends with client and leaves reading (and closing) the
+// body to the caller.
+func (p *OpenAIProvider) send(ctx context.Context, client *http.Client, method, path string, payload interface{}) (*http.Response, error) {
+	var reqBody io.Reader
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to marshal the request into json: %s", err)
+		}
+		reqBody = bytes.NewBuffer(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, p.baseURL+path, reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+
+	if p.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+p.apiKey)
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %v", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		var errResponse openAIErrorResponse
+		if json.Unmarshal(body, &errResponse) == nil && errResponse.Error.Message != "" {
+			return nil, fmt.Errorf("API error: %s", errResponse.Error.Message)
+		}
+		return nil, fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,194 @@
+package services
+
+import (
+	"ai-content-creation/models"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxPlatforms is how many platforms one request may target
+const maxPlatforms = 5
+
+var ErrTooManyPlatforms = fmt.Errorf("at most %d platforms can be requested at once", maxPlatforms)
+
+// Platform describes the caption conventions of a social network. Limits are
+// enforced on the generated text; Guidance is added to the system prompt.
+type Platform struct {
+	ID          string
+	Name        string
+	MaxLength   int // in characters
+	MaxHashtags int
+	MaxEmojis   int // -1 means no limit
+	Guidance    string
+}
+
+var platforms = map[string]Platform{
+	"instagram": {
+		ID:          "instagram",
+		Name:        "Instagram",
+		MaxLength:   2200,
+		MaxHashtags: 30,
+		MaxEmojis:   -1,
+		Guidance:    "Open with a strong hook, keep paragraphs short and end with a call to action. Use emojis freely and finish with 5 to 10 relevant hashtags.",
+	},
+	"x": {
+		ID:          "x",
+		Name:        "X",
+		MaxLength:   280,
+		MaxHashtags: 2,
+		MaxEmojis:   2,
+		Guidance:    "Write a single punchy post of at most 280 characters including hashtags. Use at most 2 hashtags and at most 2 emojis.",
+	},
+	"facebook": {
+		ID:          "facebook",
+		Name:        "Facebook",
+		MaxLength:   2000,
+		MaxHashtags: 3,
+		MaxEmojis:   5,
+		Guidance:    "Write in a friendly, conversational tone that invites comments. Use at most 3 hashtags and a few emojis.",
+	},
+	"linkedin": {
+		ID:          "linkedin",
+		Name:        "LinkedIn",
+		MaxLength:   3000,
+		MaxHashtags: 5,
+		MaxEmojis:   3,
+		Guidance:    "Keep a professional tone focused on value and expertise. Use emojis sparingly, if at all, and end with 3 to 5 hashtags.",
+	},
+	"tiktok": {
+		ID:          "tiktok",
+		Name:        "TikTok",
+		MaxLength:   2200,
+		MaxHashtags: 5,
+		MaxEmojis:   -1,
+		Guidance:    "Write a short, energetic caption of one or two sentences that matches the video. Use trending-style emojis and 3 to 5 hashtags.",
+	},
+}
+
+// normalizePlatforms lower-cases and de-duplicates the requested platforms,
+// rejecting unknown ones.
+func normalizePlatforms(ids []string) ([]string, error) {
+	if len(ids) > maxPlatforms {
+		return nil, ErrTooManyPlatforms
+	}
+
+	seen := map[string]bool{}
+	normalized := []string{}
+	for _, id := range ids {
+		id = strings.ToLower(strings.TrimSpace(id))
+		if _, ok := platforms[id]; !ok {
+			return nil, &UnknownPlatformError{Platform: id}
+		}
+		if !seen[id] {
+			seen[id] = true
+			normalized = append(normalized, id)
+		}
+	}
+	return normalized, nil
+}
+
+// requestPlatforms returns the platforms a request generates for. A request
+// without platforms produces a single generic caption, identified by "".
+func requestPlatforms(contentReq *models.ContentRequest) ([]string, error) {
+	ids, err := contentReq.GetPlatforms()
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse platforms: %v", err)
+	}
+	if len(ids) == 0 {
+		return []string{""}, nil
+	}
+	return ids, nil
+}
+
+// platformPrompt adds a platform's guidance to the system prompt.
+func platformPrompt(system string, id string) string {
+	p, ok := platforms[id]
+	if !ok {
+		return system
+	}
+	return fmt.Sprintf("%s\nYou are writing a %s post. %s", system, p.Name, p.Guidance)
+}
+
+// fitPlatform enforces a platform's hashtag, emoji and length limits on
+// generated text. Models follow the guidance most of the time; this catches
+// the rest.
+func fitPlatform(text string, id string) string {
+	p, ok := platforms[id]
+	if !ok {
+		return text
+	}
+
+	text = limitHashtags(text, p.MaxHashtags)
+	if p.MaxEmojis >= 0 {
+		text = limitEmojis(text, p.MaxEmojis)
+	}
+	return truncateText(text, p.MaxLength)
+}
+
+// limitHashtags drops every hashtag after the first max.
+func limitHashtags(text string, max int) string {
+	lines := strings.Split(text, "\n")
+	count := 0
+	for i, line := range lines {
+		words := strings.Fields(line)
+		kept := words[:0]
+		for _, word := range words {
+			if strings.HasPrefix(word, "#") && len(word) > 1 {
+				count++
+				if count > max {
+					continue
+				}
+			}
+			kept = append(kept, word)
+		}
+		if len(kept) != len(words) {
+			lines[i] = strings.Join(kept, " ")
+		}
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+// limitEmojis drops every emoji after the first max, along with the joiners
+// and variation selectors attached to dropped emojis.
+func limitEmojis(text string, max int) string {
+	var b strings.Builder
+	count := 0
+	for _, r := range text {
+		switch {
+		case isEmoji(r):
+			count++
+			if count > max {
+				continue
+			}
+		case r == '\u200D' || r == '\uFE0F':
+			if count > max {
+				continue
+			}
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func isEmoji(r rune) bool {
+	return r >= 0x1F300 && r <= 0x1FAFF || // pictographs, emoticons, transport, supplemental symbols
+		r >= 0x2600 && r <= 0x27BF || // miscellaneous symbols and dingbats
+		r >= 0x2B00 && r <= 0x2BFF || // stars, arrows and other symbols
+		r >= 0x1F1E6 && r <= 0x1F1FF // regional indicators (flags)
+}
+
+// truncateText shortens text to at most max characters, cutting at a word
+// boundary and marking the cut with an ellipsis.
+func truncateText(text string, max int) string {
+	if utf8.RuneCountInString(text) <= max {
+		return text
+	}
+
+	runes := []rune(text)
+	cut := string(runes[:max-1])
+	if i := strings.LastIndexAny(cut, " \n"); i > 0 {
+		cut = cut[:i]
+	}
+	return strings.TrimRight(cut, " \n.,;:!?-") + "…"
+}
@@ -0,0 +1,239 @@
+package services
+
+import (
+	"ai-content-creation/models"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Route classes with their own rate limits. Every authenticated route counts
+// against RouteDefault; generation routes also count against RouteGenerate.
+const (
+	RouteDefault  = "default"
+	RouteGenerate = "generate"
+	RouteAuth     = "auth" // sign-in, tokens and account emails, limited per IP
+)
+
+// RateLimit allows bursts of up to Requests requests, refilled evenly so
+// that Requests more are allowed every Per. Zero Requests means no limit.
+type RateLimit struct {
+	Requests int
+	Per      time.Duration
+}
+
+func (l RateLimit) String() string {
+	if l.Requests <= 0 {
+		return "unlimited"
+	}
+	return fmt.Sprintf("%d/%s", l.Requests, l.Per)
+}
+
+// RateLimitResult is the state of a bucket after taking a token from it.
+type RateLimitResult struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	RetryAfter time.Duration // until a token is available, when not allowed
+	Reset      time.Duration // until the bucket is full again
+}
+
+// RateLimitStore keeps token buckets. MemoryRateLimitStore keeps them in
+// process; a store backed by a shared cache lets several servers enforce one
+// limit.
+type RateLimitStore interface {
+	// Take removes a token from the bucket for key, creating a full one if
+	// it doesn't exist.
+	Take(key string, limit RateLimit) (RateLimitResult, error)
+}
+
+// defaultRateLimits are the limits per route class and subscription tier.
+// RouteAuth isn't tied to a user, so it only has the "" tier.
+var defaultRateLimits = map[string]map[models.SubscriptionTier]RateLimit{
+	RouteDefault: {
+		models.FreeTier:       {Requests: 60, Per: time.Minute},
+		models.ProTier:        {Requests: 300, Per: time.Minute},
+		models.EnterpriseTier: {Requests: 1200, Per: time.Minute},
+	},
+	RouteGenerate: {
+		models.FreeTier:       {Requests: 10, Per: time.Minute},
+		models.ProTier:        {Requests: 60, Per: time.Minute},
+		models.EnterpriseTier: {Requests: 240, Per: time.Minute},
+	},
+	RouteAuth: {
+		"": {Requests: 10, Per: time.Minute},
+	},
+}
+
+type RateLimiter struct {
+	db     *gorm.DB
+	store  RateLimitStore
+	limits map[string]map[models.SubscriptionTier]RateLimit
+}
+
+// NewRateLimiter creates a rate limiter using store. Each default limit can be
+// overridden with RATE_LIMIT_<ROUTE>_<TIER>, e.g. RATE_LIMIT_GENERATE_PRO=30/1m,
+// or RATE_LIMIT_AUTH for the auth routes. "0" removes a limit.
+func NewRateLimiter(db *gorm.DB, store RateLimitStore) *RateLimiter {
+	limits := map[string]map[models.SubscriptionTier]RateLimit{}
+	for route, tiers := range defaultRateLimits {
+		limits[route] = map[models.SubscriptionTier]RateLimit{}
+		for tier, def := range tiers {
+			key := "RATE_LIMIT_" + strings.ToUpper(route)
+			if tier != "" {
+				key += "_" + strings.ToUpper(string(tier))
+			}
+			limits[route][tier] = envRateLimit(key, def)
+		}
+	}
+	return &RateLimiter{db: db, store: store, limits: limits}
+}
+
+// limit returns the limit of a route class for a tier. Tiers without their
+// own limit get the free tier's.
+func (l *RateLimiter) limit(route string, tier models.SubscriptionTier) RateLimit {
+	tiers := l.limits[route]
+	if limit, ok := tiers[tier]; ok {
+		return limit
+	}
+	return tiers[models.FreeTier]
+}
+
+// userTier returns the user's subscription tier, falling back to free.
+func (l *RateLimiter) userTier(userID string) models.SubscriptionTier {
+	var user models.User
+	if err := l.db.Select("subscription_tier").First(&user, "user_id = ?", userID).Error; err != nil {
+		return models.FreeTier
+	}
+	return user.SubscriptionTier
+}
+
+// RateLimitMiddleware limits requests to a route class. Requests made with an
+// API key are limited per key, other authenticated requests per user and
+// unauthenticated ones per client IP. It must run after AuthMiddleware on
+// authenticated routes. Responses carry X-RateLimit-Limit,
+// X-RateLimit-Remaining and X-RateLimit-Reset (seconds until the bucket is
+// full); rejected requests get 429 with Retry-After.
+func RateLimitMiddleware(route string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limiter := c.MustGet("rateLimiter").(*RateLimiter)
+
+		var key string
+		var tier models.SubscriptionTier
+		switch {
+		case c.GetString("apiKeyID") != "":
+			key = "key:" + c.GetString("apiKeyID")
+			tier = limiter.userTier(c.GetString("userID"))
+		case c.GetString("userID") != "":
+			key = "user:" + c.GetString("userID")
+			tier = limiter.userTier(c.GetString("userID"))
+		default:
+			key = "ip:" + c.ClientIP()
+		}
+
+		limit := limiter.limit(route, tier)
+		if limit.Requests <= 0 {
+			c.Next()
+			return
+		}
+
+		result, err := limiter.store.Take(route+":"+key, limit)
+		if err != nil {
+			// Better to serve without limits than not at all
+			log.Printf("Rate limit store failed: %v", err)
+			c.Next()
+			return
+		}
+
+		c.Header("X-RateLimit-Limit", strconv.Itoa(result.Limit))
+		c.Header("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		c.Header("X-RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+		if !result.Allowed {
+			c.Header("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "Rate limit exceeded, try again later"})
+			return
+		}
+		c.Next()
+	}
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// MemoryRateLimitStore keeps token buckets in memory. Limits are per server
+// process and reset on restart.
+type MemoryRateLimitStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+	full    time.Time // when the bucket will have refilled completely
+}
+
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{buckets: map[string]*tokenBucket{}, lastSweep: time.Now(), now: time.Now}
+}
+
+func (s *MemoryRateLimitStore) Take(key string, limit RateLimit) (RateLimitResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	capacity := float64(limit.Requests)
+	rate := capacity / limit.Per.Seconds() // tokens per second
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: capacity}
+		s.buckets[key] = b
+	} else {
+		b.tokens = math.Min(capacity, b.tokens+now.Sub(b.updated).Seconds()*rate)
+	}
+	b.updated = now
+
+	result := RateLimitResult{Limit: limit.Requests}
+	if b.tokens >= 1 {
+		b.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = secondsDuration((1 - b.tokens) / rate)
+	}
+	result.Remaining = int(b.tokens)
+	result.Reset = secondsDuration((capacity - b.tokens) / rate)
+	b.full = now.Add(result.Reset)
+
+	s.sweep(now)
+	return result, nil
+}
+
+// sweep drops buckets that have refilled completely, since a missing bucket
+// behaves the same as a full one. It runs at most once a minute.
+func (s *MemoryRateLimitStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	s.lastSweep = now
+	for key, b := range s.buckets {
+		if !now.Before(b.full) {
+			delete(s.buckets, key)
+		}
+	}
+}
+
+func secondsDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
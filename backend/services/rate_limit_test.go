@@ -0,0 +1,166 @@
+package services
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// fakeClock is a settable time source for MemoryRateLimitStore.
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time          { return c.t }
+func (c *fakeClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestRateLimitStore() (*MemoryRateLimitStore, *fakeClock) {
+	clock := &fakeClock{t: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+	store := NewMemoryRateLimitStore()
+	store.now = clock.now
+	store.lastSweep = clock.t
+	return store, clock
+}
+
+func take(t *testing.T, store *MemoryRateLimitStore, key string, limit RateLimit) RateLimitResult {
+	t.Helper()
+	result, err := store.Take(key, limit)
+	if err != nil {
+		t.Fatalf("Take: %v", err)
+	}
+	return result
+}
+
+func assertDuration(t *testing.T, name string, got, want time.Duration) {
+	t.Helper()
+	if diff := got - want; diff < -time.Millisecond || diff > time.Millisecond {
+		t.Errorf("%s = %s, want %s", name, got, want)
+	}
+}
+
+func TestTokenBucketBurstAndRefill(t *testing.T) {
+	store, clock := newTestRateLimitStore()
+	limit := RateLimit{Requests: 10, Per: time.Minute} // a token every 6s
+
+	for i := 0; i < 10; i++ {
+		result := take(t, store, "k", limit)
+		if !result.Allowed {
+			t.Fatalf("request %d was refused within the burst", i+1)
+		}
+		if result.Remaining != 9-i {
+			t.Errorf("request %d: Remaining = %d, want %d", i+1, result.Remaining, 9-i)
+		}
+		assertDuration(t, "Reset", result.Reset, time.Duration(i+1)*6*time.Second)
+	}
+
+	result := take(t, store, "k", limit)
+	if result.Allowed {
+		t.Fatal("request beyond the burst was allowed")
+	}
+	if result.Limit != 10 || result.Remaining != 0 {
+		t.Errorf("Limit, Remaining = %d, %d, want 10, 0", result.Limit, result.Remaining)
+	}
+	assertDuration(t, "RetryAfter", result.RetryAfter, 6*time.Second)
+	assertDuration(t, "Reset", result.Reset, time.Minute)
+
+	// Half a token isn't enough
+	clock.advance(3 * time.Second)
+	result = take(t, store, "k", limit)
+	if result.Allowed {
+		t.Fatal("request allowed with half a token")
+	}
+	assertDuration(t, "RetryAfter", result.RetryAfter, 3*time.Second)
+
+	clock.advance(3 * time.Second)
+	if result = take(t, store, "k", limit); !result.Allowed {
+		t.Fatal("request refused after a token refilled")
+	}
+
+	// Refills never exceed the bucket's capacity
+	clock.advance(time.Hour)
+	result = take(t, store, "k", limit)
+	if !result.Allowed || result.Remaining != 9 {
+		t.Errorf("after an idle hour: Allowed, Remaining = %v, %d, want true, 9", result.Allowed, result.Remaining)
+	}
+}
+
+func TestTokenBucketKeysAreIndependent(t *testing.T) {
+	store, _ := newTestRateLimitStore()
+	limit := RateLimit{Requests: 1, Per: time.Minute}
+
+	if !take(t, store, "a", limit).Allowed {
+		t.Fatal("first request for a was refused")
+	}
+	if take(t, store, "a", limit).Allowed {
+		t.Fatal("second request for a was allowed")
+	}
+	if !take(t, store, "b", limit).Allowed {
+		t.Fatal("first request for b was refused")
+	}
+}
+
+func TestTokenBucketSweep(t *testing.T) {
+	store, clock := newTestRateLimitStore()
+	limit := RateLimit{Requests: 2, Per: time.Minute}
+
+	take(t, store, "idle", limit)
+	clock.advance(31 * time.Second)
+	take(t, store, "busy", limit)
+	take(t, store, "busy", limit)
+
+	// "idle" refilled 30s after its request; "busy" isn't full yet
+	clock.advance(30 * time.Second)
+	take(t, store, "other", limit)
+	if _, ok := store.buckets["idle"]; ok {
+		t.Error("full bucket was not swept")
+	}
+	if _, ok := store.buckets["busy"]; !ok {
+		t.Error("partly empty bucket was swept")
+	}
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("RATE_LIMIT_AUTH", "2/1m")
+	limiter := NewRateLimiter(newTestDB(t), NewMemoryRateLimitStore())
+
+	r := gin.New()
+	r.Use(func(c *gin.Context) { c.Set("rateLimiter", limiter) })
+	r.POST("/login", RateLimitMiddleware(RouteAuth), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	request := func(ip string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/login", nil)
+		req.RemoteAddr = ip + ":1234"
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	for i := 0; i < 2; i++ {
+		w := request("203.0.113.1")
+		if w.Code != http.StatusOK {
+			t.Fatalf("request %d: status %d, want 200", i+1, w.Code)
+		}
+		if got := w.Header().Get("X-RateLimit-Limit"); got != "2" {
+			t.Errorf("X-RateLimit-Limit = %q, want 2", got)
+		}
+	}
+
+	w := request("203.0.113.1")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("status %d, want 429", w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "30" {
+		t.Errorf("Retry-After = %q, want 30", got)
+	}
+	if got := w.Header().Get("X-RateLimit-Remaining"); got != "0" {
+		t.Errorf("X-RateLimit-Remaining = %q, want 0", got)
+	}
+
+	if w := request("198.51.100.7"); w.Code != http.StatusOK {
+		t.Fatalf("another IP got status %d, want 200", w.Code)
+	}
+}
@@ -0,0 +1,140 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+type S3Config struct {
+	Bucket          string
+	Region          string
+	AccessKeyID     string // the default AWS credential chain is used if empty
+	SecretAccessKey string
+	Endpoint        string // for S3-compatible services; empty for AWS
+	ForcePathStyle  bool   // address buckets as endpoint/bucket rather than bucket.endpoint
+}
+
+// S3Storage keeps objects in an S3 bucket, on AWS or any S3-compatible
+// service.
+type S3Storage struct {
+	client *s3.S3
+	config S3Config
+}
+
+func NewS3Storage(config S3Config) (*S3Storage, error) {
+	if config.Bucket == "" {
+		return nil, errors.New("S3_BUCKET is required for S3 storage")
+	}
+	if config.Region == "" {
+		if config.Endpoint == "" {
+			return nil, errors.New("AWS_REGION is required for S3 storage")
+		}
+		// S3-compatible services mostly ignore the region, but it has to be set
+		config.Region = "us-east-1"
+	}
+
+	awsConfig := &aws.Config{
+		Region:           aws.String(config.Region),
+		S3ForcePathStyle: aws.Bool(config.ForcePathStyle),
+	}
+	if config.Endpoint != "" {
+		awsConfig.Endpoint = aws.String(config.Endpoint)
+	}
+	if config.AccessKeyID != "" {
+		awsConfig.Credentials = credentials.NewStaticCredentials(config.AccessKeyID, config.SecretAccessKey, "")
+	}
+
+	sess, err := session.NewSession(awsConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create S3 session: %v", err)
+	}
+	return &S3Storage{client: s3.New(sess), config: config}, nil
+}
+
+func (s *S3Storage) Put(ctx context.Context, key string, data []byte, contentType string, cacheControl string) error {
+	input := &s3.PutObjectInput{
+		Bucket:      aws.String(s.config.Bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(data),
+		ContentType: aws.String(contentType),
+	}
+	if cacheControl != "" {
+		input.CacheControl = aws.String(cacheControl)
+	}
+	_, err := s.client.PutObjectWithContext(ctx, input)
+	if err != nil {
+		return fmt.Errorf("failed to upload %s: %v", key, err)
+	}
+	return nil
+}
+
+func (s *S3Storage) Get(ctx context.Context, key string) (*StoredObject, error) {
+	out, err := s.client.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.config.Bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		var awsErr awserr.Error
+		if errors.As(err, &awsErr) && awsErr.Code() == s3.ErrCodeNoSuchKey {
+			return nil, ErrObjectNotFound
+		}
+		return nil, fmt.Errorf("failed to download %s: %v", key, err)
+	}
+	return &StoredObject{
+		Body:        out.Body,
+		ContentType: aws.StringValue(out.ContentType),
+		Size:        aws.Int64Value(out.ContentLength),
+	}, nil
+}
+
+func (s *S3Storage) Delete(ctx context.Context, key string) error {
+	_, err := s.client.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.config.Bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete %s: %v", key, err)
+	}
+	return nil
+}
+
+// MakePrivate replaces the object's ACL with the private canned ACL, undoing
+// the public-read ACL images used to be uploaded with.
+func (s *S3Storage) MakePrivate(ctx context.Context, key string) error {
+	_, err := s.client.PutObjectAclWithContext(ctx, &s3.PutObjectAclInput{
+		Bucket: aws.String(s.config.Bucket),
+		Key:    aws.String(key),
+		ACL:    aws.String(s3.ObjectCannedACLPrivate),
+	})
+	if err != nil {
+		var awsErr awserr.Error
+		if errors.As(err, &awsErr) && awsErr.Code() == s3.ErrCodeNoSuchKey {
+			return nil
+		}
+		return fmt.Errorf("failed to make %s private: %v", key, err)
+	}
+	return nil
+}
+
+// SignedURL presigns a GET request for the object. Presigning is done
+// locally and doesn't check that the object exists.
+func (s *S3Storage) SignedURL(key string, expiry time.Duration) (string, error) {
+	req, _ := s.client.GetObjectRequest(&s3.GetObjectInput{
+		Bucket: aws.String(s.config.Bucket),
+		Key:    aws.String(key),
+	})
+	signed, err := req.Presign(expiry)
+	if err != nil {
+		return "", fmt.Errorf("failed to presign %s: %v", key, err)
+	}
+	return signed, nil
+}
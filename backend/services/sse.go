@@ -0,0 +1,104 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// errStreamIdle reports a stream that stopped sending data
+var errStreamIdle = errors.New("stream stalled")
+
+// errStreamTruncated reports an event stream that ended without its "[DONE]"
+// sentinel, so the response may be incomplete.
+var errStreamTruncated = errors.New("stream ended before it was complete")
+
+// idleStream cancels a streaming request once it has gone timeout without
+// receiving any data. Streams can legitimately run for a long time, so they
+// get this instead of a deadline for the whole request. A timeout of 0
+// disables it.
+type idleStream struct {
+	ctx     context.Context
+	cancel  context.CancelCauseFunc
+	timer   *time.Timer
+	timeout time.Duration
+}
+
+func newIdleStream(ctx context.Context, timeout time.Duration) *idleStream {
+	s := &idleStream{timeout: timeout}
+	s.ctx, s.cancel = context.WithCancelCause(ctx)
+	if timeout > 0 {
+		s.timer = time.AfterFunc(timeout, func() {
+			s.cancel(fmt.Errorf("%w: no data for %s", errStreamIdle, timeout))
+		})
+	}
+	return s
+}
+
+// reader pushes the timeout back whenever r returns data.
+func (s *idleStream) reader(r io.Reader) io.Reader {
+	return readerFunc(func(p []byte) (int, error) {
+		n, err := r.Read(p)
+		if n > 0 && s.timer != nil {
+			s.timer.Reset(s.timeout)
+		}
+		return n, err
+	})
+}
+
+// err replaces err with the reason the stream was cancelled, if it stalled.
+func (s *idleStream) err(err error) error {
+	if cause := context.Cause(s.ctx); errors.Is(cause, errStreamIdle) {
+		return cause
+	}
+	return err
+}
+
+func (s *idleStream) stop() {
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+	s.cancel(nil)
+}
+
+type readerFunc func(p []byte) (int, error)
+
+func (f readerFunc) Read(p []byte) (int, error) {
+	return f(p)
+}
+
+// readSSE reads a text/event-stream body and calls fn with the payload of
+// every "data:" line until the "[DONE]" sentinel used by both Cloudflare and
+// OpenAI is seen. A stream that ends before that returns errStreamTruncated.
+func readSSE(r io.Reader, fn func(data string) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+
+		data := strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		if data == "" {
+			continue
+		}
+		if data == "[DONE]" {
+			return nil
+		}
+
+		if err := fn(data); err != nil {
+			return err
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read event stream: %v", err)
+	}
+	return errStreamTruncated
+}
@@ -0,0 +1,79 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestReadSSE(t *testing.T) {
+	tests := []struct {
+		name   string
+		stream string
+		want   []string
+		err    error
+	}{
+		{"complete", "data: a\n\n: comment\ndata:b\n\ndata: [DONE]\n\n", []string{"a", "b"}, nil},
+		{"events after done", "data: a\n\ndata: [DONE]\n\ndata: b\n\n", []string{"a"}, nil},
+		{"truncated", "data: a\n\ndata: b\n\n", []string{"a", "b"}, errStreamTruncated},
+		{"empty", "", nil, errStreamTruncated},
+	}
+	for _, tt := range tests {
+		var got []string
+		err := readSSE(strings.NewReader(tt.stream), func(data string) error {
+			got = append(got, data)
+			return nil
+		})
+		if !errors.Is(err, tt.err) || (tt.err == nil && err != nil) {
+			t.Errorf("%s: err = %v, want %v", tt.name, err, tt.err)
+		}
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%s: events = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestOpenAIStreamTruncated(t *testing.T) {
+	chunk := func(content, finishReason string) string {
+		return fmt.Sprintf(`data: {"choices":[{"delta":{"content":%q},"finish_reason":%q}]}`+"\n\n", content, finishReason)
+	}
+	const usage = `data: {"choices":[],"usage":{"prompt_tokens":5,"completion_tokens":2}}` + "\n\n"
+
+	tests := []struct {
+		name   string
+		stream string
+		ok     bool
+	}{
+		{"complete", chunk("Hello", "") + chunk(" world", "stop") + usage + "data: [DONE]\n\n", true},
+		{"closed after final chunk", chunk("Hello", "") + chunk(" world", "stop") + usage, true},
+		{"cut off", chunk("Hello", "") + chunk(" wor", ""), false},
+	}
+	for _, tt := range tests {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/event-stream")
+			fmt.Fprint(w, tt.stream)
+		}))
+
+		p := NewOpenAIProvider(server.URL, "", 0, 0)
+		result, err := p.StreamText(context.Background(), TextGenerationRequest{Model: "m"}, func(string) error { return nil })
+		server.Close()
+
+		if !tt.ok {
+			if !errors.Is(err, errStreamTruncated) {
+				t.Errorf("%s: err = %v, want errStreamTruncated", tt.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if result.Text != "Hello world" || result.Usage.Total() != 7 {
+			t.Errorf("%s: result = %+v", tt.name, result)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+var (
+	ErrObjectNotFound      = errors.New("object not found")
+	ErrInvalidURLSignature = errors.New("invalid or expired signature")
+)
+
+// Storage keeps generated files such as images. Objects are private; clients
+// fetch them through signed URLs that expire. Keys are slash-separated paths
+// without a leading slash.
+type Storage interface {
+	// Put stores data under key. Backends that keep metadata serve the object
+	// with contentType and cacheControl.
+	Put(ctx context.Context, key string, data []byte, contentType string, cacheControl string) error
+	// Get opens a stored object; the caller must close its Body. It returns
+	// ErrObjectNotFound if there is no object under key.
+	Get(ctx context.Context, key string) (*StoredObject, error)
+	// Delete removes an object. Deleting a missing object succeeds.
+	Delete(ctx context.Context, key string) error
+	// SignedURL returns an address clients can fetch the object from until
+	// expiry has passed.
+	SignedURL(key string, expiry time.Duration) (string, error)
+}
+
+// objectPrivatizer is implemented by backends that may hold objects stored
+// as public before images were made private.
+type objectPrivatizer interface {
+	// MakePrivate removes public access to an object. Missing objects are
+	// left alone.
+	MakePrivate(ctx context.Context, key string) error
+}
+
+type StoredObject struct {
+	Body        io.ReadCloser
+	ContentType string
+	Size        int64
+}
+
+// NewStorage configures storage from the environment. STORAGE_BACKEND is
+// "s3" or "local"; it defaults to s3 when S3_BUCKET is set and local
+// otherwise.
+//
+// The s3 backend uses S3_BUCKET, AWS_REGION, AWS_ACCESS_KEY_ID and
+// AWS_SECRET_ACCESS_KEY. Set S3_ENDPOINT for an S3-compatible service such as
+// MinIO or R2, and S3_FORCE_PATH_STYLE=true if it doesn't support bucket
+// subdomains.
+//
+// The local backend keeps files in STORAGE_DIR (default "storage") and the
+// API serves them under /api/v1/files/, or STORAGE_PUBLIC_URL if the API is
+// reached at another address. Its URLs are signed with JWT_SECRET.
+func NewStorage() (Storage, error) {
+	backend := os.Getenv("STORAGE_BACKEND")
+	if backend == "" {
+		backend = "local"
+		if os.Getenv("S3_BUCKET") != "" {
+			backend = "s3"
+		}
+	}
+	switch backend {
+	case "s3":
+		return NewS3Storage(S3Config{
+			Bucket:          os.Getenv("S3_BUCKET"),
+			Region:          os.Getenv("AWS_REGION"),
+			AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			Endpoint:        os.Getenv("S3_ENDPOINT"),
+			ForcePathStyle:  os.Getenv("S3_FORCE_PATH_STYLE") == "true",
+		})
+	case "local":
+		dir := os.Getenv("STORAGE_DIR")
+		if dir == "" {
+			dir = "storage"
+		}
+		publicURL := strings.TrimSuffix(os.Getenv("STORAGE_PUBLIC_URL"), "/")
+		if publicURL == "" {
+			port := os.Getenv("PORT")
+			if port == "" {
+				port = "8080"
+			}
+			publicURL = "http://localhost:" + port + "/api/v1/files"
+		}
+		secret := os.Getenv("JWT_SECRET")
+		if secret == "" {
+			secret = "your-256-bit-secret" // Default secret for development
+		}
+		return NewLocalStorage(dir, publicURL, []byte(secret))
+	default:
+		return nil, fmt.Errorf("unknown STORAGE_BACKEND %q", backend)
+	}
+}
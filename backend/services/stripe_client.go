@@ -0,0 +1,157 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const stripeDefaultBaseURL = "https://api.stripe.com"
+
+// stripeTimeout bounds a whole Stripe API call, so that a slow Stripe can't
+// hold up checkout requests indefinitely
+const stripeTimeout = 30 * time.Second
+
+// BillingClient is the subset of the Stripe API we use. StripeClient talks to
+// Stripe (or anything that speaks its API, such as stripe-mock); tests and
+// local development can point it at a fake server via STRIPE_API_BASE.
+type BillingClient interface {
+	CreateCustomer(ctx context.Context, params CustomerParams) (string, error)
+	CreateCheckoutSession(ctx context.Context, params CheckoutParams) (*CheckoutSession, error)
+	CreatePortalSession(ctx context.Context, customerID, returnURL string) (string, error)
+}
+
+type CustomerParams struct {
+	Email  string
+	Name   string
+	UserID string
+}
+
+type CheckoutParams struct {
+	CustomerID string
+	PriceID    string
+	UserID     string
+	Tier       string
+	SuccessURL string
+	CancelURL  string
+}
+
+type CheckoutSession struct {
+	ID  string `json:"id"`
+	URL string `json:"url"`
+}
+
+type StripeClient struct {
+	baseURL   string
+	secretKey string
+	client    *http.Client
+}
+
+type stripeErrorResponse struct {
+	Error struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// NewStripeClient creates a client for the Stripe API. An empty baseURL
+// means api.stripe.com.
+func NewStripeClient(secretKey, baseURL string) *StripeClient {
+	if baseURL == "" {
+		baseURL = stripeDefaultBaseURL
+	}
+	return &StripeClient{
+		baseURL:   strings.TrimRight(baseURL, "/"),
+		secretKey: secretKey,
+		client:    &http.Client{Timeout: stripeTimeout},
+	}
+}
+
+func (c *StripeClient) CreateCustomer(ctx context.Context, params CustomerParams) (string, error) {
+	form := url.Values{}
+	form.Set("email", params.Email)
+	form.Set("name", params.Name)
+	form.Set("metadata[user_id]", params.UserID)
+
+	var customer struct {
+		ID string `json:"id"`
+	}
+	if err := c.post(ctx, "/v1/customers", form, &customer); err != nil {
+		return "", err
+	}
+	return customer.ID, nil
+}
+
+func (c *StripeClient) CreateCheckoutSession(ctx context.Context, params CheckoutParams) (*CheckoutSession, error) {
+	form := url.Values{}
+	form.Set("mode", "subscription")
+	form.Set("customer", params.CustomerID)
+	form.Set("client_reference_id", params.UserID)
+	form.Set("line_items[0][price]", params.PriceID)
+	form.Set("line_items[0][quantity]", "1")
+	form.Set("success_url", params.SuccessURL)
+	form.Set("cancel_url", params.CancelURL)
+	form.Set("metadata[user_id]", params.UserID)
+	form.Set("metadata[tier]", params.Tier)
+	form.Set("subscription_data[metadata][user_id]", params.UserID)
+
+	var session CheckoutSession
+	if err := c.post(ctx, "/v1/checkout/sessions", form, &session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func (c *StripeClient) CreatePortalSession(ctx context.Context, customerID, returnURL string) (string, error) {
+	form := url.Values{}
+	form.Set("customer", customerID)
+	form.Set("return_url", returnURL)
+
+	var session struct {
+		URL string `json:"url"`
+	}
+	if err := c.post(ctx, "/v1/billing_portal/sessions", form, &session); err != nil {
+		return "", err
+	}
+	return session.URL, nil
+}
+
+// post sends a form-encoded request, as the Stripe API expects, and decodes
+// the JSON response into out.
+func (c *StripeClient) post(ctx context.Context, path string, form url.Values, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+path, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+c.secretKey)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response body: %v", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var errResponse stripeErrorResponse
+		if json.Unmarshal(body, &errResponse) == nil && errResponse.Error.Message != "" {
+			return fmt.Errorf("Stripe error: %s", errResponse.Error.Message)
+		}
+		return fmt.Errorf("Stripe request failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("failed to parse response JSON: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+package services
+
+import (
+	"ai-content-creation/models"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrTemplateNotFound   = errors.New("template not found")
+	ErrInvalidPlaceholder = errors.New("placeholders must look like {{name}} using letters, digits and underscores")
+)
+
+// placeholderPattern matches {{name}}, allowing spaces inside the braces
+var placeholderPattern = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+
+// TemplateInput holds the editable fields of a prompt template.
+type TemplateInput struct {
+	Name         string
+	SystemPrompt string
+	UserPrompt   string
+	DefaultModel string
+}
+
+type TemplateService struct {
+	db *gorm.DB
+}
+
+func NewTemplateService(db *gorm.DB) *TemplateService {
+	return &TemplateService{db: db}
+}
+
+func (s *TemplateService) CreateTemplate(userID string, input TemplateInput) (*models.PromptTemplate, error) {
+	template := &models.PromptTemplate{
+		TemplateID: uuid.New().String(),
+		UserID:     userID,
+	}
+	if err := applyTemplateInput(template, input); err != nil {
+		return nil, err
+	}
+
+	if err := s.db.Create(template).Error; err != nil {
+		return nil, fmt.Errorf("failed to create template: %v", err)
+	}
+	return template, nil
+}
+
+func (s *TemplateService) GetTemplates(userID string) ([]models.PromptTemplate, error) {
+	var templates []models.PromptTemplate
+	if err := s.db.Where("user_id = ?", userID).Order("name").Find(&templates).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch templates: %v", err)
+	}
+	return templates, nil
+}
+
+func (s *TemplateService) GetTemplate(userID string, templateID string) (*models.PromptTemplate, error) {
+	return s.findTemplate(s.db.Where("template_id = ? AND user_id = ?", templateID, userID))
+}
+
+// templateByID returns a template whoever owns it, for requests that were
+// checked against their owner when they were made.
+func (s *TemplateService) templateByID(templateID string) (*models.PromptTemplate, error) {
+	return s.findTemplate(s.db.Where("template_id = ?", templateID))
+}
+
+func (s *TemplateService) findTemplate(query *gorm.DB) (*models.PromptTemplate, error) {
+	var template models.PromptTemplate
+	if err := query.First(&template).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrTemplateNotFound
+		}
+		return nil, fmt.Errorf("failed to fetch template: %v", err)
+	}
+	return &template, nil
+}
+
+// UpdateTemplate replaces every editable field of the template.
+func (s *TemplateService) UpdateTemplate(userID string, templateID string, input TemplateInput) (*models.PromptTemplate, error) {
+	template, err := s.GetTemplate(userID, templateID)
+	if err != nil {
+		return nil, err
+	}
+	if err := applyTemplateInput(template, input); err != nil {
+		return nil, err
+	}
+
+	if err := s.db.Save(template).Error; err != nil {
+		return nil, fmt.Errorf("failed to update template: %v", err)
+	}
+	return template, nil
+}
+
+func (s *TemplateService) DeleteTemplate(userID string, templateID string) error {
+	template, err := s.GetTemplate(userID, templateID)
+	if err != nil {
+		return err
+	}
+	if err := s.db.Delete(template).Error; err != nil {
+		return fmt.Errorf("failed to delete template: %v", err)
+	}
+	return nil
+}
+
+func applyTemplateInput(template *models.PromptTemplate, input TemplateInput) error {
+	for _, text := range []string{input.SystemPrompt, input.UserPrompt} {
+		// Anything brace-like left after removing valid placeholders is a typo
+		rest := placeholderPattern.ReplaceAllString(text, "")
+		if strings.Contains(rest, "{{") || strings.Contains(rest, "}}") {
+			return ErrInvalidPlaceholder
+		}
+	}
+
+	template.Name = strings.TrimSpace(input.Name)
+	template.SystemPrompt = strings.TrimSpace(input.SystemPrompt)
+	template.UserPrompt = strings.TrimSpace(input.UserPrompt)
+	template.DefaultModel = strings.TrimSpace(input.DefaultModel)
+	return nil
+}
+
+// TemplateVariables returns the sorted, de-duplicated names of the
+// placeholders used in a template's system and user prompts.
+func TemplateVariables(template *models.PromptTemplate) []string {
+	seen := map[string]bool{}
+	names := []string{}
+	for _, text := range []string{template.SystemPrompt, template.UserPrompt} {
+		for _, match := range placeholderPattern.FindAllStringSubmatch(text, -1) {
+			if !seen[match[1]] {
+				seen[match[1]] = true
+				names = append(names, match[1])
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// checkVariables makes sure variables supplies a non-empty value for every
+// placeholder of the template and nothing else.
+func checkVariables(template *models.PromptTemplate, variables map[string]string) error {
+	verr := &TemplateVariablesError{}
+
+	expected := map[string]bool{}
+	for _, name := range TemplateVariables(template) {
+		expected[name] = true
+		value, ok := variables[name]
+		if !ok {
+			verr.Missing = append(verr.Missing, name)
+		} else if strings.TrimSpace(value) == "" {
+			verr.Empty = append(verr.Empty, name)
+		}
+	}
+	for name := range variables {
+		if !expected[name] {
+			verr.Unknown = append(verr.Unknown, name)
+		}
+	}
+	sort.Strings(verr.Unknown)
+
+	if len(verr.Missing) > 0 || len(verr.Unknown) > 0 || len(verr.Empty) > 0 {
+		return verr
+	}
+	return nil
+}
+
+// renderTemplate substitutes variables into text in a single pass, so values
+// that themselves look like placeholders are left alone.
+func renderTemplate(text string, variables map[string]string) string {
+	return placeholderPattern.ReplaceAllStringFunc(text, func(placeholder string) string {
+		name := placeholderPattern.FindStringSubmatch(placeholder)[1]
+		return strings.TrimSpace(variables[name])
+	})
+}
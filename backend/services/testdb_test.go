@@ -0,0 +1,53 @@
+package services
+
+import (
+	"ai-content-creation/models"
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newTestDB returns a migrated in-memory database that is closed when the
+// test ends.
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	// Each connection to :memory: gets its own empty database, so keep to one.
+	// This also serialises transactions the way SQLite's file lock would.
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	if err := models.InitDB(db); err != nil {
+		t.Fatalf("migrate database: %v", err)
+	}
+	return db
+}
+
+// createTestUser adds a free-tier user with credits whose monthly reset is a
+// month away.
+func createTestUser(t *testing.T, db *gorm.DB, userID string, credits int) *models.User {
+	t.Helper()
+	resetAt := time.Now().AddDate(0, 1, 0)
+	user := &models.User{
+		UserID:           userID,
+		Name:             userID,
+		Email:            userID + "@example.com",
+		SubscriptionTier: models.FreeTier,
+		RemainingCredits: credits,
+		CreditsResetAt:   &resetAt,
+	}
+	if err := db.Create(user).Error; err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	return user
+}
@@ -0,0 +1,105 @@
+package services
+
+import (
+	"ai-content-creation/models"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var ErrTokenQuotaExceeded = errors.New("monthly token quota exceeded")
+
+// UsageService meters token consumption against the plan's TokensPerMonth.
+// The usage period follows the user's monthly credit reset.
+type UsageService struct {
+	db                  *gorm.DB
+	creditService       *CreditService
+	subscriptionService *SubscriptionService
+}
+
+// Usage is a user's token consumption for the current period. TokensLimit and
+// TokensRemaining are -1 on unlimited plans.
+type Usage struct {
+	PeriodStart      time.Time
+	ResetsAt         time.Time
+	Requests         int
+	PromptTokens     int
+	CompletionTokens int
+	TokensUsed       int
+	TokensLimit      int
+	TokensRemaining  int
+}
+
+func NewUsageService(db *gorm.DB, creditService *CreditService, subscriptionService *SubscriptionService) *UsageService {
+	return &UsageService{
+		db:                  db,
+		creditService:       creditService,
+		subscriptionService: subscriptionService,
+	}
+}
+
+// GetUsage sums the tokens of every generation run in the current period,
+// counting each request that ran once. Tokens count even when a request
+// later failed, since the provider still did the work.
+func (s *UsageService) GetUsage(userID string) (*Usage, error) {
+	user, err := s.creditService.GetBalance(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	plan, err := s.subscriptionService.GetPlanByTier(user.SubscriptionTier)
+	if err != nil {
+		return nil, err
+	}
+
+	// GetBalance always leaves a reset date in the future
+	resetsAt := *user.CreditsResetAt
+	periodStart := resetsAt.AddDate(0, -1, 0)
+
+	var totals struct {
+		Requests         int
+		PromptTokens     int
+		CompletionTokens int
+	}
+	if err := s.db.Model(&models.UsageRecord{}).
+		Select("COUNT(DISTINCT request_id) AS requests, COALESCE(SUM(prompt_tokens), 0) AS prompt_tokens, COALESCE(SUM(completion_tokens), 0) AS completion_tokens").
+		Where("user_id = ? AND created_at >= ?", userID, periodStart).
+		Scan(&totals).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch usage: %v", err)
+	}
+
+	usage := &Usage{
+		PeriodStart:      periodStart,
+		ResetsAt:         resetsAt,
+		Requests:         totals.Requests,
+		PromptTokens:     totals.PromptTokens,
+		CompletionTokens: totals.CompletionTokens,
+		TokensUsed:       totals.PromptTokens + totals.CompletionTokens,
+		TokensLimit:      plan.TokensPerMonth,
+		TokensRemaining:  -1,
+	}
+	if plan.TokensPerMonth >= 0 {
+		usage.TokensRemaining = plan.TokensPerMonth - usage.TokensUsed
+		if usage.TokensRemaining < 0 {
+			usage.TokensRemaining = 0
+		}
+	}
+
+	return usage, nil
+}
+
+// CheckQuota returns ErrTokenQuotaExceeded once the user has used up their
+// monthly tokens. Usage is only known after a generation, so the last request
+// of a period may take the user slightly over the limit.
+func (s *UsageService) CheckQuota(userID string) error {
+	usage, err := s.GetUsage(userID)
+	if err != nil {
+		return err
+	}
+	if usage.TokensLimit >= 0 && usage.TokensRemaining == 0 {
+		return ErrTokenQuotaExceeded
+	}
+	return nil
+}
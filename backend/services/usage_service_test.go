@@ -0,0 +1,68 @@
+package services
+
+import (
+	"ai-content-creation/models"
+	"testing"
+	"time"
+)
+
+func TestUsageCountsWhenTokensWereUsed(t *testing.T) {
+	db := newTestDB(t)
+	credits := NewCreditService(db)
+	usage := NewUsageService(db, credits, NewSubscriptionService(db))
+	content := &ContentService{db: db}
+	createTestUser(t, db, "u1", 0)
+
+	// A request made last month, with the tokens of its first run
+	lastMonth := time.Now().AddDate(0, -2, 0)
+	old := &models.ContentRequest{RequestID: "old", UserID: "u1", RunBy: "u1", PromptTokens: 400, CompletionTokens: 100}
+	old.CreatedAt = lastMonth
+	db.Create(old)
+	first := models.UsageRecord{RequestID: "old", UserID: "u1", PromptTokens: 400, CompletionTokens: 100}
+	first.CreatedAt = lastMonth
+	db.Create(&first)
+
+	got, err := usage.GetUsage("u1")
+	if err != nil {
+		t.Fatalf("GetUsage: %v", err)
+	}
+	if got.TokensUsed != 0 || got.Requests != 0 {
+		t.Fatalf("last month's tokens counted: %+v", got)
+	}
+
+	// Regenerating it this month counts this month
+	if err := content.recordUsage(old, TokenUsage{PromptTokens: 200, CompletionTokens: 100}); err != nil {
+		t.Fatalf("recordUsage: %v", err)
+	}
+	// A new request for two platforms
+	fresh := &models.ContentRequest{RequestID: "new", UserID: "u1", RunBy: "u1"}
+	db.Create(fresh)
+	for i := 0; i < 2; i++ {
+		if err := content.recordUsage(fresh, TokenUsage{PromptTokens: 50, CompletionTokens: 50, Estimated: true}); err != nil {
+			t.Fatalf("recordUsage: %v", err)
+		}
+	}
+
+	got, err = usage.GetUsage("u1")
+	if err != nil {
+		t.Fatalf("GetUsage: %v", err)
+	}
+	if got.Requests != 2 || got.PromptTokens != 300 || got.CompletionTokens != 200 || got.TokensUsed != 500 {
+		t.Fatalf("usage = %+v, want 2 requests, 300 prompt and 200 completion tokens", got)
+	}
+	if got.TokensLimit != 10000 || got.TokensRemaining != 9500 {
+		t.Errorf("limit, remaining = %d, %d, want 10000, 9500", got.TokensLimit, got.TokensRemaining)
+	}
+
+	// The request keeps its totals over every run
+	var stored models.ContentRequest
+	db.First(&stored, "request_id = ?", "old")
+	if stored.PromptTokens != 600 || stored.CompletionTokens != 200 {
+		t.Errorf("old request totals = %d, %d, want 600, 200", stored.PromptTokens, stored.CompletionTokens)
+	}
+	var storedFresh models.ContentRequest
+	db.First(&storedFresh, "request_id = ?", "new")
+	if storedFresh.PromptTokens != 100 || !storedFresh.TokensEstimated {
+		t.Errorf("new request totals = %d, estimated %v, want 100, true", storedFresh.PromptTokens, storedFresh.TokensEstimated)
+	}
+}
@@ -2,44 +2,242 @@ package services
 
 import (
 	"ai-content-creation/models"
-	"net/http"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
 
-	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
 
+var (
+	ErrUserNotFound       = errors.New("user not found")
+	ErrInvalidName        = errors.New("name must not be empty")
+	ErrEmailTaken         = errors.New("email address is already in use")
+	ErrIncorrectPassword  = errors.New("current password is incorrect")
+	ErrActiveSubscription = errors.New("cancel the subscription before deleting the account")
+	ErrSharedWorkspace    = errors.New("remove the other members of your workspaces before deleting the account")
+)
+
+// ProfileUpdate changes the signed-in user's profile. Nil fields are left
+// alone.
+type ProfileUpdate struct {
+	Name     *string
+	Email    *string
+	Password string // current password, required to change the email
+}
+
 type UserService struct {
-	db *gorm.DB
+	db             *gorm.DB
+	authService    *AuthService
+	contentService *ContentService
 }
 
-func NewUserService(db *gorm.DB) *UserService {
-	return &UserService{db: db}
+func NewUserService(db *gorm.DB, authService *AuthService, contentService *ContentService) *UserService {
+	return &UserService{db: db, authService: authService, contentService: contentService}
 }
 
-func (s *UserService) CreateUser(c *gin.Context) {
+func (s *UserService) GetUser(userID string) (*models.User, error) {
 	var user models.User
-	if err := c.ShouldBindJSON(&user); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
+	if err := s.db.First(&user, "user_id = ?", userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, fmt.Errorf("failed to fetch user: %v", err)
+	}
+	return &user, nil
+}
+
+// UpdateProfile changes the user's name and email. A new email address has
+// to be verified again, so it is marked unverified and sent a verification
+// email; reset links sent to the old address stop working.
+func (s *UserService) UpdateProfile(userID string, update ProfileUpdate) (*models.User, error) {
+	user, err := s.GetUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	updates := map[string]interface{}{}
+	if update.Name != nil {
+		name := strings.TrimSpace(*update.Name)
+		if name == "" {
+			return nil, ErrInvalidName
+		}
+		updates["name"] = name
+	}
+
+	emailChanged := update.Email != nil && normalizeEmail(*update.Email) != normalizeEmail(user.Email)
+	if emailChanged {
+		if err := checkPassword(user, update.Password); err != nil {
+			return nil, err
+		}
+		updates["email"] = normalizeEmail(*update.Email)
+		updates["email_verified_at"] = nil
+	}
+
+	if len(updates) == 0 {
+		return user, nil
 	}
 
-	// Generate UUID for new user
-	user.UserID = uuid.New().String()
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if emailChanged {
+			var taken int64
+			if err := tx.Model(&models.User{}).
+				Where("LOWER(email) = ? AND user_id <> ?", updates["email"], userID).
+				Count(&taken).Error; err != nil {
+				return fmt.Errorf("failed to check email: %v", err)
+			}
+			if taken > 0 {
+				return ErrEmailTaken
+			}
+
+			now := time.Now()
+			if err := tx.Model(&models.AccountToken{}).
+				Where("user_id = ? AND used_at IS NULL", userID).
+				Update("used_at", &now).Error; err != nil {
+				return fmt.Errorf("failed to invalidate account tokens: %v", err)
+			}
+		}
+
+		if err := tx.Model(user).Updates(updates).Error; err != nil {
+			return fmt.Errorf("failed to update user: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
 
-	if err := s.db.Create(&user).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
-		return
+	if emailChanged {
+		if err := s.authService.SendVerificationEmail(userID); err != nil {
+			log.Printf("Failed to send verification email to user %s: %v", userID, err)
+		}
 	}
 
-	c.JSON(http.StatusCreated, user)
+	return s.GetUser(userID)
 }
 
-func (s *UserService) GetUser(c *gin.Context) {
-	var user models.User
-	if err := s.db.First(&user, "user_id = ?", c.Param("id")).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
-		return
+// ChangePassword sets a new password after checking the current one, and
+// signs the user out of every session except sessionID.
+func (s *UserService) ChangePassword(userID string, sessionID string, current string, password string) error {
+	user, err := s.GetUser(userID)
+	if err != nil {
+		return err
+	}
+	if err := checkPassword(user, current); err != nil {
+		return err
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %v", err)
 	}
-	c.JSON(http.StatusOK, user)
-} 
\ No newline at end of file
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(user).Update("password", string(hashedPassword)).Error; err != nil {
+			return fmt.Errorf("failed to update password: %v", err)
+		}
+
+		now := time.Now()
+		if err := tx.Model(&models.Session{}).
+			Where("user_id = ? AND session_id <> ? AND revoked_at IS NULL", userID, sessionID).
+			Update("revoked_at", &now).Error; err != nil {
+			return fmt.Errorf("failed to revoke sessions: %v", err)
+		}
+		return nil
+	})
+}
+
+// DeleteUser permanently deletes the user's account after checking their
+// password. Their personal content and its images go with it, as do the
+// workspaces they own. Content they generated in other workspaces belongs to
+// those workspaces and stays.
+func (s *UserService) DeleteUser(userID string, password string) error {
+	user, err := s.GetUser(userID)
+	if err != nil {
+		return err
+	}
+	if err := checkPassword(user, password); err != nil {
+		return err
+	}
+	if user.StripeSubscriptionID != "" {
+		return ErrActiveSubscription
+	}
+
+	var owned []string
+	if err := s.db.Model(&models.Workspace{}).Where("owner_id = ?", userID).
+		Pluck("workspace_id", &owned).Error; err != nil {
+		return fmt.Errorf("failed to fetch workspaces: %v", err)
+	}
+	var others int64
+	if err := s.db.Model(&models.Membership{}).
+		Where("workspace_id IN ? AND user_id <> ?", owned, userID).
+		Count(&others).Error; err != nil {
+		return fmt.Errorf("failed to fetch members: %v", err)
+	}
+	if others > 0 {
+		return ErrSharedWorkspace
+	}
+
+	var requestIDs, imageKeys []string
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.ContentRequest{}).Unscoped().
+			Where("(user_id = ? AND workspace_id = '') OR workspace_id IN ?", userID, owned).
+			Pluck("request_id", &requestIDs).Error; err != nil {
+			return fmt.Errorf("failed to fetch content requests: %v", err)
+		}
+		imageKeys, err = deleteRequests(tx, requestIDs)
+		if err != nil {
+			return err
+		}
+
+		var sessionIDs []string
+		if err := tx.Model(&models.Session{}).Unscoped().Where("user_id = ?", userID).
+			Pluck("session_id", &sessionIDs).Error; err != nil {
+			return fmt.Errorf("failed to fetch sessions: %v", err)
+		}
+
+		deletes := []struct {
+			model interface{}
+			query string
+			args  []interface{}
+		}{
+			{&models.CreditTransaction{}, "(user_id = ? AND workspace_id = '') OR workspace_id IN ?", []interface{}{userID, owned}},
+			{&models.UsageRecord{}, "user_id = ?", []interface{}{userID}},
+			{&models.Brand{}, "user_id = ?", []interface{}{userID}},
+			{&models.PromptTemplate{}, "user_id = ?", []interface{}{userID}},
+			{&models.APIKey{}, "user_id = ? OR workspace_id IN ?", []interface{}{userID, owned}},
+			{&models.RefreshToken{}, "session_id IN ?", []interface{}{sessionIDs}},
+			{&models.Session{}, "user_id = ?", []interface{}{userID}},
+			{&models.AccountToken{}, "user_id = ?", []interface{}{userID}},
+			{&models.LoginEvent{}, "user_id = ? OR email = ?", []interface{}{userID, normalizeEmail(user.Email)}},
+			{&models.WorkspaceInvitation{}, "workspace_id IN ?", []interface{}{owned}},
+			{&models.Membership{}, "user_id = ?", []interface{}{userID}},
+			{&models.Workspace{}, "workspace_id IN ?", []interface{}{owned}},
+			{&models.User{}, "user_id = ?", []interface{}{userID}},
+		}
+		for _, d := range deletes {
+			if err := tx.Unscoped().Where(d.query, d.args...).Delete(d.model).Error; err != nil {
+				return fmt.Errorf("failed to delete account data: %v", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	s.contentService.stopRequests(requestIDs)
+	s.contentService.deleteImages(imageKeys)
+	return nil
+}
+
+// checkPassword returns ErrIncorrectPassword unless password is the user's.
+func checkPassword(user *models.User, password string) error {
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
+		return ErrIncorrectPassword
+	}
+	return nil
+}
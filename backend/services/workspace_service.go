@@ -0,0 +1,437 @@
+package services
+
+import (
+	"ai-content-creation/models"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrWorkspaceNotFound  = errors.New("workspace not found")
+	ErrMemberNotFound     = errors.New("member not found")
+	ErrAlreadyMember      = errors.New("user is already a member of this workspace")
+	ErrWorkspaceOwner     = errors.New("the workspace owner cannot be removed or given another role")
+	ErrInvalidRole        = errors.New("role must be admin, editor or viewer")
+	ErrInvitationNotFound = errors.New("invitation not found")
+	ErrInvalidInvitation  = errors.New("invalid or expired invitation")
+	ErrInvitationEmail    = errors.New("invitation was sent to a different email address")
+	ErrInvalidWorkspace   = errors.New("workspace name must not be empty or contain control characters")
+)
+
+// roleRanks orders workspace roles; a role may do everything ranked below it.
+var roleRanks = map[models.WorkspaceRole]int{
+	models.WorkspaceViewer: 1,
+	models.WorkspaceEditor: 2,
+	models.WorkspaceAdmin:  3,
+	models.WorkspaceOwner:  4,
+}
+
+// HasRole reports whether role includes everything min may do.
+func HasRole(role, min models.WorkspaceRole) bool {
+	return roleRanks[role] >= roleRanks[min]
+}
+
+// MemberWorkspace is a workspace together with a user's role in it.
+type MemberWorkspace struct {
+	Workspace models.Workspace
+	Role      models.WorkspaceRole
+}
+
+// Member is a workspace member with their account details.
+type Member struct {
+	UserID   string
+	Name     string
+	Email    string
+	Role     models.WorkspaceRole
+	JoinedAt time.Time
+}
+
+type WorkspaceService struct {
+	db          *gorm.DB
+	mailer      Mailer
+	frontendURL string
+	inviteTTL   time.Duration
+}
+
+// NewWorkspaceService creates the workspace service. Invitations expire after
+// WORKSPACE_INVITATION_TTL (default 7 days).
+func NewWorkspaceService(db *gorm.DB, mailer Mailer) *WorkspaceService {
+	return &WorkspaceService{
+		db:          db,
+		mailer:      mailer,
+		frontendURL: os.Getenv("FRONTEND_URL"),
+		inviteTTL:   envDuration("WORKSPACE_INVITATION_TTL", 7*24*time.Hour),
+	}
+}
+
+// CreateWorkspace creates a workspace owned by the user, with an empty credit
+// pool.
+func (s *WorkspaceService) CreateWorkspace(userID string, name string) (*models.Workspace, error) {
+	name, err := workspaceName(name)
+	if err != nil {
+		return nil, err
+	}
+	workspace := models.Workspace{
+		WorkspaceID: uuid.New().String(),
+		Name:        name,
+		OwnerID:     userID,
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&workspace).Error; err != nil {
+			return fmt.Errorf("failed to create workspace: %v", err)
+		}
+		return tx.Create(&models.Membership{
+			WorkspaceID: workspace.WorkspaceID,
+			UserID:      userID,
+			Role:        models.WorkspaceOwner,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &workspace, nil
+}
+
+// GetWorkspaces returns the workspaces the user is a member of, ordered by
+// name.
+func (s *WorkspaceService) GetWorkspaces(userID string) ([]MemberWorkspace, error) {
+	var memberships []models.Membership
+	if err := s.db.Where("user_id = ?", userID).Find(&memberships).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch memberships: %v", err)
+	}
+
+	roles := map[string]models.WorkspaceRole{}
+	ids := []string{}
+	for _, m := range memberships {
+		roles[m.WorkspaceID] = m.Role
+		ids = append(ids, m.WorkspaceID)
+	}
+
+	var workspaces []models.Workspace
+	if err := s.db.Where("workspace_id IN ?", ids).Order("name").Find(&workspaces).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch workspaces: %v", err)
+	}
+
+	result := []MemberWorkspace{}
+	for _, w := range workspaces {
+		result = append(result, MemberWorkspace{Workspace: w, Role: roles[w.WorkspaceID]})
+	}
+	return result, nil
+}
+
+func (s *WorkspaceService) GetWorkspace(workspaceID string) (*models.Workspace, error) {
+	var workspace models.Workspace
+	if err := s.db.Where("workspace_id = ?", workspaceID).First(&workspace).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrWorkspaceNotFound
+		}
+		return nil, fmt.Errorf("failed to fetch workspace: %v", err)
+	}
+	return &workspace, nil
+}
+
+func (s *WorkspaceService) RenameWorkspace(workspaceID string, name string) (*models.Workspace, error) {
+	name, err := workspaceName(name)
+	if err != nil {
+		return nil, err
+	}
+	workspace, err := s.GetWorkspace(workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.db.Model(workspace).Update("name", name).Error; err != nil {
+		return nil, fmt.Errorf("failed to update workspace: %v", err)
+	}
+	return workspace, nil
+}
+
+// workspaceName trims a workspace name and rejects control characters, since
+// names end up in email subjects.
+func workspaceName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || strings.IndexFunc(name, unicode.IsControl) >= 0 {
+		return "", ErrInvalidWorkspace
+	}
+	return name, nil
+}
+
+// GetMembership returns the user's membership of a workspace. Users who
+// aren't members get ErrWorkspaceNotFound, so that workspaces they can't see
+// are indistinguishable from ones that don't exist.
+func (s *WorkspaceService) GetMembership(workspaceID string, userID string) (*models.Membership, error) {
+	var membership models.Membership
+	if err := s.db.Where("workspace_id = ? AND user_id = ?", workspaceID, userID).First(&membership).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrWorkspaceNotFound
+		}
+		return nil, fmt.Errorf("failed to fetch membership: %v", err)
+	}
+	return &membership, nil
+}
+
+// GetMembers returns a workspace's members in the order they joined.
+func (s *WorkspaceService) GetMembers(workspaceID string) ([]Member, error) {
+	members := []Member{}
+	if err := s.db.Table("memberships").
+		Select("memberships.user_id, users.name, users.email, memberships.role, memberships.created_at AS joined_at").
+		Joins("JOIN users ON users.user_id = memberships.user_id").
+		Where("memberships.workspace_id = ? AND memberships.deleted_at IS NULL", workspaceID).
+		Order("memberships.created_at").
+		Scan(&members).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch members: %v", err)
+	}
+	return members, nil
+}
+
+// UpdateMemberRole changes a member's role. The owner's role is fixed and no
+// one else can be made owner.
+func (s *WorkspaceService) UpdateMemberRole(workspaceID string, userID string, role models.WorkspaceRole) (*models.Membership, error) {
+	if err := checkInviteRole(role); err != nil {
+		return nil, err
+	}
+
+	membership, err := s.findMember(workspaceID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if membership.Role == models.WorkspaceOwner {
+		return nil, ErrWorkspaceOwner
+	}
+
+	if err := s.db.Model(membership).Update("role", role).Error; err != nil {
+		return nil, fmt.Errorf("failed to update member: %v", err)
+	}
+	return membership, nil
+}
+
+// RemoveMember removes a member from a workspace. Content they generated
+// there stays in the workspace.
+func (s *WorkspaceService) RemoveMember(workspaceID string, userID string) error {
+	membership, err := s.findMember(workspaceID, userID)
+	if err != nil {
+		return err
+	}
+	if membership.Role == models.WorkspaceOwner {
+		return ErrWorkspaceOwner
+	}
+
+	if err := s.db.Unscoped().Delete(membership).Error; err != nil {
+		return fmt.Errorf("failed to remove member: %v", err)
+	}
+	return nil
+}
+
+// Invite emails an invitation to join the workspace with a role, replacing
+// any pending invitation for the same address.
+func (s *WorkspaceService) Invite(workspaceID string, invitedBy string, email string, role models.WorkspaceRole) (*models.WorkspaceInvitation, error) {
+	if err := checkInviteRole(role); err != nil {
+		return nil, err
+	}
+	email = normalizeEmail(email)
+
+	workspace, err := s.GetWorkspace(workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	var inviter models.User
+	if err := s.db.First(&inviter, "user_id = ?", invitedBy).Error; err != nil {
+		return nil, fmt.Errorf("user not found")
+	}
+
+	var members int64
+	if err := s.db.Model(&models.Membership{}).
+		Joins("JOIN users ON users.user_id = memberships.user_id").
+		Where("memberships.workspace_id = ? AND LOWER(users.email) = ?", workspaceID, email).
+		Count(&members).Error; err != nil {
+		return nil, fmt.Errorf("failed to check membership: %v", err)
+	}
+	if members > 0 {
+		return nil, ErrAlreadyMember
+	}
+
+	token, err := randomToken()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate token: %v", err)
+	}
+	invitation := models.WorkspaceInvitation{
+		InvitationID: uuid.New().String(),
+		WorkspaceID:  workspaceID,
+		Email:        email,
+		Role:         role,
+		TokenHash:    hashToken(token),
+		InvitedBy:    invitedBy,
+		ExpiresAt:    time.Now().Add(s.inviteTTL),
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("workspace_id = ? AND email = ? AND accepted_at IS NULL", workspaceID, email).
+			Delete(&models.WorkspaceInvitation{}).Error; err != nil {
+			return fmt.Errorf("failed to replace previous invitation: %v", err)
+		}
+		if err := tx.Create(&invitation).Error; err != nil {
+			return fmt.Errorf("failed to create invitation: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// The email goes out once the invitation is committed. If it can't be
+	// sent, the invitation is withdrawn again so that it can be retried.
+	if err := s.mailer.Send(Email{
+		To:      email,
+		Subject: fmt.Sprintf("You're invited to join %s", workspace.Name),
+		Body: fmt.Sprintf("Hi,\n\n%s has invited you to join the %s workspace as %s. To accept, open this link:\n\n%s/invitations?token=%s\n\nIf you don't have an account yet, sign up with this email address first. The link expires in %s.\n",
+			inviter.Name, workspace.Name, role, s.frontendURL, token, formatTTL(s.inviteTTL)),
+	}); err != nil {
+		if dbErr := s.db.Delete(&invitation).Error; dbErr != nil {
+			log.Printf("Failed to withdraw invitation %s: %v", invitation.InvitationID, dbErr)
+		}
+		return nil, err
+	}
+	return &invitation, nil
+}
+
+// GetInvitations returns a workspace's pending invitations, newest first.
+func (s *WorkspaceService) GetInvitations(workspaceID string) ([]models.WorkspaceInvitation, error) {
+	var invitations []models.WorkspaceInvitation
+	if err := s.db.Where("workspace_id = ? AND accepted_at IS NULL AND expires_at > ?", workspaceID, time.Now()).
+		Order("id DESC").
+		Find(&invitations).Error; err != nil {
+		return nil, fmt.Errorf("failed to fetch invitations: %v", err)
+	}
+	return invitations, nil
+}
+
+func (s *WorkspaceService) RevokeInvitation(workspaceID string, invitationID string) error {
+	res := s.db.Where("workspace_id = ? AND invitation_id = ? AND accepted_at IS NULL", workspaceID, invitationID).
+		Delete(&models.WorkspaceInvitation{})
+	if res.Error != nil {
+		return fmt.Errorf("failed to revoke invitation: %v", res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return ErrInvitationNotFound
+	}
+	return nil
+}
+
+// AcceptInvitation adds the user to the invitation's workspace. The user's
+// email address must be the one the invitation was sent to.
+func (s *WorkspaceService) AcceptInvitation(userID string, token string) (*models.Membership, error) {
+	var membership models.Membership
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var invitation models.WorkspaceInvitation
+		if err := tx.Where("token_hash = ?", hashToken(token)).First(&invitation).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrInvalidInvitation
+			}
+			return fmt.Errorf("failed to fetch invitation: %v", err)
+		}
+
+		now := time.Now()
+		if invitation.AcceptedAt != nil || now.After(invitation.ExpiresAt) {
+			return ErrInvalidInvitation
+		}
+
+		var user models.User
+		if err := tx.First(&user, "user_id = ?", userID).Error; err != nil {
+			return fmt.Errorf("user not found")
+		}
+		if !strings.EqualFold(user.Email, invitation.Email) {
+			return ErrInvitationEmail
+		}
+
+		// Only one concurrent use of the same invitation can win
+		res := tx.Model(&models.WorkspaceInvitation{}).
+			Where("id = ? AND accepted_at IS NULL", invitation.ID).
+			Update("accepted_at", &now)
+		if res.Error != nil {
+			return fmt.Errorf("failed to accept invitation: %v", res.Error)
+		}
+		if res.RowsAffected == 0 {
+			return ErrInvalidInvitation
+		}
+
+		var existing int64
+		if err := tx.Model(&models.Membership{}).
+			Where("workspace_id = ? AND user_id = ?", invitation.WorkspaceID, userID).
+			Count(&existing).Error; err != nil {
+			return fmt.Errorf("failed to check membership: %v", err)
+		}
+		if existing > 0 {
+			return ErrAlreadyMember
+		}
+
+		membership = models.Membership{
+			WorkspaceID: invitation.WorkspaceID,
+			UserID:      userID,
+			Role:        invitation.Role,
+		}
+		if err := tx.Create(&membership).Error; err != nil {
+			return fmt.Errorf("failed to add member: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &membership, nil
+}
+
+func (s *WorkspaceService) findMember(workspaceID string, userID string) (*models.Membership, error) {
+	membership, err := s.GetMembership(workspaceID, userID)
+	if errors.Is(err, ErrWorkspaceNotFound) {
+		return nil, ErrMemberNotFound
+	}
+	return membership, err
+}
+
+// checkInviteRole accepts the roles that can be given to a member; there is
+// only ever one owner.
+func checkInviteRole(role models.WorkspaceRole) error {
+	switch role {
+	case models.WorkspaceAdmin, models.WorkspaceEditor, models.WorkspaceViewer:
+		return nil
+	default:
+		return ErrInvalidRole
+	}
+}
+
+// RequireWorkspaceRole guards routes under /workspaces/:workspace. Users
+// whose role in the workspace is below role are rejected; otherwise the
+// workspace ID and role are set in the context as workspaceID and
+// workspaceRole. It must run after AuthMiddleware.
+func RequireWorkspaceRole(role models.WorkspaceRole) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		workspaceService := c.MustGet("workspaceService").(*WorkspaceService)
+		membership, err := workspaceService.GetMembership(c.Param("workspace"), c.GetString("userID"))
+		if err != nil {
+			if errors.Is(err, ErrWorkspaceNotFound) {
+				c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": "Workspace not found"})
+				return
+			}
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch workspace"})
+			return
+		}
+		if !HasRole(membership.Role, role) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("This requires the %s role in the workspace", role)})
+			return
+		}
+
+		c.Set("workspaceID", membership.WorkspaceID)
+		c.Set("workspaceRole", membership.Role)
+		c.Next()
+	}
+}